@@ -0,0 +1,264 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/theia-log/selene/model"
+)
+
+// Archive formats.
+const (
+	// FormatNative writes the events in the same preamble-framed format as
+	// the events are sent to theia (see model.Event.Dump), one after another
+	// separated by a new line.
+	FormatNative = "native"
+
+	// FormatJSONL writes every event as JSON object on a separate line.
+	FormatJSONL = "jsonl"
+)
+
+// Archive compression algorithms.
+const (
+	CompressNone = "none"
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+// magic numbers of the compressed streams, used to detect the compression
+// when reading an archive.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ArchiveWriter writes events to an archive.
+type ArchiveWriter interface {
+	// Write writes a single event to the archive.
+	Write(event *model.Event) error
+
+	// Close flushes the remaining data and closes the archive. The underlying
+	// writer is closed as well.
+	Close() error
+}
+
+// ArchiveReader reads events from an archive.
+type ArchiveReader interface {
+	// Read reads the next event from the archive. Returns io.EOF when there
+	// are no more events.
+	Read() (*model.Event, error)
+
+	// Close closes the archive and the underlying reader.
+	Close() error
+}
+
+// CompressionFromFileName guesses the compression from the file extension.
+func CompressionFromFileName(fileName string) string {
+	switch {
+	case strings.HasSuffix(fileName, ".gz"):
+		return CompressGzip
+	case strings.HasSuffix(fileName, ".zst"), strings.HasSuffix(fileName, ".zstd"):
+		return CompressZstd
+	}
+	return CompressNone
+}
+
+// archiveWriter writes the events in one of the archive formats and, if
+// compression is used, compresses the output.
+type archiveWriter struct {
+	out        io.WriteCloser
+	compressor io.WriteCloser
+	buffer     *bufio.Writer
+	encoder    *model.Encoder
+	format     string
+}
+
+// NewArchiveWriter creates an ArchiveWriter that writes the events in the given
+// format, compressed with the given compression algorithm, to out.
+func NewArchiveWriter(out io.WriteCloser, format, compression string) (ArchiveWriter, error) {
+	if format != FormatNative && format != FormatJSONL {
+		return nil, fmt.Errorf("unknown archive format: %s", format)
+	}
+	writer := &archiveWriter{
+		out:    out,
+		format: format,
+	}
+	var dest io.Writer = out
+	switch compression {
+	case CompressNone, "":
+	case CompressGzip:
+		writer.compressor = gzip.NewWriter(out)
+		dest = writer.compressor
+	case CompressZstd:
+		encoder, err := zstd.NewWriter(out)
+		if err != nil {
+			return nil, err
+		}
+		writer.compressor = encoder
+		dest = encoder
+	default:
+		return nil, fmt.Errorf("unknown compression: %s", compression)
+	}
+	writer.buffer = bufio.NewWriter(dest)
+	writer.encoder = model.NewEncoder(writer.buffer)
+	return writer, nil
+}
+
+func (w *archiveWriter) Write(event *model.Event) error {
+	if w.format == FormatNative {
+		return w.encoder.Encode(event)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err = w.buffer.Write(data); err != nil {
+		return err
+	}
+	return w.buffer.WriteByte('\n')
+}
+
+func (w *archiveWriter) Close() error {
+	err := w.buffer.Flush()
+	if w.compressor != nil {
+		if cerr := w.compressor.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := w.out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// archiveReader reads the events from an archive. The format and the
+// compression are detected from the content.
+type archiveReader struct {
+	in           io.ReadCloser
+	decompressor io.Closer
+	reader       *bufio.Reader
+	decoder      *model.Decoder
+	format       string
+}
+
+// NewArchiveReader creates an ArchiveReader that reads the events from in.
+// The compression is detected from the first bytes of the stream. If format is
+// empty, the format is detected from the first event in the archive as well.
+func NewArchiveReader(in io.ReadCloser, format string) (ArchiveReader, error) {
+	reader := &archiveReader{in: in}
+	buffered := bufio.NewReader(in)
+	magic, err := buffered.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		reader.decompressor = gz
+		reader.reader = bufio.NewReader(gz)
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		reader.decompressor = decoder.IOReadCloser()
+		reader.reader = bufio.NewReader(decoder)
+	default:
+		reader.reader = buffered
+	}
+
+	if format == "" {
+		if format, err = reader.detectFormat(); err != nil {
+			return nil, err
+		}
+	}
+	if format != FormatNative && format != FormatJSONL {
+		return nil, fmt.Errorf("unknown archive format: %s", format)
+	}
+	reader.format = format
+	reader.decoder = model.NewDecoder(reader.reader)
+	return reader, nil
+}
+
+// detectFormat looks at the first non-blank character in the archive. A JSON
+// object means JSONL format, anything else is considered native format.
+func (r *archiveReader) detectFormat() (string, error) {
+	for i := 1; ; i++ {
+		data, err := r.reader.Peek(i)
+		if len(data) < i {
+			if err == io.EOF {
+				return FormatNative, nil
+			}
+			return "", err
+		}
+		c := data[i-1]
+		if c == ' ' || c == '\n' || c == '\r' || c == '\t' {
+			continue
+		}
+		if c == '{' {
+			return FormatJSONL, nil
+		}
+		return FormatNative, nil
+	}
+}
+
+func (r *archiveReader) Read() (*model.Event, error) {
+	if r.format == FormatJSONL {
+		return r.readJSON()
+	}
+	return r.readNative()
+}
+
+// readLine reads the next non-blank line.
+func (r *archiveReader) readLine() ([]byte, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *archiveReader) readJSON() (*model.Event, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	event := &model.Event{}
+	if err = json.Unmarshal(line, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// readNative decodes the next preamble-framed event.
+func (r *archiveReader) readNative() (*model.Event, error) {
+	event := &model.Event{}
+	if err := r.decoder.Decode(event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func (r *archiveReader) Close() error {
+	var err error
+	if r.decompressor != nil {
+		err = r.decompressor.Close()
+	}
+	if cerr := r.in.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/theia-log/selene/model"
+)
+
+// nopWriteCloser wraps a bytes.Buffer as io.WriteCloser.
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (n nopWriteCloser) Close() error {
+	return nil
+}
+
+func archiveEvents() []*model.Event {
+	return []*model.Event{
+		{ID: "id-1", Timestamp: 1551733035.23, Source: "/src", Tags: []string{"a", "b"}, Content: "first\nmultiline"},
+		{ID: "id-2", Timestamp: 1551733036.5, Source: "/src", Content: "\x00\xffbinary"},
+		{ID: "id-3", Timestamp: 1551733037, Source: "/other", Tags: []string{"c"}, Content: "third"},
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatNative, FormatJSONL} {
+		for _, compression := range []string{CompressNone, CompressGzip, CompressZstd} {
+			var buff bytes.Buffer
+			writer, err := NewArchiveWriter(nopWriteCloser{&buff}, format, compression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, ev := range archiveEvents() {
+				if err = writer.Write(ev); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err = writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			reader, err := NewArchiveReader(ioutil.NopCloser(&buff), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, expected := range archiveEvents() {
+				ev, err := reader.Read()
+				if err != nil {
+					t.Fatalf("%s/%s: event %d: %s", format, compression, i, err.Error())
+				}
+				if ev.ID != expected.ID || ev.Content != expected.Content || ev.Source != expected.Source {
+					t.Fatalf("%s/%s: event %d not read properly: %+v", format, compression, i, ev)
+				}
+			}
+			if _, err = reader.Read(); err != io.EOF {
+				t.Fatalf("%s/%s: expected EOF, got %v", format, compression, err)
+			}
+			if err = reader.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestArchiveReaderInvalid(t *testing.T) {
+	reader, err := NewArchiveReader(ioutil.NopCloser(bytes.NewBufferString("not an event\n")), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = reader.Read(); err == nil {
+		t.Fatal("Expected invalid preamble error.")
+	}
+
+	reader, err = NewArchiveReader(ioutil.NopCloser(bytes.NewBufferString("event:100 90 10\nid:1\n")), FormatNative)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = reader.Read(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("Expected unexpected EOF error, but got %v", err)
+	}
+
+	if _, err = NewArchiveWriter(nopWriteCloser{&bytes.Buffer{}}, "xml", CompressNone); err == nil {
+		t.Fatal("Expected unknown format error.")
+	}
+}
+
+func TestCompressionFromFileName(t *testing.T) {
+	cases := map[string]string{
+		"events.gz":     CompressGzip,
+		"events.jl.zst": CompressZstd,
+		"events":        CompressNone,
+	}
+	for name, expected := range cases {
+		if CompressionFromFileName(name) != expected {
+			t.Fatalf("Expected %s compression for %s", expected, name)
+		}
+	}
+}
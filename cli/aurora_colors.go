@@ -123,30 +123,51 @@ func (a *AuroraColors) ColoredText(ctx Context, text string) string {
 // colors.
 // The colors of the tags are random.
 func (a *AuroraColors) ColoredTag(ctx Context, tag string) string {
-	knownType := KnownTypes.Detect(tag)
-	if knownType != "" {
-		ctx["color"] = knownType
-	} else {
+	if KnownTypes.Detect(tag) == "" {
 		tag = strings.ToLower(tag)
-		if knownColor, ok := a.knownTags[tag]; ok {
-			ctx["color"] = knownColor
-		} else {
-			color := a.newTagColor()
-			a.knownTags[tag] = color
-			ctx["color"] = color
-		}
 	}
+	ctx["color"] = a.TagColor(tag)
 	return a.ColoredText(ctx, tag)
 }
 
 // ColoredContent colors a content text.
 func (a *AuroraColors) ColoredContent(ctx Context, content string) string {
-	if knownType := KnownTypes.Detect(content); knownType != "" {
-		ctx["color"] = knownType
+	if color := a.ContentColor(content); color != "" {
+		ctx["color"] = color
 	}
 	return a.ColoredText(ctx, content)
 }
 
+// TagColor returns the name of the palette color assigned to the given tag.
+// Tags that match a known type (error, warning etc) get the color of that
+// type. Every other tag is assigned a color on first use, and keeps that color
+// for the lifetime of this AuroraColors.
+func (a *AuroraColors) TagColor(tag string) string {
+	if knownType := KnownTypes.Detect(tag); knownType != "" {
+		return knownType
+	}
+	tag = strings.ToLower(tag)
+	if knownColor, ok := a.knownTags[tag]; ok {
+		return knownColor
+	}
+	color := a.newTagColor()
+	a.knownTags[tag] = color
+	return color
+}
+
+// ContentColor returns the name of the palette color for the given event
+// content, based on the KnownTypes heuristics. Returns an empty string if the
+// content does not match any of the known types.
+func (a *AuroraColors) ContentColor(content string) string {
+	return KnownTypes.Detect(content)
+}
+
+// PaletteColor looks up a color by name in the underlying palette.
+func (a *AuroraColors) PaletteColor(name string) (aurora.Color, bool) {
+	color, ok := a.palette[name]
+	return color, ok
+}
+
 func (a *AuroraColors) newTagColor() string {
 	if len(a.availableColors) == 0 {
 		a.availableColors = RandTagColors()
@@ -182,6 +203,7 @@ var defaultPalette map[string]aurora.Color = map[string]aurora.Color{
 	"primary":   aurora.BlackBg | aurora.BlueFg,
 	"secondary": aurora.BlackBg | aurora.GrayFg,
 	"success":   aurora.GreenFg,
+	"highlight": aurora.BrownBg | aurora.BlackFg | aurora.BoldFm,
 	// color names
 	"black":   aurora.BlackFg,
 	"red":     aurora.RedFg,
@@ -195,6 +217,11 @@ var defaultPalette map[string]aurora.Color = map[string]aurora.Color{
 
 // NewAuroraColors builds new Colors.
 func NewAuroraColors() Colors {
+	return newAuroraColors()
+}
+
+// newAuroraColors builds new AuroraColors with the default palette.
+func newAuroraColors() *AuroraColors {
 	return &AuroraColors{
 		aur:             aurora.NewAurora(true),
 		availableColors: RandTagColors(),
@@ -11,8 +11,6 @@ import (
 	"unicode"
 
 	"github.com/theia-log/selene/comm"
-
-	uuid "github.com/satori/go.uuid"
 	"github.com/theia-log/selene/model"
 )
 
@@ -30,37 +28,57 @@ func EventCommand(args []string) error {
 // RunEventGenerator generates new event with the given properties and sends it
 // to the Theia server.
 func RunEventGenerator(flags *EventFlags) error {
+	fields, err := parseFields(flags.Fields)
+	if err != nil {
+		return err
+	}
 	eventTemplate := &model.Event{
 		ID:      asString(flags.ID),
 		Source:  asString(flags.Source),
 		Content: asString(flags.Content),
 		Tags:    flags.Tags,
+		Fields:  fields,
 	}
 
 	serverURL, err := flags.GetServerURL()
 	if err != nil {
 		return err
 	}
+	newClient, err := flags.ClientFactory()
+	if err != nil {
+		return err
+	}
 
-	client := comm.NewWebsocketClient(serverURL)
+	ids, err := model.NewIDGenerator(asString(flags.IDStrategy))
+	if err != nil {
+		return err
+	}
+
+	client, err := newPublishClient(serverURL, flags.PublishFlags, newClient)
+	if err != nil {
+		return err
+	}
 
 	if flags.FromStdin != nil && (*flags.FromStdin) == true {
-		return readFromStdinAndSend(eventTemplate, flags, client)
+		return readFromStdinAndSend(eventTemplate, flags, client, ids)
 	}
 
-	return sendOneAndExit(eventTemplate, flags, client)
+	return sendOneAndExit(eventTemplate, flags, client, ids)
 }
 
-func sendOneAndExit(template *model.Event, flags *EventFlags, client comm.Client) error {
+func sendOneAndExit(template *model.Event, flags *EventFlags, client comm.Client, ids model.IDGenerator) error {
 	event := newFromTemplate(template)
 	event.Content = ""
 	if flags.Content != nil {
 		event.Content = *flags.Content
 	}
+	if event.ID == "" {
+		event.ID = ids.NewID(event, -1)
+	}
 	return client.Send(event)
 }
 
-func readFromStdinAndSend(template *model.Event, flags *EventFlags, client comm.Client) error {
+func readFromStdinAndSend(template *model.Event, flags *EventFlags, client comm.Client, ids model.IDGenerator) error {
 	reader := bufio.NewReader(os.Stdin)
 
 	sep := "\n"
@@ -68,6 +86,7 @@ func readFromStdinAndSend(template *model.Event, flags *EventFlags, client comm.
 		sep = *flags.Separator
 	}
 
+	var offset int64
 	for {
 		content, err := reader.ReadString(sep[0])
 		eof := false
@@ -92,6 +111,10 @@ func readFromStdinAndSend(template *model.Event, flags *EventFlags, client comm.
 
 		event := newFromTemplate(template)
 		event.Content = content
+		if event.ID == "" {
+			event.ID = ids.NewID(event, offset)
+		}
+		offset += int64(len(content))
 		if err = client.Send(event); err != nil {
 			return err
 		}
@@ -103,6 +126,38 @@ func readFromStdinAndSend(template *model.Event, flags *EventFlags, client comm.
 	return nil
 }
 
+// parseFields parses the fields given as key=value pairs.
+func parseFields(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	fields := map[string]string{}
+	for _, value := range values {
+		sep := strings.Index(value, "=")
+		if sep < 0 {
+			return nil, fmt.Errorf("invalid field %q: expected key=value", value)
+		}
+		key := value[:sep]
+		if err := model.ValidateFieldKey(key); err != nil {
+			return nil, err
+		}
+		fields[key] = value[sep+1:]
+	}
+	return fields, nil
+}
+
+// copyFields makes a copy of the fields map, so every event gets its own.
+func copyFields(fields map[string]string) map[string]string {
+	if fields == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(fields))
+	for key, value := range fields {
+		copied[key] = value
+	}
+	return copied
+}
+
 func asString(str *string) string {
 	if str == nil {
 		return ""
@@ -130,10 +185,7 @@ func newFromTemplate(template *model.Event) *model.Event {
 		Source:    template.Source,
 		Tags:      template.Tags,
 		Timestamp: template.Timestamp,
-	}
-
-	if ev.ID == "" {
-		ev.ID = uuid.Must(uuid.NewV4()).String()
+		Fields:    copyFields(template.Fields),
 	}
 
 	if ev.Timestamp == 0.0 {
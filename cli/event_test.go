@@ -5,6 +5,8 @@ import (
 	"regexp"
 	"testing"
 	"time"
+
+	"github.com/theia-log/selene/model"
 )
 
 func currentTimeMillis() float64 {
@@ -146,3 +148,34 @@ func TestParseTime_manualString(t *testing.T) {
 	testString("-2yr", -2*1000*60*60*24*365.0, 100.0)
 	testString("-3years", -3*1000*60*60*24*365.0, 100.0)
 }
+
+func TestParseFields(t *testing.T) {
+	fields, err := parseFields([]string{"user=jdoe", "query=a=b", "empty="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"user": "jdoe", "query": "a=b", "empty": ""}
+	if len(fields) != len(expected) {
+		t.Fatalf("Expected %v but got %v", expected, fields)
+	}
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Fatalf("Expected %v but got %v", expected, fields)
+		}
+	}
+
+	for _, invalid := range []string{"novalue", "=value", "id=1", "a b=c"} {
+		if _, err = parseFields([]string{invalid}); err == nil {
+			t.Fatalf("Expected error for field %q", invalid)
+		}
+	}
+}
+
+func TestNewFromTemplate_fields(t *testing.T) {
+	template := &model.Event{Fields: map[string]string{"user": "jdoe"}}
+	ev := newFromTemplate(template)
+	ev.Fields["user"] = "changed"
+	if template.Fields["user"] != "jdoe" {
+		t.Fatal("Events must not share the fields with the template.")
+	}
+}
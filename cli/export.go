@@ -0,0 +1,346 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+)
+
+// ExportCommand implements the 'export' subcommand.
+// Takes a list of arguments to the export subcommand, parses it and then calls
+// RunExport with the parsed flags.
+func ExportCommand(args []string) error {
+	exportFlags, flags := SetupExportFlags()
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return RunExport(exportFlags)
+}
+
+// RunExport looks up the past events that match the filter flags and writes
+// them to an archive file. The events are written as they arrive.
+// The export fails if the stream of events breaks before the server ends it,
+// and the partial archive file is removed.
+func RunExport(flags *ExportFlags) error {
+	serverURL, err := flags.GetServerURL()
+	if err != nil {
+		return err
+	}
+	newClient, err := flags.ClientFactory()
+	if err != nil {
+		return err
+	}
+	filter, err := toQueryFilter(flags.QueryFlags)
+	if err != nil {
+		return err
+	}
+	match, err := newResponseMatcher(flags.QueryFlags, filter)
+	if err != nil {
+		return err
+	}
+
+	output := asString(flags.Output)
+	if output == "" {
+		return fmt.Errorf("no output file")
+	}
+	compression := asString(flags.Compression)
+	if compression == "" {
+		compression = CompressionFromFileName(output)
+	}
+
+	var out io.WriteCloser = os.Stdout
+	if output != "-" {
+		if out, err = os.Create(output); err != nil {
+			return err
+		}
+	}
+	archive, err := NewArchiveWriter(out, asString(flags.Format), compression)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	removeOutput := func() {
+		if output != "-" {
+			os.Remove(output)
+		}
+	}
+	fail := func(err error) error {
+		archive.Close()
+		removeOutput()
+		return err
+	}
+
+	client := newClient(serverURL)
+	resp, err := client.Find(filter)
+	if err != nil {
+		return fail(err)
+	}
+
+	count := 0
+	matched := match(resp)
+	for event := range matched {
+		if event.Error != nil {
+			if comm.IsStreamEnd(event.Error) {
+				continue
+			}
+			abortStream(client, matched)
+			return fail(event.Error)
+		}
+		if err = archive.Write(event.Event); err != nil {
+			abortStream(client, matched)
+			return fail(err)
+		}
+		count++
+	}
+
+	if err = archive.Close(); err != nil {
+		removeOutput()
+		return err
+	}
+	if isSet(flags.Verbose) {
+		log.Printf("Exported %d events.\n", count)
+	}
+	return nil
+}
+
+// ImportCommand implements the 'import' subcommand.
+// Takes a list of arguments to the import subcommand, parses it and then calls
+// RunImport with the parsed flags.
+func ImportCommand(args []string) error {
+	importFlags, flags := SetupImportFlags()
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return RunImport(importFlags)
+}
+
+// importProgress is the saved progress of an import. It is used to resume an
+// interrupted import of a large archive.
+type importProgress struct {
+	// Input is the archive file being imported.
+	Input string `json:"input"`
+
+	// Events is the number of events read from the archive and already sent.
+	Events int `json:"events"`
+}
+
+// loadProgress loads the import progress from the progress file. If the file
+// does not exist, empty progress is returned.
+func loadProgress(progressFile, input string) (*importProgress, error) {
+	progress := &importProgress{Input: input}
+	data, err := ioutil.ReadFile(progressFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return progress, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(data, progress); err != nil {
+		return nil, err
+	}
+	if progress.Input != input {
+		return nil, fmt.Errorf("progress file %s belongs to another import: %s", progressFile, progress.Input)
+	}
+	return progress, nil
+}
+
+// save writes the progress to the progress file. The progress is written to
+// a temporary file first, so the progress file is never left half written.
+func (p *importProgress) save(progressFile string) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	tmpFile := progressFile + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, progressFile)
+}
+
+// batchSender is a client that sends multiple events in a single request.
+type batchSender interface {
+	SendBatch(events []*model.Event) error
+}
+
+// sendEvents sends the events in a single request if the client supports it,
+// or one by one otherwise. Returns the number of events that were delivered.
+func sendEvents(client comm.Client, events []*model.Event) (int, error) {
+	if batcher, ok := client.(batchSender); ok {
+		// either all or none of the events are stored
+		if err := batcher.SendBatch(events); err != nil {
+			return 0, err
+		}
+		return len(events), nil
+	}
+	for i, event := range events {
+		if err := client.Send(event); err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+// rateLimiter delays the callers so that at most rate events per second pass.
+type rateLimiter struct {
+	rate  float64
+	start time.Time
+	count int
+}
+
+// Wait blocks until the next n events are allowed to pass, that is until the
+// last of them is allowed.
+func (r *rateLimiter) Wait(n int) {
+	if r.rate <= 0 || n <= 0 {
+		return
+	}
+	if r.count == 0 {
+		r.start = time.Now()
+	}
+	next := r.start.Add(time.Duration(float64(r.count+n-1) / r.rate * float64(time.Second)))
+	if wait := time.Until(next); wait > 0 {
+		time.Sleep(wait)
+	}
+	r.count += n
+}
+
+// RunImport reads the events from an archive and sends them to the server.
+// The events are sent in batches: in a single request if the client supports
+// it (HTTP), one by one otherwise. After every batch, and when sending fails,
+// the progress is saved in the progress file, so an interrupted import can be
+// resumed. Once the import completes, the progress file is removed.
+func RunImport(flags *ImportFlags) error {
+	input := asString(flags.Input)
+	if input == "" {
+		return fmt.Errorf("no input file")
+	}
+	batchSize := 100
+	if flags.Batch != nil && *flags.Batch > 0 {
+		batchSize = *flags.Batch
+	}
+	dryRun := isSet(flags.DryRun)
+
+	progressFile := asString(flags.Progress)
+	if progressFile == "" && input != "-" {
+		progressFile = input + ".progress"
+	}
+	progress := &importProgress{Input: input}
+	if isSet(flags.Resume) {
+		if progressFile == "" {
+			return fmt.Errorf("cannot resume import without progress file")
+		}
+		var err error
+		if progress, err = loadProgress(progressFile, input); err != nil {
+			return err
+		}
+	}
+
+	var in io.ReadCloser = os.Stdin
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		in = file
+	}
+	archive, err := NewArchiveReader(in, asString(flags.Format))
+	if err != nil {
+		in.Close()
+		return err
+	}
+	defer archive.Close()
+
+	var client comm.Client
+	if !dryRun {
+		serverURL, err := flags.GetServerURL()
+		if err != nil {
+			return err
+		}
+		newClient, err := flags.ClientFactory()
+		if err != nil {
+			return err
+		}
+		client = newClient(serverURL)
+	}
+
+	limiter := &rateLimiter{}
+	if flags.Rate != nil {
+		limiter.rate = *flags.Rate
+	}
+	keepIDs := !isSet(flags.NewIDs)
+	imported := progress.Events
+	read, sent := 0, 0
+
+	// send sends the batch, within the rate limit, and saves the progress of
+	// the events that were delivered, also when sending fails
+	batch := make([]*model.Event, 0, batchSize)
+	send := func() error {
+		limiter.Wait(len(batch))
+		delivered, err := sendEvents(client, batch)
+		batch = batch[:0]
+		sent += delivered
+		progress.Events += delivered
+		if progressFile != "" {
+			if saveErr := progress.save(progressFile); err == nil {
+				err = saveErr
+			}
+		}
+		return err
+	}
+
+	for {
+		event, err := archive.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("event %d: %s", read+1, err.Error())
+		}
+		read++
+		if read <= imported {
+			// already imported
+			continue
+		}
+		if !keepIDs {
+			event.ID = model.NewEventID()
+		}
+		if dryRun {
+			if isSet(flags.Verbose) {
+				fmt.Printf("%s %f %s %v\n", event.ID, event.Timestamp, event.Source, event.Tags)
+			}
+			sent++
+			continue
+		}
+		batch = append(batch, event)
+		if len(batch) == batchSize {
+			if err = send(); err != nil {
+				return err
+			}
+		}
+	}
+	if !dryRun && len(batch) > 0 {
+		if err = send(); err != nil {
+			return err
+		}
+	}
+
+	if !dryRun && progressFile != "" {
+		if err = os.Remove(progressFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if dryRun {
+		fmt.Printf("Dry run: %d events would be imported (%d skipped).\n", sent, read-sent)
+	} else if isSet(flags.Verbose) {
+		log.Printf("Imported %d events (%d skipped).\n", sent, read-sent)
+	}
+	return nil
+}
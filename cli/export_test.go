@@ -0,0 +1,260 @@
+package cli
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+	"github.com/theia-log/selene/theiatest"
+)
+
+func writeTestArchive(t *testing.T, fileName string, events []*model.Event) {
+	out, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := NewArchiveWriter(out, FormatNative, CompressionFromFileName(fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		if err = archive.Write(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExportCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selene-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := theiatest.NewServer()
+	defer server.Close()
+	server.Add(archiveEvents()...)
+
+	output := filepath.Join(dir, "events.jl.gz")
+	err = ExportCommand([]string{"-server", server.URL,
+		"-s", "100.1",
+		"-c", "first",
+		"-format", FormatJSONL,
+		"-o", output,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := NewArchiveReader(in, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	exported, err := archive.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := archiveEvents()[0]
+	if exported.ID != event.ID || exported.Content != event.Content {
+		t.Fatalf("Event not exported properly: %+v", exported)
+	}
+	if _, err = archive.Read(); err != io.EOF {
+		t.Fatalf("Expected only the matching event, but got %v", err)
+	}
+}
+
+func TestExportCommand_droppedStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selene-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data, err := archiveEvents()[0].DumpBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the connection breaks after the first event
+	mock := comm.NewWebsocketMock().
+		Expect("{\"start\":100.1}").
+		Respond(string(data))
+	done := make(chan bool)
+	go func() {
+		mock.WaitRequestsToComplete(1)
+		time.Sleep(100 * time.Millisecond)
+		mock.Terminate()
+		done <- true
+	}()
+
+	output := filepath.Join(dir, "events")
+	err = ExportCommand([]string{"-server", mock.MockURL, "-s", "100.1", "-o", output})
+	<-done
+	for _, e := range mock.Errors {
+		t.Fatal(e.Error())
+	}
+	if _, ok := err.(*comm.TransportError); !ok {
+		t.Fatalf("Expected the broken stream to fail the export, but got %v", err)
+	}
+	if _, err = os.Stat(output); !os.IsNotExist(err) {
+		t.Fatal("Expected the partial archive to be removed.")
+	}
+}
+
+func TestImportCommand_dryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selene-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "events.zst")
+	writeTestArchive(t, input, archiveEvents())
+
+	if err = ImportCommand([]string{"-f", input, "-dry-run"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(input + ".progress"); !os.IsNotExist(err) {
+		t.Fatal("Dry run must not write progress file.")
+	}
+}
+
+func TestImportCommand_resume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selene-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	events := archiveEvents()
+	input := filepath.Join(dir, "events")
+	writeTestArchive(t, input, events)
+
+	progress := &importProgress{Input: input, Events: len(events) - 1}
+	progressFile := input + ".progress"
+	if err = progress.save(progressFile); err != nil {
+		t.Fatal(err)
+	}
+
+	last, err := events[len(events)-1].Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := comm.NewWebsocketMock().Expect(last)
+	done := make(chan bool)
+	go func() {
+		mock.WaitRequestsToComplete(1)
+		mock.Terminate()
+		done <- true
+	}()
+
+	if err = ImportCommand([]string{"-server", mock.MockURL, "-f", input, "-resume"}); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	for _, e := range mock.Errors {
+		t.Fatal(e.Error())
+	}
+	if _, err = os.Stat(progressFile); !os.IsNotExist(err) {
+		t.Fatal("Progress file must be removed after the import completes.")
+	}
+}
+
+func TestImportCommand_httpBatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selene-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "events")
+	writeTestArchive(t, input, archiveEvents())
+
+	// the server stores the first batch and fails on the second one
+	batches := []int{}
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		count := 0
+		decoder := model.NewDecoder(req.Body)
+		for decoder.Decode(&model.Event{}) == nil {
+			count++
+		}
+		batches = append(batches, count)
+		if fail && len(batches) == 2 {
+			http.Error(resp, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		resp.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	args := []string{"-server", server.URL, "-f", input, "-batch", "2"}
+	if err = ImportCommand(args); err == nil {
+		t.Fatal("Expected the import to fail.")
+	}
+	progress, err := loadProgress(input+".progress", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Events != 2 {
+		t.Fatalf("Expected progress of the delivered batch, but got %d", progress.Events)
+	}
+
+	fail = false
+	if err = ImportCommand(append(args, "-resume")); err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 3 || batches[0] != 2 || batches[2] != 1 {
+		t.Fatalf("Expected batches of 2 and the rest, but got %v", batches)
+	}
+}
+
+func TestImportCommand_foreignProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selene-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "events")
+	writeTestArchive(t, input, archiveEvents())
+	progress := &importProgress{Input: "other", Events: 1}
+	if err = progress.save(input + ".progress"); err != nil {
+		t.Fatal(err)
+	}
+	if err = ImportCommand([]string{"-f", input, "-resume", "-dry-run"}); err == nil {
+		t.Fatal("Expected error for progress file of another import.")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := &rateLimiter{rate: 100}
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		limiter.Wait(1)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("Expected rate to be limited, but took only %s", elapsed)
+	}
+
+	// a batch passes once its last event is allowed
+	limiter = &rateLimiter{rate: 100}
+	start = time.Now()
+	limiter.Wait(6)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("Expected the batch to be limited, but took only %s", elapsed)
+	}
+}
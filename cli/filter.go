@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"regexp"
+
+	"github.com/theia-log/selene/model"
+)
+
+// PostFilter holds the client-side filters that are applied on the events
+// received from the server, before the events are printed.
+// Theia matches only by time, tags and content, so everything else (the source,
+// negative matches) must be evaluated on the client side.
+type PostFilter struct {
+	// Source is a pattern that the event source must match.
+	Source *regexp.Regexp
+
+	// NotTags is a list of patterns that must not match any of the event tags.
+	NotTags []*regexp.Regexp
+
+	// NotContent is a pattern that must not match the event content.
+	NotContent *regexp.Regexp
+}
+
+// compilePattern compiles the regular expression, optionally as case
+// insensitive.
+func compilePattern(pattern string, ignoreCase bool) (*regexp.Regexp, error) {
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// NewPostFilter builds a PostFilter from the query flags.
+// Returns an error if any of the patterns is not a valid regular expression.
+func NewPostFilter(flags *QueryFlags) (*PostFilter, error) {
+	ignoreCase := flags.IgnoreCase != nil && *flags.IgnoreCase
+	filter := &PostFilter{}
+
+	if source := valueOrNil(flags.Source); source != nil {
+		re, err := compilePattern(*source, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		filter.Source = re
+	}
+
+	for _, tag := range flags.NotTags {
+		re, err := compilePattern(tag, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		filter.NotTags = append(filter.NotTags, re)
+	}
+
+	if content := valueOrNil(flags.NotContent); content != nil {
+		re, err := compilePattern(*content, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		filter.NotContent = re
+	}
+
+	return filter, nil
+}
+
+// IsEmpty returns true if there are no client-side conditions set.
+func (p *PostFilter) IsEmpty() bool {
+	return p.Source == nil && len(p.NotTags) == 0 && p.NotContent == nil
+}
+
+// Match checks if the event passes all client-side conditions.
+func (p *PostFilter) Match(event *model.Event) bool {
+	if p.Source != nil && !p.Source.MatchString(event.Source) {
+		return false
+	}
+	for _, notTag := range p.NotTags {
+		for _, tag := range event.Tags {
+			if notTag.MatchString(tag) {
+				return false
+			}
+		}
+	}
+	if p.NotContent != nil && p.NotContent.MatchString(event.Content) {
+		return false
+	}
+	return true
+}
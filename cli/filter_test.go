@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/theia-log/selene/model"
+)
+
+func TestPostFilterMatch(t *testing.T) {
+	qf, fs := SetupQueryFlags()
+	if err := fs.Parse([]string{"-source", "^api", "-not-t", "debug", "-not-c", "heartbeat", "-i"}); err != nil {
+		t.Fatal(err)
+	}
+	filter, err := NewPostFilter(qf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.IsEmpty() {
+		t.Fatal("Expected the post filter to have conditions.")
+	}
+
+	cases := []struct {
+		event    *model.Event
+		expected bool
+	}{
+		{&model.Event{Source: "api-1", Tags: []string{"db"}, Content: "timeout"}, true},
+		{&model.Event{Source: "API-2", Content: "timeout"}, true},
+		{&model.Event{Source: "web", Content: "timeout"}, false},
+		{&model.Event{Source: "api-1", Tags: []string{"db", "DEBUG"}, Content: "timeout"}, false},
+		{&model.Event{Source: "api-1", Content: "HeartBeat received"}, false},
+	}
+
+	for i, c := range cases {
+		if filter.Match(c.event) != c.expected {
+			t.Fatalf("Case %d: expected match to be %v", i, c.expected)
+		}
+	}
+}
+
+func TestNewPostFilterInvalidPattern(t *testing.T) {
+	qf, fs := SetupQueryFlags()
+	if err := fs.Parse([]string{"-not-t", "("}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPostFilter(qf); err == nil {
+		t.Fatal("Expected to fail on invalid regular expression.")
+	}
+}
+
+func TestToQueryFilterIgnoreCase(t *testing.T) {
+	qf, fs := SetupQueryFlags()
+	if err := fs.Parse([]string{"-t", "db", "-c", "timeout", "-i"}); err != nil {
+		t.Fatal(err)
+	}
+	filter, err := toQueryFilter(qf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Content == nil || *filter.Content != "(?i)timeout" {
+		t.Fatal("Expected the content pattern to be case insensitive.")
+	}
+	if len(filter.Tags) != 1 || filter.Tags[0] != "(?i)db" {
+		t.Fatal("Expected the tag patterns to be case insensitive.")
+	}
+	if qf.Tags[0] != "db" {
+		t.Fatal("Expected the flags to stay unchanged.")
+	}
+}
+
+// markerColors wraps the colored text in markers with the color name.
+type markerColors struct{}
+
+func (m *markerColors) ColoredText(ctx Context, text string) string {
+	if text == "" {
+		return ""
+	}
+	return fmt.Sprintf("<%s>%s</>", ctx.GetString("color"), text)
+}
+
+func (m *markerColors) ColoredTag(ctx Context, tag string) string {
+	return m.ColoredText(ctx, tag)
+}
+
+func (m *markerColors) ColoredContent(ctx Context, content string) string {
+	return m.ColoredText(ctx, content)
+}
+
+func TestHighlightText(t *testing.T) {
+	highlighted := highlightText(&markerColors{}, "info", "a timeout and another timeout!", regexp.MustCompile("time\\w+"))
+	expected := "<info>a </><highlight>timeout</><info> and another </><highlight>timeout</><info>!</>"
+	if highlighted != expected {
+		t.Fatalf("Expected '%s' but got '%s'", expected, highlighted)
+	}
+}
@@ -3,7 +3,12 @@ package cli
 import (
 	"flag"
 	"fmt"
+	"net/url"
 	"strings"
+	"time"
+
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
 )
 
 // StringNVar implements the flag.Value interface for flags that can hold
@@ -13,7 +18,10 @@ type StringNVar []string
 // GlobalFlags holds the parsed values for the global flags. These flags are
 // shared (common) between all subcommands like watch, query and event.
 type GlobalFlags struct {
-	// ServerURL is the full URL to the theia server. It is a websocket URL.
+	// ServerURL is the full URL to the theia server. It is a websocket URL
+	// (ws:// or wss://), or an HTTP URL (http:// or https://) for the servers
+	// that are reachable only over plain HTTP, or unix:// followed by the
+	// socket path for a local server.
 	ServerURL *string
 
 	// Verbose is a flag for verbose output. If set, selene should provide
@@ -27,6 +35,13 @@ type GlobalFlags struct {
 	// Port is the theia port. This is the port part of the server URL.
 	// Either host and port must be given, or a full ServerURL.
 	Port *int
+
+	// Proxy is the URL of the HTTP (http://) or SOCKS5 (socks5://) proxy to
+	// connect through. If not set, the proxy is taken from the environment.
+	Proxy *string
+
+	// DialTimeout is the time limit for connecting to the server.
+	DialTimeout *time.Duration
 }
 
 // QueryFlags holds the parsed values for subcommand 'query'.
@@ -54,18 +69,84 @@ type QueryFlags struct {
 
 	// Live is a flag to indicate whether to query live (real-time) events.
 	Live *bool
+
+	// Source is a regular expression to match the event source. Matched on
+	// the client side.
+	Source *string
+
+	// NotTags is a list of tags that must not be present on the event. The
+	// values may be a regular expression. Matched on the client side.
+	NotTags StringNVar
+
+	// NotContent is a regular expression that must not match the event
+	// content. Matched on the client side.
+	NotContent *string
+
+	// IgnoreCase is a flag to match all patterns case insensitive.
+	IgnoreCase *bool
+
+	// Highlight is a regular expression. The matching parts of the event
+	// content and source are highlighted in the output.
+	Highlight *string
+
+	// Query is a query string in the selene query language. It is combined
+	// with the other filter flags.
+	Query *string
+
+	// Limit is the maximal number of events to return. If Follow is set, this
+	// is the number of the last past events to show before following.
+	Limit *int
+
+	// Skip is the number of matching events to skip before returning events.
+	// Used together with Limit to page through the past events.
+	Skip *int
+
+	// Follow is a flag to look up the past events and then keep receiving the
+	// real-time events.
+	Follow *bool
+
+	// Dedup is a flag to skip the events that were already received (with the
+	// same ID).
+	Dedup *bool
+
+	// DedupSize is the number of the last event IDs remembered for
+	// deduplication.
+	DedupSize *int
+
+	// DedupWindow is for how long an event ID is remembered for
+	// deduplication. Zero means that only DedupSize limits the IDs.
+	DedupWindow *time.Duration
+}
+
+// PublishFlags holds the flags for publishing the events to multiple Theia
+// servers. These flags are shared between the commands that send events, like
+// event and watch.
+type PublishFlags struct {
+	// Replicas are the URLs of additional Theia servers.
+	Replicas StringNVar
+
+	// FanOut is the mode of publishing to the server and the replicas:
+	// replicate (to all) or failover (to the first that is up).
+	FanOut *string
+
+	// Routes are the routing rules in the form <tag|source|content>:<pattern>=<url>.
+	// The events that match a rule are sent to the rule server only.
+	Routes StringNVar
 }
 
 type EventFlags struct {
 	*GlobalFlags
+	*PublishFlags
 	ID           *string
 	Source       *string
 	Time         *string
 	Tags         StringNVar
+	Fields       StringNVar
 	Content      *string
 	Separator    *string
 	EofSeparator *string
 	FromStdin    *bool
+	IDStrategy   *string
 }
 
 // WatcherFlags holds the parsed values for the subcommand 'watch'.
@@ -73,12 +154,142 @@ type EventFlags struct {
 // command.
 type WatcherFlags struct {
 	*GlobalFlags
+	*PublishFlags
 
 	// File is the path of the file to be watched for changes.
 	File *string
 
 	// Tags is a list of tags to be attached to the generated events.
 	Tags StringNVar
+
+	// Fields is a list of key=value fields to be attached to the generated
+	// events.
+	Fields StringNVar
+
+	// Extract is a regular expression with named groups. The values matched
+	// by the named groups are attached to the generated events as fields.
+	Extract *string
+
+	// MaxSize is the maximal size of the event content, in bytes. Larger
+	// changes are split into multiple events, or truncated.
+	MaxSize *int
+
+	// Truncate, if set, truncates the changes larger than MaxSize instead of
+	// splitting them into multiple events.
+	Truncate *bool
+
+	// IDStrategy is the strategy for generating event IDs: random, time or
+	// hash.
+	IDStrategy *string
+}
+
+// TUIFlags holds the parsed values for the subcommand 'tui'.
+// The terminal UI shares the filter flags with the query command, and adds
+// flags specific to the interactive view.
+type TUIFlags struct {
+	*QueryFlags
+
+	// Limit is the maximal number of events kept in the view. When the limit
+	// is reached, the oldest events are discarded.
+	Limit *int
+}
+
+// StatsFlags holds the parsed values for the subcommand 'stats'.
+// The stats command shares the filter flags with the query command, and adds
+// flags for grouping and formatting the statistics.
+type StatsFlags struct {
+	*QueryFlags
+
+	// GroupBy is a comma separated list of groups to report counts for:
+	// tag, source and time.
+	GroupBy *string
+
+	// Bucket is the size of the time bucket for the time group.
+	Bucket *time.Duration
+
+	// Top is the number of most common content patterns to report.
+	Top *int
+
+	// Format is the output format: table or json.
+	Format *string
+}
+
+// ExportFlags holds the parsed values for the subcommand 'export'.
+// The export command shares the filter flags with the query command.
+type ExportFlags struct {
+	*QueryFlags
+
+	// Output is the archive file to write the events to. "-" means STDOUT.
+	Output *string
+
+	// Format is the archive format: native or jsonl.
+	Format *string
+
+	// Compression is the compression algorithm: none, gzip or zstd. If not
+	// set, it is guessed from the output file extension.
+	Compression *string
+}
+
+// ImportFlags holds the parsed values for the subcommand 'import'.
+type ImportFlags struct {
+	*GlobalFlags
+
+	// Input is the archive file to read the events from. "-" means STDIN.
+	Input *string
+
+	// Format is the archive format. If not set, it is detected from the
+	// archive content.
+	Format *string
+
+	// Batch is the number of events sent in a batch, between two progress
+	// checkpoints.
+	Batch *int
+
+	// Rate is the maximal number of events sent per second. Zero means no
+	// limit.
+	Rate *float64
+
+	// NewIDs is a flag to generate new IDs for the imported events instead
+	// of preserving the original IDs.
+	NewIDs *bool
+
+	// DryRun is a flag to only read and validate the archive, without
+	// sending the events.
+	DryRun *bool
+
+	// Resume is a flag to resume an interrupted import from the progress
+	// file.
+	Resume *bool
+
+	// Progress is the file where the import progress is saved. Defaults to
+	// the input file name with ".progress" suffix.
+	Progress *string
+}
+
+// ServeFlags holds the parsed values for the subcommand 'serve'.
+type ServeFlags struct {
+	// Addr is the address (host:port) to listen on, or unix:// followed by
+	// the socket path.
+	Addr *string
+
+	// File is the file in which the events are stored. If empty, the events
+	// are kept in memory only.
+	File *string
+
+	// Dir is the directory of a segmented event store. If set, it is used
+	// instead of File.
+	Dir *string
+
+	// RetainSize is the maximal size of the store in Dir, in bytes. Zero
+	// means no limit.
+	RetainSize *int64
+
+	// RetainAge is how long the events are kept in the store in Dir. Zero
+	// means no limit.
+	RetainAge *time.Duration
+
+	// Verbose is a flag for verbose output.
+	Verbose *bool
 }
 
 // SetupQueryFlags creates a FlagSet for parsing the 'query' subcommand and
@@ -88,6 +299,7 @@ func SetupQueryFlags() (*QueryFlags, *flag.FlagSet) {
 	queryFlags := &QueryFlags{
 		GlobalFlags: SetupGlobalFlagsOn(flags),
 		Tags:        StringNVar{},
+		NotTags:     StringNVar{},
 	}
 
 	queryFlags.Start = flags.Float64("s", 0.0, "Start timestamp")
@@ -95,23 +307,148 @@ func SetupQueryFlags() (*QueryFlags, *flag.FlagSet) {
 	queryFlags.Content = flags.String("c", "", "Match event content (regular expression)")
 	queryFlags.Order = flags.String("sort", "", "Sort order (only if not live). Possible values are asc or desc.")
 	queryFlags.Live = flags.Bool("live", false, "Whether to query for live events in real time.")
+	queryFlags.Source = flags.String("source", "", "Match event source (regular expression).")
+	queryFlags.NotContent = flags.String("not-c", "", "Skip events with content matching this regular expression.")
+	queryFlags.IgnoreCase = flags.Bool("i", false, "Match tags, content and source case insensitive.")
+	queryFlags.Highlight = flags.String("highlight", "", "Highlight the parts of the content matching this regular expression.")
+	queryFlags.Limit = flags.Int("n", 0, "Maximal number of events to return. With -follow, the number of last past events to show.")
+	flags.IntVar(queryFlags.Limit, "limit", 0, "Same as -n.")
+	queryFlags.Skip = flags.Int("skip", 0, "Number of matching events to skip (for paging through past events).")
+	queryFlags.Follow = flags.Bool("follow", false, "Look up the past events, then keep receiving the live events.")
+	queryFlags.Dedup = flags.Bool("dedup", false, "Skip the events with the same ID as an already received event.")
+	queryFlags.DedupSize = flags.Int("dedup-size", comm.DefaultDedupSize, "Number of the last event IDs remembered for -dedup.")
+	queryFlags.DedupWindow = flags.Duration("dedup-window", 0, "How long to remember the event IDs for -dedup. Zero means no time limit.")
+	queryFlags.Query = flags.String("q", "", "Query string, for example: tag:db AND (content:/timeout/ OR source:api*) AND time>-1h")
 
 	flags.Var(&queryFlags.Tags, "t", "Match if any tag with this value (regular expression).")
+	flags.Var(&queryFlags.NotTags, "not-t", "Skip events with any tag matching this value (regular expression).")
 
 	return queryFlags, flags
 }
 
+// SetupTUIFlags creates a FlagSet for parsing the 'tui' subcommand and creates
+// a wrapper TUIFlags to hold the parsed values from the command line.
+func SetupTUIFlags() (*TUIFlags, *flag.FlagSet) {
+	flags := flag.NewFlagSet("tui", flag.ExitOnError)
+	tuiFlags := &TUIFlags{
+		QueryFlags: &QueryFlags{
+			GlobalFlags: SetupGlobalFlagsOn(flags),
+			Tags:        StringNVar{},
+		},
+	}
+
+	tuiFlags.Start = flags.Float64("s", 0.0, "Start timestamp")
+	tuiFlags.End = flags.Float64("e", 0.0, "End timestamp")
+	tuiFlags.Content = flags.String("c", "", "Match event content (regular expression)")
+	tuiFlags.Order = flags.String("sort", "", "Sort order of the past events. Possible values are asc or desc.")
+	tuiFlags.Live = flags.Bool("live", true, "Keep receiving live events after the past events are loaded.")
+	tuiFlags.Limit = flags.Int("max", defaultBrowserLimit, "Maximal number of events to keep in the view.")
+
+	flags.Var(&tuiFlags.Tags, "t", "Match if any tag with this value (regular expression).")
+
+	return tuiFlags, flags
+}
+
+// SetupStatsFlags creates a FlagSet for parsing the 'stats' subcommand and
+// creates a wrapper StatsFlags to hold the parsed values from the command line.
+func SetupStatsFlags() (*StatsFlags, *flag.FlagSet) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	statsFlags := &StatsFlags{
+		QueryFlags: &QueryFlags{
+			GlobalFlags: SetupGlobalFlagsOn(flags),
+			Tags:        StringNVar{},
+			NotTags:     StringNVar{},
+		},
+	}
+
+	statsFlags.Start = flags.Float64("s", 0.0, "Start timestamp")
+	statsFlags.End = flags.Float64("e", 0.0, "End timestamp")
+	statsFlags.Content = flags.String("c", "", "Match event content (regular expression)")
+	statsFlags.Source = flags.String("source", "", "Match event source (regular expression).")
+	statsFlags.NotContent = flags.String("not-c", "", "Skip events with content matching this regular expression.")
+	statsFlags.IgnoreCase = flags.Bool("i", false, "Match tags, content and source case insensitive.")
+	statsFlags.Query = flags.String("q", "", "Query string, for example: tag:db AND time>-1h")
+	statsFlags.GroupBy = flags.String("by", "tag,source,time", "Comma separated list of groups to count the events by: tag, source, time.")
+	statsFlags.Bucket = flags.Duration("bucket", time.Minute, "Size of the time bucket, for example: 1s, 1m, 1h.")
+	statsFlags.Top = flags.Int("top", 10, "Number of most common content patterns to report. 0 to disable.")
+	statsFlags.Format = flags.String("format", "table", "Output format: table or json.")
+
+	flags.Var(&statsFlags.Tags, "t", "Match if any tag with this value (regular expression).")
+	flags.Var(&statsFlags.NotTags, "not-t", "Skip events with any tag matching this value (regular expression).")
+
+	return statsFlags, flags
+}
+
+// SetupExportFlags creates a FlagSet for parsing the 'export' subcommand and
+// creates a wrapper ExportFlags to hold the parsed values from the command
+// line.
+func SetupExportFlags() (*ExportFlags, *flag.FlagSet) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	exportFlags := &ExportFlags{
+		QueryFlags: &QueryFlags{
+			GlobalFlags: SetupGlobalFlagsOn(flags),
+			Tags:        StringNVar{},
+			NotTags:     StringNVar{},
+		},
+	}
+
+	exportFlags.Start = flags.Float64("s", 0.0, "Start timestamp")
+	exportFlags.End = flags.Float64("e", 0.0, "End timestamp")
+	exportFlags.Content = flags.String("c", "", "Match event content (regular expression)")
+	exportFlags.Order = flags.String("sort", "", "Sort order. Possible values are asc or desc.")
+	exportFlags.Source = flags.String("source", "", "Match event source (regular expression).")
+	exportFlags.NotContent = flags.String("not-c", "", "Skip events with content matching this regular expression.")
+	exportFlags.IgnoreCase = flags.Bool("i", false, "Match tags, content and source case insensitive.")
+	exportFlags.Query = flags.String("q", "", "Query string, for example: tag:db AND time>-1h")
+	exportFlags.Output = flags.String("o", "", "Output archive file. Use - for STDOUT.")
+	exportFlags.Format = flags.String("format", FormatNative, "Archive format: native or jsonl.")
+	exportFlags.Compression = flags.String("compress", "", "Compression: none, gzip or zstd. Guessed from the file extension (.gz, .zst) if not set.")
+
+	flags.Var(&exportFlags.Tags, "t", "Match if any tag with this value (regular expression).")
+	flags.Var(&exportFlags.NotTags, "not-t", "Skip events with any tag matching this value (regular expression).")
+
+	return exportFlags, flags
+}
+
+// SetupImportFlags creates a FlagSet for parsing the 'import' subcommand and
+// creates a wrapper ImportFlags to hold the parsed values from the command
+// line.
+func SetupImportFlags() (*ImportFlags, *flag.FlagSet) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	importFlags := &ImportFlags{
+		GlobalFlags: SetupGlobalFlagsOn(flags),
+	}
+
+	importFlags.Input = flags.String("f", "", "Input archive file. Use - for STDIN.")
+	importFlags.Format = flags.String("format", "", "Archive format: native or jsonl. Detected from the content if not set.")
+	importFlags.Batch = flags.Int("batch", 100, "Number of events sent in a batch, between progress checkpoints.")
+	importFlags.Rate = flags.Float64("rate", 0, "Maximal number of events sent per second. 0 for no limit.")
+	importFlags.NewIDs = flags.Bool("new-ids", false, "Generate new event IDs instead of preserving the original IDs.")
+	importFlags.DryRun = flags.Bool("dry-run", false, "Only read and validate the archive, do not send the events.")
+	importFlags.Resume = flags.Bool("resume", false, "Resume an interrupted import from the progress file.")
+	importFlags.Progress = flags.String("progress", "", "Progress file. Defaults to the input file name with .progress suffix.")
+
+	return importFlags, flags
+}
+
 // SetupWatcherFlags creates a FlagSet for parsing the 'watcher' subcommand and
 // creates a wrapper WatcherFlags to hold the parsed values from the command
 // line.
 func SetupWatcherFlags() (*WatcherFlags, *flag.FlagSet) {
 	flags := flag.NewFlagSet("watch", flag.ExitOnError)
 	watcherFlags := &WatcherFlags{
-		GlobalFlags: SetupGlobalFlagsOn(flags),
-		Tags:        StringNVar{},
+		GlobalFlags:  SetupGlobalFlagsOn(flags),
+		PublishFlags: SetupPublishFlagsOn(flags),
+		Tags:         StringNVar{},
+		Fields:       StringNVar{},
 	}
 	watcherFlags.File = flags.String("f", "", "File to watch for changes")
+	watcherFlags.Extract = flags.String("extract", "", "Regular expression with named groups. The matched values are added to the event as fields.")
+	watcherFlags.MaxSize = flags.Int("max-size", 1024*1024, "Maximal size of the event content in bytes. Larger changes are split into multiple events. Zero means no limit.")
+	watcherFlags.IDStrategy = flags.String("ids", model.IDRandom, "Event ID strategy: random, time (time-ordered) or hash (derived from the file, offset and content, so re-read changes get the same ID).")
+	watcherFlags.Truncate = flags.Bool("truncate", false, "Truncate the changes larger than the maximal size instead of splitting them.")
 	flags.Var(&watcherFlags.Tags, "t", "Tag the event.")
+	flags.Var(&watcherFlags.Fields, "field", "Add a field (key=value) to the event. May be repeated.")
 	return watcherFlags, flags
 }
 
@@ -120,8 +457,10 @@ func SetupWatcherFlags() (*WatcherFlags, *flag.FlagSet) {
 func SetupEventGeneratorFlags() (*EventFlags, *flag.FlagSet) {
 	flags := flag.NewFlagSet("event", flag.ExitOnError)
 	eventFlags := &EventFlags{
-		GlobalFlags: SetupGlobalFlagsOn(flags),
-		Tags:        StringNVar{},
+		GlobalFlags:  SetupGlobalFlagsOn(flags),
+		PublishFlags: SetupPublishFlagsOn(flags),
+		Tags:         StringNVar{},
+		Fields:       StringNVar{},
 	}
 
 	eventFlags.ID = flags.String("id", "", "The event ID. If not provided, a random one will be generated.")
@@ -131,31 +470,72 @@ func SetupEventGeneratorFlags() (*EventFlags, *flag.FlagSet) {
 	eventFlags.EofSeparator = flags.String("eof", "", "EOF separator. Reading shall stop if this pattern is encountered in the STDIN.")
 	eventFlags.Separator = flags.String("sep", "", "Event content separator when reading from STDIN.")
 	eventFlags.FromStdin = flags.Bool("stdin", false, "Read event content from STDIN.")
+	eventFlags.IDStrategy = flags.String("ids", model.IDRandom, "Strategy for generating the event IDs when no ID is given: random, time (time-ordered) or hash (derived from the source, offset and content).")
 
 	flags.Var(&eventFlags.Tags, "tag", "Event tags.")
+	flags.Var(&eventFlags.Fields, "field", "Event field as key=value. May be repeated.")
 
 	return eventFlags, flags
 }
 
+// SetupServeFlags creates a FlagSet for parsing the 'serve' subcommand and
+// creates a wrapper ServeFlags to hold the parsed values from the command line.
+func SetupServeFlags() (*ServeFlags, *flag.FlagSet) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	serveFlags := &ServeFlags{}
+
+	serveFlags.Addr = flags.String("addr", "localhost:6433", "Address (host:port) to listen on, or unix:///path/to/socket to listen on a unix socket.")
+	serveFlags.File = flags.String("f", "selene-events.dat", "File to store the events in. Use empty value to keep the events in memory only.")
+	serveFlags.Dir = flags.String("dir", "", "Directory of a segmented, indexed event store. Used instead of -f if set.")
+	serveFlags.RetainSize = flags.Int64("retain-size", 0, "Maximal size of the store in -dir, in bytes. The oldest events are removed first. 0 for no limit.")
+	serveFlags.RetainAge = flags.Duration("retain-age", 0, "How long to keep the events in the store in -dir, for example 168h. 0 for no limit.")
+	serveFlags.Verbose = flags.Bool("v", false, "Verbose output")
+
+	return serveFlags, flags
+}
+
 // SetupGlobalFlagsOn adds the global flags to an existing FlagSet and returns
 // the wrapper struct that will hold the parsed values for the flags.
 func SetupGlobalFlagsOn(fg *flag.FlagSet) *GlobalFlags {
 	gf := &GlobalFlags{}
 
-	gf.ServerURL = fg.String("server", "ws://localhost:6433", "Theia server URL.")
+	gf.ServerURL = fg.String("server", "ws://localhost:6433", "Theia server URL: ws://, wss://, http://, https:// to use plain HTTP instead of websockets, or unix:///path/to/socket for a local server.")
 	gf.Verbose = fg.Bool("v", false, "Verbose output")
 	gf.Host = fg.String("H", "", "Theia host")
 	gf.Port = fg.Int("p", 0, "Theia port")
+	gf.Proxy = fg.String("proxy", "", "Proxy URL: http://host:port or socks5://host:port. Defaults to HTTPS_PROXY, HTTP_PROXY or ALL_PROXY from the environment. Use 'direct' to connect without a proxy.")
+	gf.DialTimeout = fg.Duration("dial-timeout", comm.DefaultDialTimeout, "Time limit for connecting to the server.")
 
 	return gf
 }
 
+// SetupPublishFlagsOn adds the flags for publishing to multiple servers to an
+// existing FlagSet and returns the wrapper struct that will hold the parsed
+// values for the flags.
+func SetupPublishFlagsOn(fg *flag.FlagSet) *PublishFlags {
+	pf := &PublishFlags{
+		Replicas: StringNVar{},
+		Routes:   StringNVar{},
+	}
+
+	pf.FanOut = fg.String("fanout", comm.FanOutReplicate, "How to publish to the server and the replicas: replicate (to all) or failover (to the first that is up).")
+	fg.Var(&pf.Replicas, "replica", "URL of an additional Theia server. May be repeated.")
+	fg.Var(&pf.Routes, "route", "Send the matching events to a dedicated server: <tag|source|content>:<pattern>=<url>, for example tag:security=ws://sec:6433. May be repeated.")
+
+	return pf
+}
+
 // GetServerURL returns a valid server URL based on the set up flags.
-// If ServerURL is set, then that value is preferred and returned.
+// If ServerURL is set, then that value is preferred and returned. The URL
+// scheme selects the transport (see comm.NewClient), so an error is returned
+// for any other scheme than ws, wss, http, https or unix.
 // If not, the URL is generated from the Host and Port values. If any of them
 // are not set, then an error is returned.
 func (gf *GlobalFlags) GetServerURL() (string, error) {
 	if gf.ServerURL != nil {
+		if err := validateServerURL(*gf.ServerURL); err != nil {
+			return "", err
+		}
 		return *gf.ServerURL, nil
 	}
 	if gf.Host == nil {
@@ -169,6 +549,47 @@ func (gf *GlobalFlags) GetServerURL() (string, error) {
 	return fmt.Sprintf("ws://%s:%d", *gf.Host, *gf.Port), nil // FIXME: This assumes unsecure (ws) connection
 }
 
+// ClientFactory returns the function that creates the clients to the servers
+// (see comm.NewClient), which connect through the proxy and with the dial
+// timeout set in the flags. Returns an error if the proxy is not valid.
+func (gf *GlobalFlags) ClientFactory() (func(serverURL string) comm.Client, error) {
+	proxy, err := comm.ParseProxy(asString(gf.Proxy))
+	if err != nil {
+		return nil, err
+	}
+	timeout := comm.DefaultDialTimeout
+	if gf.DialTimeout != nil {
+		timeout = *gf.DialTimeout
+	}
+	return func(serverURL string) comm.Client {
+		switch client := comm.NewClient(serverURL).(type) {
+		case *comm.HTTPClient:
+			return client.Proxy(proxy).DialTimeout(timeout)
+		case *comm.WebsocketClient:
+			return client.Proxy(proxy).DialTimeout(timeout)
+		default:
+			return client
+		}
+	}, nil
+}
+
+// validateServerURL checks that the URL has one of the supported schemes.
+func validateServerURL(serverURL string) error {
+	parsed, err := url.Parse(serverURL)
+	if err != nil {
+		return err
+	}
+	switch parsed.Scheme {
+	case "ws", "wss", "http", "https":
+		return nil
+	case "unix":
+		if parsed.Path != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported server URL %q: expected ws://, wss://, http://, https:// or unix://", serverURL)
+}
+
 // String returns a string representation of the multiple values flag value.
 func (n *StringNVar) String() string {
 	if n == nil || *n == nil {
@@ -3,6 +3,9 @@ package cli
 import (
 	"flag"
 	"testing"
+	"time"
+
+	"github.com/theia-log/selene/comm"
 )
 
 func TestGetServerURL_GlobalFlags(t *testing.T) {
@@ -42,6 +45,19 @@ func TestGetServerURL_GlobalFlags(t *testing.T) {
 		t.Fatal("Expected to fail when getting ServerURL from empty struct.")
 	}
 
+	for _, serverURL := range []string{"http://custom:9876", "https://custom", "unix:///var/run/theia.sock"} {
+		gf = &GlobalFlags{ServerURL: &serverURL}
+		if url, err = gf.GetServerURL(); err != nil || url != serverURL {
+			t.Fatalf("Expected %q but got %q (%v)", serverURL, url, err)
+		}
+	}
+	for _, serverURL := range []string{"ftp://custom", "custom:9876", "://", "unix://"} {
+		gf = &GlobalFlags{ServerURL: &serverURL}
+		if _, err = gf.GetServerURL(); err == nil {
+			t.Fatalf("Expected to fail for unsupported URL %q.", serverURL)
+		}
+	}
+
 }
 
 func TestSetupQueryFlags(t *testing.T) {
@@ -114,6 +130,41 @@ func TestGlobalFlags(t *testing.T) {
 	if gf.Verbose == nil || *gf.Verbose != true {
 		t.Fatal("Verbose flag not parsed")
 	}
+
+	if gf.DialTimeout == nil || *gf.DialTimeout != comm.DefaultDialTimeout {
+		t.Fatal("Dial timeout should default to comm.DefaultDialTimeout")
+	}
+}
+
+func TestGlobalFlags_ClientFactory(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	gf := SetupGlobalFlagsOn(fs)
+
+	if err := fs.Parse([]string{"-proxy", "socks5://proxy:1080", "-dial-timeout", "5s"}); err != nil {
+		t.Fatal(err)
+	}
+	if gf.Proxy == nil || *gf.Proxy != "socks5://proxy:1080" {
+		t.Fatal("Proxy flag not parsed properly")
+	}
+	if gf.DialTimeout == nil || *gf.DialTimeout != 5*time.Second {
+		t.Fatal("Dial timeout flag not parsed properly")
+	}
+	newClient, err := gf.ClientFactory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := newClient("http://server:9090").(*comm.HTTPClient); !ok {
+		t.Fatal("Expected HTTPClient for http:// URL")
+	}
+	if _, ok := newClient("ws://server:9090").(*comm.WebsocketClient); !ok {
+		t.Fatal("Expected WebsocketClient for ws:// URL")
+	}
+
+	proxy := "ftp://proxy:21"
+	gf.Proxy = &proxy
+	if _, err := gf.ClientFactory(); err == nil {
+		t.Fatal("Expected to fail for unsupported proxy.")
+	}
 }
 
 func TestSetupWatcherFlags(t *testing.T) {
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// terminalColorSequence matches the terminal color (SGR) escape sequences,
+// which are commonly found in logs and are safe to print.
+var terminalColorSequence = regexp.MustCompile(`^\x1b\[[0-9;]*m`)
+
+// printableText makes the event content safe to print on a terminal.
+// New lines, tabs and terminal color sequences are kept, and so is a
+// carriage return before a new line. All other control characters and the
+// bytes that are not valid UTF-8 are replaced with \xHH escapes, so binary
+// content cannot mess up the terminal.
+func printableText(text string) string {
+	if isPrintable(text) {
+		return text
+	}
+	var builder strings.Builder
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			fmt.Fprintf(&builder, `\x%02x`, text[i])
+		case r == 0x1b && terminalColorSequence.MatchString(text[i:]):
+			seq := terminalColorSequence.FindString(text[i:])
+			builder.WriteString(seq)
+			size = len(seq)
+		case r == '\r' && strings.HasPrefix(text[i+1:], "\n"):
+			builder.WriteRune(r)
+		case r == '\n' || r == '\t':
+			builder.WriteRune(r)
+		case unicode.IsControl(r):
+			fmt.Fprintf(&builder, `\x%02x`, r)
+		default:
+			builder.WriteString(text[i : i+size])
+		}
+		i += size
+	}
+	return builder.String()
+}
+
+// isPrintable checks if the text is valid UTF-8 without any control
+// characters other than new lines and tabs.
+func isPrintable(text string) bool {
+	if !utf8.ValidString(text) {
+		return false
+	}
+	for _, r := range text {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,21 @@
+package cli
+
+import "testing"
+
+func TestPrintableText(t *testing.T) {
+	cases := map[string]string{
+		"plain\ttext\n":          "plain\ttext\n",
+		"windows\r\nline":        "windows\r\nline",
+		"\x1b[31mred\x1b[0m":     "\x1b[31mred\x1b[0m",
+		"clear\x1b[2J":           `clear\x1b[2J`,
+		"nul\x00 and \x7f":       `nul\x00 and \x7f`,
+		"invalid \xff\xfe":       `invalid \xff\xfe`,
+		"over\rwrite":            `over\x0dwrite`,
+		"unicode čćž \u0085 end": `unicode čćž \x85 end`,
+	}
+	for text, expected := range cases {
+		if printable := printableText(text); printable != expected {
+			t.Fatalf("Expected %q to be printed as %q, but got %q", text, expected, printable)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/theia-log/selene/comm"
+)
+
+// parseRoute parses a routing rule in the form <tag|source|content>:<pattern>=<url>.
+// The pattern must not contain '='.
+func parseRoute(rule string, newClient func(url string) comm.Client) (*comm.Route, error) {
+	eq := strings.Index(rule, "=")
+	colon := strings.Index(rule, ":")
+	if eq < 0 || colon < 0 || colon > eq {
+		return nil, fmt.Errorf("invalid route %q: expected <tag|source|content>:<pattern>=<url>", rule)
+	}
+	kind, pattern, url := rule[:colon], rule[colon+1:eq], rule[eq+1:]
+	if url == "" {
+		return nil, fmt.Errorf("invalid route %q: no server URL", rule)
+	}
+
+	route := &comm.Route{}
+	switch kind {
+	case "tag":
+		route.Filter = comm.Filter(0).MatchTag(pattern)
+	case "content":
+		route.Filter = comm.Filter(0).MatchContent(pattern)
+	case "source":
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		route.Source = re
+	default:
+		return nil, fmt.Errorf("invalid route %q: unknown selector %s", rule, kind)
+	}
+	if route.Filter != nil {
+		if err := route.Filter.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	route.Client = newClient(url)
+	return route, nil
+}
+
+// newPublishClient creates the client used to publish the events, with
+// newClient. If there are no replicas and no routes, this is a plain client to
+// the server. Otherwise, a FanOutClient over all servers is created.
+func newPublishClient(serverURL string, flags *PublishFlags, newClient func(url string) comm.Client) (comm.Client, error) {
+	if flags == nil || (len(flags.Replicas) == 0 && len(flags.Routes) == 0) {
+		return newClient(serverURL), nil
+	}
+
+	// one client per server, even if the server is used in multiple routes
+	clientsByURL := map[string]comm.Client{}
+	getClient := func(url string) comm.Client {
+		if client, ok := clientsByURL[url]; ok {
+			return client
+		}
+		client := newClient(url)
+		clientsByURL[url] = client
+		return client
+	}
+
+	mode := asString(flags.FanOut)
+	if mode == "" {
+		mode = comm.FanOutReplicate
+	}
+	clients := []comm.Client{getClient(serverURL)}
+	for _, replica := range flags.Replicas {
+		clients = append(clients, getClient(replica))
+	}
+	fanOut, err := comm.NewFanOutClient(mode, clients...)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range flags.Routes {
+		route, err := parseRoute(rule, getClient)
+		if err != nil {
+			return nil, err
+		}
+		fanOut.Route(route)
+	}
+	return fanOut, nil
+}
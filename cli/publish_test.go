@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+	"github.com/theia-log/selene/theiatest"
+)
+
+func TestParseRoute(t *testing.T) {
+	urls := []string{}
+	newClient := func(url string) comm.Client {
+		urls = append(urls, url)
+		return comm.NewWebsocketClient(url)
+	}
+
+	valid := []struct {
+		rule  string
+		event *model.Event
+	}{
+		{"tag:^security$=ws://sec:6433", &model.Event{Tags: []string{"security"}}},
+		{"source:/var/log/auth.*=ws://sec:6433", &model.Event{Source: "/var/log/auth.log"}},
+		{"content:denied=ws://sec:6433/?a=b", &model.Event{Content: "access denied"}},
+	}
+	for _, c := range valid {
+		route, err := parseRoute(c.rule, newClient)
+		if err != nil {
+			t.Fatalf("%s: %s", c.rule, err.Error())
+		}
+		if !route.Matches(c.event) || route.Matches(&model.Event{}) {
+			t.Fatalf("%s: route does not match the expected events", c.rule)
+		}
+	}
+	if urls[2] != "ws://sec:6433/?a=b" {
+		t.Fatalf("Expected the URL to be parsed after the first '=', but got %s", urls[2])
+	}
+
+	for _, rule := range []string{"tag:security", "security=ws://sec", "tag:x=", "host:x=ws://sec", "tag:(=ws://sec", "source:[=ws://sec"} {
+		if _, err := parseRoute(rule, newClient); err == nil {
+			t.Fatalf("Expected error for route %q", rule)
+		}
+	}
+}
+
+func TestNewPublishClient(t *testing.T) {
+	client, err := newPublishClient("ws://localhost:6433", &PublishFlags{}, comm.NewClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.(*comm.WebsocketClient); !ok {
+		t.Fatalf("Expected a plain websocket client, but got %T", client)
+	}
+	if client, err = newPublishClient("http://localhost:6433", &PublishFlags{}, comm.NewClient); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.(*comm.HTTPClient); !ok {
+		t.Fatalf("Expected an HTTP client, but got %T", client)
+	}
+
+	mode := "broadcast"
+	if _, err = newPublishClient("ws://localhost:6433", &PublishFlags{Replicas: StringNVar{"ws://other:6433"}, FanOut: &mode}, comm.NewClient); err == nil {
+		t.Fatal("Expected error for unknown fan-out mode.")
+	}
+}
+
+func TestRunEventGenerator_fanOut(t *testing.T) {
+	primary, replica, security := theiatest.NewServer(), theiatest.NewServer(), theiatest.NewServer()
+	defer primary.Close()
+	defer replica.Close()
+	defer security.Close()
+
+	send := func(args ...string) {
+		flags, flagSet := SetupEventGeneratorFlags()
+		args = append([]string{"-server", primary.URL, "-replica", replica.URL, "-route", "tag:security=" + security.URL}, args...)
+		if err := flagSet.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		if err := RunEventGenerator(flags); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send("-id", "1", "-content", "app event", "-tag", "app")
+	send("-id", "2", "-content", "login failed", "-tag", "security")
+
+	for name, c := range map[string]struct {
+		server   *theiatest.Server
+		expected string
+	}{
+		"primary":  {primary, "1"},
+		"replica":  {replica, "1"},
+		"security": {security, "2"},
+	} {
+		if !c.server.WaitForEvents(1, 5*time.Second) {
+			t.Fatalf("%s: no events received", name)
+		}
+		events := c.server.Events()
+		if len(events) != 1 || events[0].ID != c.expected {
+			t.Fatalf("%s: expected event %s, but got %v", name, c.expected, events)
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"html/template"
 	"os"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/theia-log/selene/model"
 
@@ -28,25 +30,88 @@ func RunQuery(flags *QueryFlags) error {
 	if err != nil {
 		return err
 	}
-	client := comm.NewWebsocketClient(serverURL)
+	newClient, err := flags.ClientFactory()
+	if err != nil {
+		return err
+	}
+	client := newClient(serverURL)
 	filter, err := toQueryFilter(flags)
 	if err != nil {
 		return err
 	}
+	match, err := newResponseMatcher(flags, filter)
+	if err != nil {
+		return err
+	}
+	var highlight *regexp.Regexp
+	if pattern := valueOrNil(flags.Highlight); pattern != nil {
+		if highlight, err = compilePattern(*pattern, isSet(flags.IgnoreCase)); err != nil {
+			return err
+		}
+	}
+
+	limit := 0
+	if flags.Limit != nil {
+		limit = *flags.Limit
+	}
+	skip := 0
+	if flags.Skip != nil {
+		skip = *flags.Skip
+	}
+	if limit < 0 || skip < 0 {
+		return fmt.Errorf("limit and skip must not be negative")
+	}
+	follow := isSet(flags.Follow)
+	if follow && (isSet(flags.Live) || filter.End != nil || skip > 0) {
+		return fmt.Errorf("follow cannot be combined with live, end timestamp or skip")
+	}
 
 	colors := NewAuroraColors()
 	var resp chan *comm.EventResponse
 
-	if flags.Live != nil && *flags.Live {
-		resp, err = client.Receive(filter)
-	} else {
-		resp, err = client.Find(filter)
+	switch {
+	case follow && limit > 0:
+		// the past events are matched by findLast, before the limit is applied
+		live := &matchingClient{Client: client, match: match}
+		resp, err = comm.FollowAfter(live, filter, func() (chan *comm.EventResponse, error) {
+			return findLast(newClient(serverURL), filter, limit, match)
+		}, nil)
+	case follow:
+		if resp, err = comm.Follow(client, filter); err == nil {
+			resp = match(resp)
+		}
+	case isSet(flags.Live):
+		if resp, err = client.Receive(filter); err == nil {
+			resp = match(resp)
+		}
+	default:
+		if resp, err = client.Find(filter); err == nil {
+			resp = match(resp)
+		}
 	}
 
 	if err != nil {
 		return err
 	}
 
+	if isSet(flags.Dedup) {
+		size := comm.DefaultDedupSize
+		if flags.DedupSize != nil {
+			size = *flags.DedupSize
+		}
+		var window time.Duration
+		if flags.DedupWindow != nil {
+			window = *flags.DedupWindow
+		}
+		resp = comm.Dedup(resp, comm.NewDeduplicator(size, window))
+	}
+
+	if !follow && (limit > 0 || skip > 0) {
+		resp = pageResponses(resp, skip, limit, func() {
+			comm.CloseClient(client)
+		})
+	}
+
 	done := make(chan bool)
 
 	go func() {
@@ -61,7 +126,7 @@ func RunQuery(flags *QueryFlags) error {
 				continue
 			}
 			ev := event.Event
-			PrintEvent(ev, DefaultEventFormat, colors)
+			PrintEventHighlight(ev, DefaultEventFormat, colors, highlight)
 		}
 	}()
 
@@ -69,6 +134,125 @@ func RunQuery(flags *QueryFlags) error {
 	return nil
 }
 
+// responseMatcher applies the client-side filters on an EventResponse channel.
+type responseMatcher func(resp chan *comm.EventResponse) chan *comm.EventResponse
+
+// newResponseMatcher compiles the query string from the flags into the filter
+// and builds a responseMatcher that evaluates the rest of the query and the
+// client-side post filters.
+func newResponseMatcher(flags *QueryFlags, filter *comm.EventFilter) (responseMatcher, error) {
+	postFilter, err := NewPostFilter(flags)
+	if err != nil {
+		return nil, err
+	}
+	var queryExpr comm.Expr
+	if queryString := valueOrNil(flags.Query); queryString != nil {
+		query, err := comm.ParseQuery(*queryString)
+		if err != nil {
+			return nil, err
+		}
+		queryExpr = query.Compile(filter)
+	}
+	return func(resp chan *comm.EventResponse) chan *comm.EventResponse {
+		if queryExpr != nil {
+			resp = comm.MatchResponses(resp, queryExpr.Match)
+		}
+		if !postFilter.IsEmpty() {
+			resp = comm.MatchResponses(resp, postFilter.Match)
+		}
+		return resp
+	}, nil
+}
+
+// matchingClient is a client that applies the client-side filters on the
+// real-time events.
+type matchingClient struct {
+	comm.Client
+	match responseMatcher
+}
+
+// Receive opens a channel for real-time events that match the filter and the
+// client-side filters.
+func (c *matchingClient) Receive(filter *comm.EventFilter) (chan *comm.EventResponse, error) {
+	resp, err := c.Client.Receive(filter)
+	if err != nil {
+		return nil, err
+	}
+	return c.match(resp), nil
+}
+
+// pageResponses skips the first skip events from the EventResponse channel and
+// then publishes at most limit events. If limit is zero, all remaining events
+// are published. Errors are passed through and do not count.
+// Once the limit is reached, onLimit is called and the returned channel is
+// closed. The rest of the input channel is drained and discarded, so that the
+// producer of the events is not blocked.
+func pageResponses(resp chan *comm.EventResponse, skip, limit int, onLimit func()) chan *comm.EventResponse {
+	paged := make(chan *comm.EventResponse)
+	go func() {
+		count := 0
+		for event := range resp {
+			if event.Event != nil {
+				if skip > 0 {
+					skip--
+					continue
+				}
+				count++
+			}
+			paged <- event
+			if limit > 0 && count >= limit {
+				break
+			}
+		}
+		if limit > 0 && count >= limit && onLimit != nil {
+			onLimit()
+		}
+		close(paged)
+		for range resp {
+			// discard the events (and errors from closing the connection)
+		}
+	}()
+	return paged
+}
+
+// abortStream closes the client and discards the rest of the events, so that
+// the stream ends once the connections are closed.
+func abortStream(client comm.Client, resp chan *comm.EventResponse) {
+	comm.CloseClient(client)
+	go func() {
+		for range resp {
+		}
+	}()
+}
+
+// findLast looks up the last n events that match the filter and returns them
+// in ascending order, on a channel that is closed after the last event. The
+// events are looked up in descending order, with a separate findClient that is
+// closed as soon as the n events are found.
+func findLast(findClient comm.Client, filter *comm.EventFilter, n int, match responseMatcher) (chan *comm.EventResponse, error) {
+	descFilter := *filter
+	descFilter.OrderDesc()
+
+	resp, err := findClient.Find(&descFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []*comm.EventResponse{}
+	for event := range pageResponses(match(resp), 0, n, func() {
+		comm.CloseClient(findClient)
+	}) {
+		events = append(events, event)
+	}
+
+	past := make(chan *comm.EventResponse, len(events))
+	for i := len(events) - 1; i >= 0; i-- {
+		past <- events[i]
+	}
+	close(past)
+	return past, nil
+}
+
 // toQueryFilter transforms the QueryFlags to an EventFilter ready to be passed
 // down to the theia client.
 func toQueryFilter(flags *QueryFlags) (*comm.EventFilter, error) {
@@ -91,16 +275,36 @@ func toQueryFilter(flags *QueryFlags) (*comm.EventFilter, error) {
 		filterOrder = &ord
 	}
 
+	content := valueOrNil(flags.Content)
+	tags := flags.Tags
+	if isSet(flags.IgnoreCase) {
+		// Theia evaluates the patterns as Python regular expressions, which
+		// support the same inline flag for case insensitive matching.
+		if content != nil {
+			ciContent := "(?i)" + *content
+			content = &ciContent
+		}
+		tags = StringNVar{}
+		for _, tag := range flags.Tags {
+			tags = append(tags, "(?i)"+tag)
+		}
+	}
+
 	filter := &comm.EventFilter{
-		Content: valueOrNil(flags.Content),
+		Content: content,
 		Order:   filterOrder,
-		Tags:    flags.Tags,
+		Tags:    tags,
 		Start:   start,
 		End:     end,
 	}
 	return filter, nil
 }
 
+// isSet returns true if the bool flag is set and true.
+func isSet(flag *bool) bool {
+	return flag != nil && *flag
+}
+
 // valueOrNil returns nil if the passed pointer is nil or points to an empty
 // string (""). Otherwise returns the original string.
 func valueOrNil(str *string) *string {
@@ -120,6 +324,7 @@ type templateEvent struct {
 	Tags      string
 	Source    string
 	Content   string
+	Fields    map[string]string
 }
 
 // FullEventFormat format template for printing an Event - full data.
@@ -132,8 +337,19 @@ var ShortEventFormat = "[{{ .Source }}]{{ .Tags }} - {{ .Content }}"
 var DefaultEventFormat = "{{ .IDShort }}:[{{ .Timestamp }}]({{ .Source }}) {{ .Tags }} - {{ .Content }}"
 
 // PrintEvent prints the event using the provided format template to STDOUT.
+// Binary content is printed safely: the control characters and the bytes that
+// are not valid UTF-8 are shown as \xHH escapes.
 func PrintEvent(event *model.Event, format string, colors Colors) {
-	content := event.Content
+	PrintEventHighlight(event, format, colors, nil)
+}
+
+// PrintEventHighlight prints the event using the provided format template to
+// STDOUT. The parts of the event content and source that match the highlight
+// regular expression are colored with the "highlight" color. If highlight is
+// nil, the event is printed the same as with PrintEvent.
+func PrintEventHighlight(event *model.Event, format string, colors Colors, highlight *regexp.Regexp) {
+	content := printableText(event.Content)
+	source := printableText(event.Source)
 	if !strings.HasSuffix(content, "\n") {
 		content = content + "\n"
 	}
@@ -145,9 +361,13 @@ func PrintEvent(event *model.Event, format string, colors Colors) {
 		ID:        colors.ColoredText(Context{"color": "secondary"}, event.ID),
 		IDShort:   colors.ColoredText(Context{"color": "secondary"}, fmt.Sprintf("%7s", idShort)),
 		Content:   colors.ColoredContent(Context{}, content),
-		Source:    colors.ColoredText(Context{"color": "secondary"}, event.Source),
+		Source:    colors.ColoredText(Context{"color": "secondary"}, source),
 		Timestamp: colors.ColoredText(Context{"color": "info"}, fmt.Sprintf("%f", event.Timestamp)),
 	}
+	if highlight != nil {
+		te.Content = highlightText(colors, KnownTypes.Detect(content), content, highlight)
+		te.Source = highlightText(colors, "secondary", source, highlight)
+	}
 
 	tags := []string{}
 	if event.Tags != nil {
@@ -157,6 +377,13 @@ func PrintEvent(event *model.Event, format string, colors Colors) {
 	}
 	te.Tags = strings.Join(tags, " ")
 
+	if len(event.Fields) > 0 {
+		te.Fields = map[string]string{}
+		for key, value := range event.Fields {
+			te.Fields[key] = printableText(value)
+		}
+	}
+
 	tpl, err := template.New("event").Parse(format)
 	if err != nil {
 		panic(err)
@@ -166,3 +393,21 @@ func PrintEvent(event *model.Event, format string, colors Colors) {
 		panic(err)
 	}
 }
+
+// highlightText colors the parts of the text that match the highlight regular
+// expression with the "highlight" color, and the rest of the text with the
+// given base color.
+func highlightText(colors Colors, baseColor, text string, highlight *regexp.Regexp) string {
+	var builder strings.Builder
+	last := 0
+	for _, match := range highlight.FindAllStringIndex(text, -1) {
+		if match[0] == match[1] {
+			continue
+		}
+		builder.WriteString(colors.ColoredText(Context{"color": baseColor}, text[last:match[0]]))
+		builder.WriteString(colors.ColoredText(Context{"color": "highlight"}, text[match[0]:match[1]]))
+		last = match[1]
+	}
+	builder.WriteString(colors.ColoredText(Context{"color": baseColor}, text[last:]))
+	return builder.String()
+}
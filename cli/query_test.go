@@ -1,11 +1,14 @@
 package cli
 
 import (
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/theia-log/selene/model"
+	"github.com/theia-log/selene/theiatest"
 
 	"github.com/theia-log/selene/comm"
 )
@@ -23,16 +26,16 @@ func TestQueryCommand(t *testing.T) {
 		Respond("ok")
 	done := make(chan bool)
 	go func() {
+		defer func() { done <- true }()
 		mock.WaitRequestsToComplete(1)
 		mock.Terminate()
 
 		if mock.Errors != nil {
 			for _, err := range mock.Errors {
-				t.Log(err.Error())
+				t.Error(err.Error())
 			}
-			t.FailNow()
+			return
 		}
-		done <- true
 	}()
 	err := QueryCommand([]string{"-server", mock.MockURL,
 		"-s", "100.1",
@@ -59,3 +62,183 @@ func TestPrintEvent(t *testing.T) {
 	PrintEvent(ev, DefaultEventFormat, colors)
 
 }
+
+func TestQueryCommand_queryString(t *testing.T) {
+	mock := comm.NewWebsocketMock().
+		Expect("{\"start\":100.1,\"tags\":[\"tag1\",\"^db$\"],\"content\":\"timeout\"}").
+		Respond("ok")
+	done := make(chan bool)
+	go func() {
+		defer func() { done <- true }()
+		mock.WaitRequestsToComplete(1)
+		mock.Terminate()
+
+		if mock.Errors != nil {
+			for _, err := range mock.Errors {
+				t.Error(err.Error())
+			}
+			return
+		}
+	}()
+	err := QueryCommand([]string{"-server", mock.MockURL,
+		"-s", "100.1",
+		"-t", "tag1",
+		"-q", "tag:db AND content:timeout AND NOT source:api*",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
+
+func TestPageResponses(t *testing.T) {
+	resp := make(chan *comm.EventResponse)
+	go func() {
+		for i := 0; i < 10; i++ {
+			resp <- &comm.EventResponse{Event: &model.Event{ID: fmt.Sprintf("%d", i)}}
+		}
+		close(resp)
+	}()
+
+	limitReached := false
+	ids := ""
+	for event := range pageResponses(resp, 2, 3, func() { limitReached = true }) {
+		ids += event.Event.ID
+	}
+
+	if ids != "234" {
+		t.Fatalf("Expected events 234, but got %s", ids)
+	}
+	if !limitReached {
+		t.Fatal("Expected the limit callback to be called.")
+	}
+
+	// the input ends before the limit is reached
+	short := make(chan *comm.EventResponse, 1)
+	short <- &comm.EventResponse{Event: &model.Event{ID: "0"}}
+	close(short)
+	limitReached = false
+	for range pageResponses(short, 0, 3, func() { limitReached = true }) {
+	}
+	if limitReached {
+		t.Fatal("Expected the limit callback not to be called.")
+	}
+}
+
+func TestQueryCommand_limit(t *testing.T) {
+	event := strings.Join([]string{
+		"event:71 65 6",
+		"id:id-001",
+		"timestamp:1551733035.230000",
+		"source:/src",
+		"tags:tag1,tag2",
+		"event1",
+	}, "\n")
+	mock := comm.NewWebsocketMock().
+		Expect("{\"start\":100.1}").
+		Respond("ok").
+		Respond(event).
+		Respond(event)
+
+	// the command returns only once the limit is reached and the connection
+	// is closed by the client
+	err := QueryCommand([]string{"-server", mock.MockURL,
+		"-s", "100.1",
+		"-n", "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.WaitRequestsToComplete(1)
+}
+
+func TestQueryCommand_invalidFollow(t *testing.T) {
+	if err := QueryCommand([]string{"-follow", "-live"}); err == nil {
+		t.Fatal("Expected -follow and -live to be rejected.")
+	}
+}
+
+func TestFollowLast_matchOnce(t *testing.T) {
+	server := theiatest.NewServer()
+	defer server.Close()
+	for i := 1; i <= 3; i++ {
+		server.Add(&model.Event{ID: fmt.Sprintf("%d", i), Timestamp: float64(i), Content: "event"})
+	}
+
+	// counts how many times every event is evaluated
+	mux := sync.Mutex{}
+	evaluated := map[string]int{}
+	match := func(resp chan *comm.EventResponse) chan *comm.EventResponse {
+		return comm.MatchResponses(resp, func(ev *model.Event) bool {
+			mux.Lock()
+			defer mux.Unlock()
+			evaluated[ev.ID]++
+			return true
+		})
+	}
+
+	client := comm.NewClient(server.URL)
+	defer comm.CloseClient(client)
+	filter := &comm.EventFilter{}
+	resp, err := comm.FollowAfter(&matchingClient{Client: client, match: match}, filter, func() (chan *comm.EventResponse, error) {
+		return findLast(comm.NewClient(server.URL), filter, 2, match)
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !server.WaitForSubscribers(1, 5*time.Second) {
+		t.Fatal("Expected the client to subscribe to live events.")
+	}
+	server.Add(&model.Event{ID: "4", Timestamp: 4, Content: "event"})
+
+	ids := ""
+	for event := range resp {
+		if event.Error != nil {
+			t.Fatal(event.Error)
+		}
+		if ids += event.Event.ID; len(ids) == 3 {
+			break
+		}
+	}
+	if ids != "234" {
+		t.Fatalf("Expected events 234, but got %s", ids)
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	for _, id := range []string{"2", "3", "4"} {
+		if evaluated[id] != 1 {
+			t.Fatalf("Expected event %s to be evaluated once, but got %v", id, evaluated)
+		}
+	}
+}
+
+func TestQueryString_generatedEventTime(t *testing.T) {
+	server := theiatest.NewServer()
+	defer server.Close()
+	flags, flagSet := SetupEventGeneratorFlags()
+	if err := flagSet.Parse([]string{"-server", server.URL, "-id", "1", "-content", "generated"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunEventGenerator(flags); err != nil {
+		t.Fatal(err)
+	}
+	if !server.WaitForEvents(1, 5*time.Second) {
+		t.Fatal("Expected the generated event to be stored.")
+	}
+	event := server.Events()[0]
+
+	for query, expected := range map[string]bool{
+		"time>-1h":          true,
+		"time>-1h time<+1h": true,
+		"time<-1h":          false,
+		"time>+1h":          false,
+	} {
+		q, err := comm.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.Match(event) != expected {
+			t.Fatalf("Expected %s to match %v for timestamp %f", query, expected, event.Timestamp)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/theia-log/selene/server"
+	"github.com/theia-log/selene/storage"
+)
+
+// ServeCommand implements the 'serve' subcommand.
+// Takes a list of arguments to the serve subcommand, parses it and then calls
+// RunServe with the parsed flags.
+func ServeCommand(args []string) error {
+	serveFlags, flags := SetupServeFlags()
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return RunServe(serveFlags, interrupted())
+}
+
+// interrupted returns a channel that is closed once the process receives an
+// interrupt signal.
+func interrupted() chan struct{} {
+	done := make(chan struct{})
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		signal.Stop(c)
+		close(done)
+	}()
+	return done
+}
+
+// openServerStore opens the store configured by the flags: the segmented store
+// if a directory is set, a single file store if a file is set, or an in-memory
+// store.
+func openServerStore(flags *ServeFlags) (server.Store, error) {
+	if dir := asString(flags.Dir); dir != "" {
+		options := &storage.Options{}
+		if flags.RetainSize != nil {
+			options.MaxSize = *flags.RetainSize
+		}
+		if flags.RetainAge != nil {
+			options.MaxAge = *flags.RetainAge
+		}
+		return storage.Open(dir, options)
+	}
+	if file := asString(flags.File); file != "" {
+		return server.OpenFileStore(file)
+	}
+	return server.NewMemoryStore(), nil
+}
+
+// listen listens on the address: a TCP address (host:port), or unix://
+// followed by the path of a unix socket. Returns the listener and the URL that
+// the clients connect to.
+func listen(addr string) (net.Listener, string, error) {
+	if strings.HasPrefix(addr, "unix://") {
+		listener, err := net.Listen("unix", strings.TrimPrefix(addr, "unix://"))
+		return listener, addr, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	return listener, "ws://" + addr, err
+}
+
+// RunServe runs a local Theia compatible server until the stop channel is
+// closed. The events are stored in the directory or the file given in the
+// flags, or in memory if neither is set.
+func RunServe(flags *ServeFlags, stop chan struct{}) error {
+	store, err := openServerStore(flags)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	listener, serverURL, err := listen(asString(flags.Addr))
+	if err != nil {
+		return err
+	}
+	srv := server.New(store)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(listener)
+	}()
+	if isSet(flags.Verbose) {
+		log.Printf("Listening on %s\n", serverURL)
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	case <-stop:
+	}
+	if err := srv.Close(); err != nil {
+		return err
+	}
+	return <-errs
+}
@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+)
+
+func TestRunServe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selene-serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// find a free port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	flags, flagSet := SetupServeFlags()
+	if err = flagSet.Parse([]string{"-addr", addr, "-f", filepath.Join(dir, "events.dat")}); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		result <- RunServe(flags, stop)
+	}()
+
+	client := comm.NewWebsocketClient("ws://" + addr)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err = client.Send(&model.Event{ID: "1", Timestamp: 1, Content: "served"})
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	client.Close()
+
+	// wait for the event to be stored
+	found := false
+	for !found && time.Now().Before(deadline) {
+		resp, err := comm.NewWebsocketClient("ws://" + addr).Find(comm.Filter(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for event := range resp {
+			found = found || (event.Event != nil && event.Event.ID == "1")
+		}
+	}
+	if !found {
+		t.Fatal("Event was not stored.")
+	}
+
+	close(stop)
+	select {
+	case err = <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop.")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "events.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := &model.Event{}
+	if err = model.NewDecoder(bytes.NewReader(data)).Decode(ev); err != nil || ev.Content != "served" {
+		t.Fatalf("Expected the event to be stored, but got %v (%v)", ev, err)
+	}
+}
+
+func TestRunServe_unixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selene-serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	serverURL := "unix://" + filepath.Join(dir, "theia.sock")
+
+	flags, flagSet := SetupServeFlags()
+	if err = flagSet.Parse([]string{"-addr", serverURL, "-f", ""}); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		result <- RunServe(flags, stop)
+	}()
+
+	client := comm.NewClient(serverURL)
+	defer comm.CloseClient(client)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err = client.Send(&model.Event{ID: "1", Timestamp: 1, Content: "served"})
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(stop)
+	select {
+	case err = <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop.")
+	}
+}
+
+func TestOpenServerStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selene-serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-f", ""}, "*server.MemoryStore"},
+		{[]string{"-f", filepath.Join(dir, "events.dat")}, "*server.FileStore"},
+		{[]string{"-dir", filepath.Join(dir, "store"), "-retain-size", "1000000"}, "*storage.Store"},
+	}
+	for _, c := range cases {
+		flags, flagSet := SetupServeFlags()
+		if err = flagSet.Parse(c.args); err != nil {
+			t.Fatal(err)
+		}
+		store, err := openServerStore(flags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := fmt.Sprintf("%T", store); actual != c.expected {
+			t.Fatalf("Expected %s for %v, but got %s", c.expected, c.args, actual)
+		}
+		store.Close()
+	}
+}
@@ -0,0 +1,410 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+)
+
+// StatsCommand implements the 'stats' subcommand.
+// Takes a list of arguments to the stats subcommand, parses it and then calls
+// RunStats with the parsed flags.
+func StatsCommand(args []string) error {
+	statsFlags, flags := SetupStatsFlags()
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return RunStats(statsFlags)
+}
+
+// RunStats looks up the past events that match the filter flags and prints
+// statistics about them. The statistics are calculated as the events arrive,
+// so the events are not held in memory.
+// If the stream of events breaks before the server ends it, the error is
+// returned and no statistics are printed.
+func RunStats(flags *StatsFlags) error {
+	serverURL, err := flags.GetServerURL()
+	if err != nil {
+		return err
+	}
+	newClient, err := flags.ClientFactory()
+	if err != nil {
+		return err
+	}
+	filter, err := toQueryFilter(flags.QueryFlags)
+	if err != nil {
+		return err
+	}
+	match, err := newResponseMatcher(flags.QueryFlags, filter)
+	if err != nil {
+		return err
+	}
+
+	groups := map[string]bool{}
+	for _, group := range strings.Split(asString(flags.GroupBy), ",") {
+		group = strings.TrimSpace(group)
+		switch group {
+		case "":
+		case statsGroupTag, statsGroupSource, statsGroupTime:
+			groups[group] = true
+		default:
+			return fmt.Errorf("invalid group: %s", group)
+		}
+	}
+	format := asString(flags.Format)
+	if format != "table" && format != "json" {
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+	bucket := time.Minute
+	if flags.Bucket != nil {
+		bucket = *flags.Bucket
+	}
+	if bucket <= 0 {
+		return fmt.Errorf("bucket must be a positive duration")
+	}
+	top := 10
+	if flags.Top != nil {
+		top = *flags.Top
+	}
+
+	client := newClient(serverURL)
+	resp, err := client.Find(filter)
+	if err != nil {
+		return err
+	}
+
+	stats := NewEventStats(groups, bucket, top)
+	matched := match(resp)
+	for event := range matched {
+		if event.Error != nil {
+			if comm.IsStreamEnd(event.Error) {
+				continue
+			}
+			abortStream(client, matched)
+			return event.Error
+		}
+		stats.Add(event.Event)
+	}
+
+	if format == "json" {
+		return stats.WriteJSON(os.Stdout)
+	}
+	return stats.WriteTable(os.Stdout)
+}
+
+// Groups of statistics that can be reported.
+const (
+	statsGroupTag    = "tag"
+	statsGroupSource = "source"
+	statsGroupTime   = "time"
+)
+
+// maxPatterns is the maximal number of distinct content patterns counted.
+const maxPatterns = 1000
+
+// maxFilledBuckets is the maximal number of time buckets for which the empty
+// buckets are reported as well.
+const maxFilledBuckets = 1000
+
+// StatsCount is a count of events for a given key.
+type StatsCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// StatsBucket is a count of events in a time bucket.
+type StatsBucket struct {
+	Start float64 `json:"start"`
+	Count int     `json:"count"`
+}
+
+// StatsReport is the result of the statistics over a set of events. The
+// timestamps and the bucket size are in milliseconds, the rate is in events per
+// second.
+type StatsReport struct {
+	Total    int           `json:"total"`
+	First    float64       `json:"first,omitempty"`
+	Last     float64       `json:"last,omitempty"`
+	Rate     float64       `json:"rate"`
+	Bucket   float64       `json:"bucket,omitempty"`
+	Tags     []StatsCount  `json:"tags,omitempty"`
+	Sources  []StatsCount  `json:"sources,omitempty"`
+	Buckets  []StatsBucket `json:"buckets,omitempty"`
+	Patterns []StatsCount  `json:"patterns,omitempty"`
+}
+
+// EventStats calculates statistics over a stream of events: number of events
+// by tag, by source and by time bucket, and the most common content patterns.
+// The events are not kept - only the counters are. The timestamps of the events
+// are expected to be in milliseconds, as written by selene event and watch.
+type EventStats struct {
+	groups   map[string]bool
+	bucket   float64
+	top      int
+	total    int
+	first    float64
+	last     float64
+	tags     map[string]int
+	sources  map[string]int
+	buckets  map[float64]int
+	patterns *topCounter
+}
+
+// NewEventStats creates new EventStats that reports the given groups (tag,
+// source, time), with the given time bucket size, and the top most common
+// content patterns. If top is zero, the content patterns are not counted.
+func NewEventStats(groups map[string]bool, bucket time.Duration, top int) *EventStats {
+	return &EventStats{
+		groups:   groups,
+		bucket:   float64(bucket) / float64(time.Millisecond),
+		top:      top,
+		tags:     map[string]int{},
+		sources:  map[string]int{},
+		buckets:  map[float64]int{},
+		patterns: newTopCounter(maxPatterns),
+	}
+}
+
+// Add counts the event.
+func (s *EventStats) Add(event *model.Event) {
+	if s.total == 0 || event.Timestamp < s.first {
+		s.first = event.Timestamp
+	}
+	if s.total == 0 || event.Timestamp > s.last {
+		s.last = event.Timestamp
+	}
+	s.total++
+
+	if s.groups[statsGroupTag] {
+		for _, tag := range event.Tags {
+			s.tags[tag]++
+		}
+	}
+	if s.groups[statsGroupSource] {
+		s.sources[event.Source]++
+	}
+	if s.groups[statsGroupTime] {
+		s.buckets[s.bucketStart(event.Timestamp)]++
+	}
+	if s.top > 0 {
+		s.patterns.Add(contentPattern(event.Content))
+	}
+}
+
+func (s *EventStats) bucketStart(timestamp float64) float64 {
+	return math.Floor(timestamp/s.bucket) * s.bucket
+}
+
+// Report generates the StatsReport from the events counted so far.
+func (s *EventStats) Report() *StatsReport {
+	report := &StatsReport{
+		Total: s.total,
+		First: s.first,
+		Last:  s.last,
+	}
+	if s.total > 1 && s.last > s.first {
+		report.Rate = float64(s.total) / (s.last - s.first) * 1000
+	}
+	if s.groups[statsGroupTag] {
+		report.Tags = sortedCounts(s.tags, 0)
+	}
+	if s.groups[statsGroupSource] {
+		report.Sources = sortedCounts(s.sources, 0)
+	}
+	if s.groups[statsGroupTime] && s.total > 0 {
+		report.Bucket = s.bucket
+		report.Buckets = s.timeBuckets()
+	}
+	if s.top > 0 {
+		report.Patterns = sortedCounts(s.patterns.counts, s.top)
+	}
+	return report
+}
+
+// timeBuckets returns the time buckets sorted by time. If there are not too
+// many buckets between the first and the last event, the empty buckets are
+// included as well.
+func (s *EventStats) timeBuckets() []StatsBucket {
+	buckets := []StatsBucket{}
+	first := s.bucketStart(s.first)
+	last := s.bucketStart(s.last)
+	if (last-first)/s.bucket < maxFilledBuckets {
+		for i := 0; first+float64(i)*s.bucket <= last; i++ {
+			start := first + float64(i)*s.bucket
+			buckets = append(buckets, StatsBucket{Start: start, Count: s.buckets[s.bucketStart(start+s.bucket/2)]})
+		}
+		return buckets
+	}
+	for start, count := range s.buckets {
+		buckets = append(buckets, StatsBucket{Start: start, Count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start < buckets[j].Start })
+	return buckets
+}
+
+// WriteJSON writes the report as JSON.
+func (s *EventStats) WriteJSON(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s.Report())
+}
+
+// WriteTable writes the report as human readable tables, with a histogram of
+// the number of events per time bucket.
+func (s *EventStats) WriteTable(out io.Writer) error {
+	report := s.Report()
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Events:\t%d\n", report.Total)
+	if report.Total > 0 {
+		fmt.Fprintf(w, "First:\t%s\n", formatTimestamp(report.First))
+		fmt.Fprintf(w, "Last:\t%s\n", formatTimestamp(report.Last))
+		fmt.Fprintf(w, "Rate:\t%.3f events/s\n", report.Rate)
+	}
+
+	writeCounts := func(title string, counts []StatsCount) {
+		if len(counts) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s:\n", title)
+		for _, count := range counts {
+			fmt.Fprintf(w, "  %s\t%d\t%5.1f%%\n", count.Key, count.Count, 100*float64(count.Count)/float64(report.Total))
+		}
+	}
+	writeCounts("Tags", report.Tags)
+	writeCounts("Sources", report.Sources)
+
+	if len(report.Buckets) > 0 {
+		max := 0
+		for _, bucket := range report.Buckets {
+			if bucket.Count > max {
+				max = bucket.Count
+			}
+		}
+		fmt.Fprintf(w, "\nEvents per %s:\n", time.Duration(report.Bucket*float64(time.Millisecond)))
+		for _, bucket := range report.Buckets {
+			fmt.Fprintf(w, "  %s\t%d\t%s\n", formatTimestamp(bucket.Start), bucket.Count, histogramBar(bucket.Count, max, 50))
+		}
+	}
+
+	if len(report.Patterns) > 0 {
+		fmt.Fprintf(w, "\nTop content patterns:\n")
+		for _, pattern := range report.Patterns {
+			fmt.Fprintf(w, "  %d\t%s\n", pattern.Count, pattern.Key)
+		}
+	}
+
+	return w.Flush()
+}
+
+// formatTimestamp formats the timestamp (in milliseconds) as RFC3339 date in
+// UTC.
+func formatTimestamp(timestamp float64) string {
+	return time.Unix(0, int64(timestamp*float64(time.Millisecond))).UTC().Format(time.RFC3339)
+}
+
+// histogramBar draws a bar proportional to count/max, at most width long.
+func histogramBar(count, max, width int) string {
+	if max == 0 {
+		return ""
+	}
+	n := count * width / max
+	if n == 0 && count > 0 {
+		n = 1
+	}
+	return strings.Repeat("#", n)
+}
+
+// sortedCounts sorts the counts descending by count, then by key. If top is
+// greater than zero, only the first top counts are returned.
+func sortedCounts(counts map[string]int, top int) []StatsCount {
+	sorted := []StatsCount{}
+	for key, count := range counts {
+		sorted = append(sorted, StatsCount{Key: key, Count: count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+	if top > 0 && len(sorted) > top {
+		sorted = sorted[:top]
+	}
+	return sorted
+}
+
+// topCounter counts the most frequent keys using bounded memory.
+// When the capacity is reached, the least frequent key is replaced by the new
+// key, which inherits its count (the Space-Saving algorithm). The counts of the
+// frequent keys are therefore approximate, but the most frequent keys are kept.
+type topCounter struct {
+	capacity int
+	counts   map[string]int
+}
+
+func newTopCounter(capacity int) *topCounter {
+	return &topCounter{
+		capacity: capacity,
+		counts:   map[string]int{},
+	}
+}
+
+// Add counts one occurrence of the key.
+func (c *topCounter) Add(key string) {
+	if _, ok := c.counts[key]; ok || len(c.counts) < c.capacity {
+		c.counts[key]++
+		return
+	}
+	minKey, minCount, found := "", 0, false
+	for k, count := range c.counts {
+		if !found || count < minCount {
+			minKey, minCount, found = k, count, true
+		}
+	}
+	delete(c.counts, minKey)
+	c.counts[key] = minCount + 1
+}
+
+// contentPatterns replace the variable parts of the content, like numbers and
+// identifiers, with placeholders.
+var contentPatterns = []struct {
+	pattern     *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`"[^"]*"|'[^']*'`), "<str>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\b\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}(:\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b|\b[0-9a-f]*\d[0-9a-f]*[a-f][0-9a-f]*\b|\b[0-9a-f]*[a-f][0-9a-f]*\d[0-9a-f]*\b`), "<hex>"},
+	{regexp.MustCompile(`[-+]?\d+(\.\d+)?`), "<num>"},
+	{regexp.MustCompile(`\s+`), " "},
+}
+
+// maxPatternLength is the maximal length of a content pattern.
+const maxPatternLength = 120
+
+// contentPattern reduces the content to a pattern, by replacing the variable
+// parts of the first line of the content with placeholders.
+func contentPattern(content string) string {
+	if idx := strings.IndexByte(content, '\n'); idx >= 0 {
+		content = content[:idx]
+	}
+	for _, p := range contentPatterns {
+		content = p.pattern.ReplaceAllString(content, p.placeholder)
+	}
+	content = strings.TrimSpace(content)
+	if runes := []rune(content); len(runes) > maxPatternLength {
+		content = string(runes[:maxPatternLength]) + "..."
+	}
+	return content
+}
@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+	"github.com/theia-log/selene/theiatest"
+)
+
+func TestEventStats(t *testing.T) {
+	stats := NewEventStats(map[string]bool{"tag": true, "source": true, "time": true}, time.Minute, 2)
+
+	stats.Add(&model.Event{Timestamp: 60000, Source: "api", Tags: []string{"db", "error"}, Content: "timeout after 30ms"})
+	stats.Add(&model.Event{Timestamp: 70000, Source: "api", Tags: []string{"db"}, Content: "timeout after 45ms"})
+	stats.Add(&model.Event{Timestamp: 200000, Source: "web", Tags: []string{"http"}, Content: "GET /index 200"})
+
+	report := stats.Report()
+	if report.Total != 3 || report.First != 60000 || report.Last != 200000 {
+		t.Fatalf("Unexpected totals: %+v", report)
+	}
+	if len(report.Tags) != 3 || report.Tags[0].Key != "db" || report.Tags[0].Count != 2 {
+		t.Fatalf("Unexpected tag counts: %+v", report.Tags)
+	}
+	if len(report.Sources) != 2 || report.Sources[0].Key != "api" {
+		t.Fatalf("Unexpected source counts: %+v", report.Sources)
+	}
+	expectedBuckets := []StatsBucket{{60000, 2}, {120000, 0}, {180000, 1}}
+	if fmt.Sprint(report.Buckets) != fmt.Sprint(expectedBuckets) {
+		t.Fatalf("Expected buckets %v, but got %v", expectedBuckets, report.Buckets)
+	}
+	if len(report.Patterns) != 2 || report.Patterns[0].Key != "timeout after <num>ms" || report.Patterns[0].Count != 2 {
+		t.Fatalf("Unexpected content patterns: %+v", report.Patterns)
+	}
+
+	var out bytes.Buffer
+	if err := stats.WriteJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &StatsReport{}
+	if err := json.Unmarshal(out.Bytes(), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Total != 3 {
+		t.Fatal("Expected the JSON report to contain the total.")
+	}
+
+	out.Reset()
+	if err := stats.WriteTable(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Events per 1m0s:") {
+		t.Fatalf("Expected the histogram in the table output:\n%s", out.String())
+	}
+}
+
+func TestContentPattern(t *testing.T) {
+	cases := map[string]string{
+		"connection to 10.0.0.1:5432 failed":                            "connection to <ip> failed",
+		"user \"john\" logged in":                                       "user <str> logged in",
+		"request 684b84e9-14aa-4267-828a-55ea371c0508 took 1.5s\nstack": "request <uuid> took <num>s",
+		"object at 0x7ffe12 freed":                                      "object at <hex> freed",
+	}
+	for content, expected := range cases {
+		if pattern := contentPattern(content); pattern != expected {
+			t.Fatalf("Expected pattern '%s' but got '%s'", expected, pattern)
+		}
+	}
+}
+
+func TestTopCounter(t *testing.T) {
+	counter := newTopCounter(2)
+	for i := 0; i < 5; i++ {
+		counter.Add("frequent")
+	}
+	counter.Add("rare-1")
+	counter.Add("rare-2")
+
+	if len(counter.counts) != 2 {
+		t.Fatal("Expected the counter to be bounded.")
+	}
+	if counter.counts["frequent"] != 5 {
+		t.Fatal("Expected the frequent key to be kept.")
+	}
+	if counter.counts["rare-2"] != 2 {
+		t.Fatal("Expected the new key to inherit the evicted count.")
+	}
+
+	// the empty content pattern is a key as well
+	for i := 0; i < 10; i++ {
+		counter = newTopCounter(2)
+		for j := 0; j < 5; j++ {
+			counter.Add("frequent")
+		}
+		counter.Add("")
+		counter.Add("new")
+		if counter.counts["frequent"] != 5 || counter.counts["new"] != 2 {
+			t.Fatalf("Expected the empty key to be evicted, but got %v", counter.counts)
+		}
+	}
+}
+
+func TestRunStatsInvalidFlags(t *testing.T) {
+	if err := StatsCommand([]string{"-by", "color"}); err == nil {
+		t.Fatal("Expected invalid group to be rejected.")
+	}
+	if err := StatsCommand([]string{"-format", "xml"}); err == nil {
+		t.Fatal("Expected invalid format to be rejected.")
+	}
+}
+
+func TestEventStats_generatedEvent(t *testing.T) {
+	server := theiatest.NewServer()
+	defer server.Close()
+	flags, flagSet := SetupEventGeneratorFlags()
+	if err := flagSet.Parse([]string{"-server", server.URL, "-id", "1", "-content", "generated"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunEventGenerator(flags); err != nil {
+		t.Fatal(err)
+	}
+	if !server.WaitForEvents(1, 5*time.Second) {
+		t.Fatal("Expected the generated event to be stored.")
+	}
+
+	stats := NewEventStats(map[string]bool{"time": true}, time.Hour, 0)
+	stats.Add(server.Events()[0])
+	report := stats.Report()
+	if first, err := time.Parse(time.RFC3339, formatTimestamp(report.First)); err != nil || time.Since(first) > time.Minute {
+		t.Fatalf("Expected the event time to be now, but got %s", formatTimestamp(report.First))
+	}
+	if len(report.Buckets) != 1 || report.Bucket != float64(time.Hour/time.Millisecond) {
+		t.Fatalf("Expected one hour bucket, but got %v of %f", report.Buckets, report.Bucket)
+	}
+	if start := report.Buckets[0].Start; start > report.First || report.First-start >= report.Bucket {
+		t.Fatalf("Expected the event in the bucket starting at %f, but got %f", start, report.First)
+	}
+}
+
+func TestStatsCommand_droppedStream(t *testing.T) {
+	data, err := archiveEvents()[0].DumpBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the connection breaks after the first event
+	mock := comm.NewWebsocketMock().
+		Expect("{\"start\":100.1}").
+		Respond(string(data))
+	done := make(chan bool)
+	go func() {
+		mock.WaitRequestsToComplete(1)
+		time.Sleep(100 * time.Millisecond)
+		mock.Terminate()
+		done <- true
+	}()
+
+	err = StatsCommand([]string{"-server", mock.MockURL, "-s", "100.1"})
+	<-done
+	for _, e := range mock.Errors {
+		t.Fatal(e.Error())
+	}
+	if _, ok := err.(*comm.TransportError); !ok {
+		t.Fatalf("Expected the broken stream to fail the stats, but got %v", err)
+	}
+}
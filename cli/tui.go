@@ -0,0 +1,591 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell"
+	"github.com/logrusorgru/aurora"
+	"github.com/mattn/go-runewidth"
+	"github.com/theia-log/selene/comm"
+)
+
+// TUICommand implements the 'tui' subcommand.
+// Takes a list of arguments to the tui subcommand, parses it and then calls
+// RunTUI with the parsed flags.
+func TUICommand(args []string) error {
+	tuiFlags, flags := SetupTUIFlags()
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return RunTUI(tuiFlags)
+}
+
+// RunTUI opens a full-screen terminal view over the events on the server.
+// The past events matching the filter are looked up first, then, if the Live
+// flag is set, the view keeps receiving the real-time events.
+func RunTUI(flags *TUIFlags) error {
+	serverURL, err := flags.GetServerURL()
+	if err != nil {
+		return err
+	}
+	newClient, err := flags.ClientFactory()
+	if err != nil {
+		return err
+	}
+	filter, err := toQueryFilter(flags.QueryFlags)
+	if err != nil {
+		return err
+	}
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	if err = screen.Init(); err != nil {
+		return err
+	}
+	defer screen.Fini()
+
+	limit := 0
+	if flags.Limit != nil {
+		limit = *flags.Limit
+	}
+	view := newTUIView(screen, newEventBrowser(limit), newAuroraColors())
+	view.title = serverURL
+
+	client := newClient(serverURL)
+	go streamToScreen(screen, client, filter, flags.Live != nil && *flags.Live)
+
+	return view.Run()
+}
+
+// tuiStatus is posted to the screen event loop to change the status message.
+type tuiStatus string
+
+// streamToScreen looks up the past events and then optionally follows the
+// real-time events, posting every EventResponse to the screen event loop.
+func streamToScreen(screen tcell.Screen, client comm.Client, filter *comm.EventFilter, live bool) {
+	post := func(data interface{}) {
+		screen.PostEventWait(tcell.NewEventInterrupt(data))
+	}
+	forward := func(resp chan *comm.EventResponse) {
+		for event := range resp {
+			post(event)
+		}
+	}
+
+	post(tuiStatus("loading past events..."))
+	if !live {
+		resp, err := client.Find(filter)
+		if err != nil {
+			post(&comm.EventResponse{Error: err})
+			return
+		}
+		forward(resp)
+		post(tuiStatus("done"))
+		return
+	}
+
+	resp, err := comm.FollowAfter(client, filter, func() (chan *comm.EventResponse, error) {
+		return client.Find(filter)
+	}, func() {
+		post(tuiStatus("live"))
+	})
+	if err != nil {
+		post(&comm.EventResponse{Error: err})
+		return
+	}
+	forward(resp)
+	post(tuiStatus("connection closed"))
+}
+
+// tuiFocus is the UI pane that receives the keyboard input.
+type tuiFocus int
+
+const (
+	focusEvents tuiFocus = iota
+	focusTags
+	focusSearch
+)
+
+// tagsPaneWidth is the width of the tag facets pane.
+const tagsPaneWidth = 28
+
+// tuiView draws the eventBrowser on a tcell Screen and handles the keyboard
+// input.
+type tuiView struct {
+	screen     tcell.Screen
+	browser    *eventBrowser
+	colors     *AuroraColors
+	title      string
+	status     string
+	lastError  string
+	focus      tuiFocus
+	showDetail bool
+	tagIdx     int
+	search     string
+}
+
+func newTUIView(screen tcell.Screen, browser *eventBrowser, colors *AuroraColors) *tuiView {
+	return &tuiView{
+		screen:  screen,
+		browser: browser,
+		colors:  colors,
+	}
+}
+
+// Run runs the screen event loop until the user quits.
+func (v *tuiView) Run() error {
+	v.draw()
+	for {
+		switch ev := v.screen.PollEvent().(type) {
+		case nil:
+			return nil
+		case *tcell.EventResize:
+			v.screen.Sync()
+		case *tcell.EventKey:
+			if v.handleKey(ev) {
+				return nil
+			}
+		case *tcell.EventInterrupt:
+			v.handleData(ev.Data())
+		}
+		v.draw()
+	}
+}
+
+// handleData handles data posted to the event loop by the event stream.
+func (v *tuiView) handleData(data interface{}) {
+	switch d := data.(type) {
+	case *comm.EventResponse:
+		if d.Error != nil {
+			v.lastError = d.Error.Error()
+			return
+		}
+		v.browser.Push(d.Event)
+	case tuiStatus:
+		v.status = string(d)
+	}
+}
+
+// handleKey handles a key press. Returns true if the user asked to quit.
+func (v *tuiView) handleKey(ev *tcell.EventKey) bool {
+	if ev.Key() == tcell.KeyCtrlC {
+		return true
+	}
+	switch v.focus {
+	case focusSearch:
+		v.handleSearchKey(ev)
+		return false
+	case focusTags:
+		if v.handleTagsKey(ev) {
+			return false
+		}
+	}
+
+	switch ev.Key() {
+	case tcell.KeyUp:
+		v.browser.Move(-1)
+	case tcell.KeyDown:
+		v.browser.Move(1)
+	case tcell.KeyPgUp:
+		v.browser.Move(-v.listHeight())
+	case tcell.KeyPgDn:
+		v.browser.Move(v.listHeight())
+	case tcell.KeyHome:
+		v.browser.Home()
+	case tcell.KeyEnd:
+		v.browser.End()
+	case tcell.KeyEnter:
+		v.showDetail = !v.showDetail
+	case tcell.KeyTab:
+		if v.focus == focusTags {
+			v.focus = focusEvents
+		} else {
+			v.focus = focusTags
+		}
+	case tcell.KeyEscape:
+		if v.showDetail {
+			v.showDetail = false
+		} else {
+			v.browser.SetSearch("")
+		}
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'q':
+			return true
+		case 'k':
+			v.browser.Move(-1)
+		case 'j':
+			v.browser.Move(1)
+		case 'g':
+			v.browser.Home()
+		case 'G':
+			v.browser.End()
+		case ' ', 'p':
+			v.browser.TogglePause()
+		case '/':
+			v.focus = focusSearch
+			v.search = ""
+			v.browser.SetSearch("")
+		case 'n':
+			v.browser.NextMatch(1)
+		case 'N':
+			v.browser.NextMatch(-1)
+		}
+	}
+	return false
+}
+
+// handleSearchKey handles the input of the incremental search. The selection
+// jumps to the first match as the search term is typed.
+func (v *tuiView) handleSearchKey(ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyEnter:
+		v.focus = focusEvents
+		return
+	case tcell.KeyEscape:
+		v.focus = focusEvents
+		v.search = ""
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if r := []rune(v.search); len(r) > 0 {
+			v.search = string(r[:len(r)-1])
+		}
+	case tcell.KeyRune:
+		v.search += string(ev.Rune())
+	default:
+		return
+	}
+	v.browser.SetSearch(v.search)
+}
+
+// handleTagsKey handles the navigation in the tag facets pane. Returns false if
+// the key is not handled by the pane.
+func (v *tuiView) handleTagsKey(ev *tcell.EventKey) bool {
+	tags := v.browser.Tags()
+	switch ev.Key() {
+	case tcell.KeyUp:
+		v.tagIdx--
+	case tcell.KeyDown:
+		v.tagIdx++
+	case tcell.KeyEnter:
+		v.toggleSelectedTag(tags)
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'k':
+			v.tagIdx--
+		case 'j':
+			v.tagIdx++
+		case ' ', 'x':
+			v.toggleSelectedTag(tags)
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+	if v.tagIdx >= len(tags) {
+		v.tagIdx = len(tags) - 1
+	}
+	if v.tagIdx < 0 {
+		v.tagIdx = 0
+	}
+	return true
+}
+
+func (v *tuiView) toggleSelectedTag(tags []*tagFacet) {
+	if v.tagIdx >= 0 && v.tagIdx < len(tags) {
+		v.browser.ToggleTag(tags[v.tagIdx].Tag)
+	}
+}
+
+// layout calculates the areas of the screen: the width of the events list and
+// the height of the events list and the detail pane.
+func (v *tuiView) layout() (listWidth, listHeight, detailHeight int) {
+	width, height := v.screen.Size()
+	listWidth = width
+	if width > tagsPaneWidth*3 {
+		listWidth = width - tagsPaneWidth - 1
+	}
+	// header and status lines
+	listHeight = height - 2
+	if v.showDetail {
+		detailHeight = listHeight / 2
+		listHeight -= detailHeight
+	}
+	if listHeight < 0 {
+		listHeight = 0
+	}
+	return
+}
+
+func (v *tuiView) listHeight() int {
+	_, h, _ := v.layout()
+	return h
+}
+
+// draw redraws the whole screen.
+func (v *tuiView) draw() {
+	v.screen.Clear()
+	width, height := v.screen.Size()
+	listWidth, listHeight, detailHeight := v.layout()
+
+	v.drawHeader(width)
+	v.drawEvents(0, 1, listWidth, listHeight)
+	if listWidth < width {
+		v.drawTags(listWidth+1, 1, width-listWidth-1, height-2)
+	}
+	if detailHeight > 0 {
+		v.drawDetail(0, 1+listHeight, listWidth, detailHeight)
+	}
+	v.drawStatusLine(height-1, width)
+	v.screen.Show()
+}
+
+func (v *tuiView) drawHeader(width int) {
+	style := v.style("primary").Reverse(true)
+	stream := "LIVE"
+	if v.browser.Paused() {
+		stream = fmt.Sprintf("PAUSED (+%d)", v.browser.Pending())
+		if dropped := v.browser.Dropped(); dropped > 0 {
+			stream = fmt.Sprintf("PAUSED (+%d, %d dropped)", v.browser.Pending(), dropped)
+		}
+	}
+	header := fmt.Sprintf(" selene %s | %s | %d/%d events | %s", v.title, stream,
+		len(v.browser.Visible()), len(v.browser.events), v.status)
+	fill(v.screen, 0, 0, width, 1, style)
+	drawText(v.screen, 0, 0, width, header, style)
+}
+
+func (v *tuiView) drawEvents(x, y, width, height int) {
+	events := v.browser.Visible()
+	offset := v.browser.Scroll(height)
+	for row := 0; row < height && offset+row < len(events); row++ {
+		idx := offset + row
+		ev := events[idx]
+		selected := idx == v.browser.selected
+		col := x
+		put := func(text string, style tcell.Style) {
+			if selected {
+				style = style.Reverse(true)
+			}
+			col = drawText(v.screen, col, y+row, x+width-col, text, style)
+		}
+		if selected {
+			fill(v.screen, x, y+row, width, 1, tcell.StyleDefault.Reverse(true))
+		}
+		idShort := ev.ID
+		if len(idShort) > 7 {
+			idShort = idShort[0:7]
+		}
+		put(fmt.Sprintf("%7s ", idShort), v.style("secondary"))
+		put(fmt.Sprintf("[%f] ", ev.Timestamp), v.style("info"))
+		put(fmt.Sprintf("(%s) ", ev.Source), v.style("secondary"))
+		for _, tag := range ev.Tags {
+			put(tag, v.style(v.colors.TagColor(tag)))
+			put(" ", tcell.StyleDefault)
+		}
+		put("- ", tcell.StyleDefault)
+		contentStyle := v.style(v.colors.ContentColor(ev.Content))
+		if v.browser.Matches(ev) {
+			contentStyle = contentStyle.Underline(true)
+		}
+		put(singleLine(ev.Content), contentStyle)
+	}
+}
+
+func (v *tuiView) drawTags(x, y, width, height int) {
+	for row := 0; row < height; row++ {
+		v.screen.SetContent(x-1, y+row, tcell.RuneVLine, nil, tcell.StyleDefault)
+	}
+	title := v.style("secondary")
+	if v.focus == focusTags {
+		title = title.Reverse(true)
+	}
+	drawText(v.screen, x, y, width, " Tags (tab, space)", title)
+	for i, facet := range v.browser.Tags() {
+		if i+1 >= height {
+			break
+		}
+		mark := "[x]"
+		if facet.Excluded {
+			mark = "[ ]"
+		}
+		style := v.style(v.colors.TagColor(facet.Tag))
+		if v.focus == focusTags && i == v.tagIdx {
+			style = style.Reverse(true)
+		}
+		col := drawText(v.screen, x, y+i+1, width, fmt.Sprintf("%s %5d ", mark, facet.Count), tcell.StyleDefault)
+		drawText(v.screen, col, y+i+1, x+width-col, facet.Tag, style)
+	}
+}
+
+// detailLine is a labeled value shown in the event detail pane.
+type detailLine struct {
+	label string
+	value string
+	style tcell.Style
+}
+
+func (v *tuiView) drawDetail(x, y, width, height int) {
+	fill(v.screen, x, y, width, 1, v.style("secondary").Reverse(true))
+	drawText(v.screen, x, y, width, " Event detail (enter/esc to close)", v.style("secondary").Reverse(true))
+	ev := v.browser.Selected()
+	if ev == nil {
+		return
+	}
+	lines := []detailLine{
+		{"ID", ev.ID, v.style("secondary")},
+		{"Timestamp", fmt.Sprintf("%f", ev.Timestamp), v.style("info")},
+		{"Source", ev.Source, v.style("secondary")},
+		{"Tags", strings.Join(ev.Tags, ", "), tcell.StyleDefault},
+	}
+	keys := make([]string, 0, len(ev.Fields))
+	for key := range ev.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		lines = append(lines, detailLine{key, singleLine(ev.Fields[key]), tcell.StyleDefault})
+	}
+	row := y + 1
+	for _, line := range lines {
+		if row >= y+height {
+			return
+		}
+		col := drawText(v.screen, x, row, width, fmt.Sprintf("%-10s ", line.label+":"), tcell.StyleDefault.Bold(true))
+		drawText(v.screen, col, row, x+width-col, line.value, line.style)
+		row++
+	}
+	contentStyle := v.style(v.colors.ContentColor(ev.Content))
+	for _, line := range strings.Split(printableText(ev.Content), "\n") {
+		for {
+			if row >= y+height {
+				return
+			}
+			rest := drawWrapped(v.screen, x, row, width, line, contentStyle)
+			row++
+			if rest == "" {
+				break
+			}
+			line = rest
+		}
+	}
+}
+
+func (v *tuiView) drawStatusLine(y, width int) {
+	switch {
+	case v.focus == focusSearch:
+		col := drawText(v.screen, 0, y, width, "/", tcell.StyleDefault.Bold(true))
+		col = drawText(v.screen, col, y, width-col, v.search, tcell.StyleDefault)
+		v.screen.ShowCursor(col, y)
+		return
+	case v.lastError != "":
+		drawText(v.screen, 0, y, width, v.lastError, v.style("error"))
+	case v.browser.Search() != "":
+		drawText(v.screen, 0, y, width, fmt.Sprintf("search: %s (n/N next/previous match)", v.browser.Search()), v.style("info"))
+	default:
+		drawText(v.screen, 0, y, width,
+			"q:quit  space:pause  /:search  enter:detail  tab:tags  j/k:move  g/G:first/last",
+			v.style("secondary"))
+	}
+	v.screen.HideCursor()
+}
+
+// style converts a color from the AuroraColors palette to a tcell Style.
+func (v *tuiView) style(colorName string) tcell.Style {
+	style := tcell.StyleDefault
+	if colorName == "" {
+		return style
+	}
+	color, ok := v.colors.PaletteColor(colorName)
+	if !ok {
+		return style
+	}
+	return auroraStyle(color)
+}
+
+// auroraStyle converts an aurora Color to tcell Style. The aurora foreground
+// and background colors are the 8 basic terminal colors, which map directly to
+// the first 8 tcell colors.
+func auroraStyle(color aurora.Color) tcell.Style {
+	style := tcell.StyleDefault
+	if fg := (color >> 8) & 0xff; fg != 0 {
+		style = style.Foreground(tcell.Color(fg - 1))
+	}
+	if bg := (color >> 16) & 0xff; bg != 0 {
+		style = style.Background(tcell.Color(bg - 1))
+	}
+	if color&aurora.BoldFm != 0 {
+		style = style.Bold(true)
+	}
+	if color&aurora.InverseFm != 0 {
+		style = style.Reverse(true)
+	}
+	return style
+}
+
+// singleLine replaces the line breaks and other control characters in the
+// text so it can be shown on a single row.
+func singleLine(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == '\t' {
+			return ' '
+		}
+		if unicode.IsControl(r) {
+			return '.'
+		}
+		return r
+	}, strings.TrimRight(text, "\n"))
+}
+
+// drawText draws the text on a single row, starting at column x, clipped to the
+// given width. Returns the column right after the last drawn character.
+func drawText(screen tcell.Screen, x, y, width int, text string, style tcell.Style) int {
+	end := x + width
+	for _, r := range text {
+		w := runewidth.RuneWidth(r)
+		if w == 0 {
+			continue
+		}
+		if x+w > end {
+			break
+		}
+		screen.SetContent(x, y, r, nil, style)
+		x += w
+	}
+	return x
+}
+
+// drawWrapped draws as much of the text as it fits in the row and returns the
+// rest of the text that did not fit.
+func drawWrapped(screen tcell.Screen, x, y, width int, text string, style tcell.Style) string {
+	if width <= 0 {
+		return ""
+	}
+	col := x
+	for i, r := range text {
+		if unicode.IsControl(r) {
+			r = '.'
+		}
+		w := runewidth.RuneWidth(r)
+		if col+w > x+width && col > x {
+			return text[i:]
+		}
+		screen.SetContent(col, y, r, nil, style)
+		col += w
+	}
+	return ""
+}
+
+// fill fills an area of the screen with blanks in the given style.
+func fill(screen tcell.Screen, x, y, width, height int, style tcell.Style) {
+	for row := y; row < y+height; row++ {
+		for col := x; col < x+width; col++ {
+			screen.SetContent(col, row, ' ', nil, style)
+		}
+	}
+}
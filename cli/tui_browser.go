@@ -0,0 +1,343 @@
+package cli
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/theia-log/selene/model"
+)
+
+// defaultBrowserLimit is the default maximal number of events kept in memory
+// by the terminal UI.
+const defaultBrowserLimit = 10000
+
+// tagFacet holds a tag name and the number of events (currently held in the
+// browser) that carry that tag.
+type tagFacet struct {
+	Tag      string
+	Count    int
+	Excluded bool
+}
+
+// eventBrowser holds the state of the terminal UI event list: the received
+// events, the events visible after applying the tag facets, the current
+// selection and scroll position, the pause state of the live stream and the
+// incremental search.
+// The browser does not know anything about the terminal and is not safe for
+// concurrent use - all calls are expected to come from the UI event loop.
+type eventBrowser struct {
+	events    []*model.Event
+	visible   []*model.Event
+	seen      map[string]bool
+	limit     int
+	paused    bool
+	pending   []*model.Event
+	dropped   int
+	excluded  map[string]bool
+	tagCounts map[string]int
+	search    string
+	selected  int
+	offset    int
+	follow    bool
+}
+
+// newEventBrowser creates new eventBrowser that keeps at most limit events in
+// memory. If limit is not positive, defaultBrowserLimit is used.
+func newEventBrowser(limit int) *eventBrowser {
+	if limit <= 0 {
+		limit = defaultBrowserLimit
+	}
+	return &eventBrowser{
+		events:    []*model.Event{},
+		visible:   []*model.Event{},
+		seen:      map[string]bool{},
+		limit:     limit,
+		excluded:  map[string]bool{},
+		tagCounts: map[string]int{},
+		follow:    true,
+	}
+}
+
+// Push adds an event to the browser. If the browser is paused, the event is
+// held back until the stream is resumed. At most limit events are held back,
+// the oldest are dropped. Events with an ID that has already been seen are
+// ignored.
+func (b *eventBrowser) Push(ev *model.Event) {
+	if b.paused {
+		b.pending = append(b.pending, ev)
+		if len(b.pending) > b.limit {
+			b.pending = b.pending[1:]
+			b.dropped++
+		}
+		return
+	}
+	b.add(ev)
+}
+
+func (b *eventBrowser) add(ev *model.Event) {
+	if ev.ID != "" {
+		if b.seen[ev.ID] {
+			return
+		}
+		b.seen[ev.ID] = true
+	}
+	b.events = append(b.events, ev)
+	for _, tag := range ev.Tags {
+		b.tagCounts[tag]++
+	}
+	if len(b.events) > b.limit {
+		b.drop(b.events[0])
+		b.events = b.events[1:]
+	}
+	if b.isVisible(ev) {
+		b.visible = append(b.visible, ev)
+	}
+	if b.follow {
+		b.selected = len(b.visible) - 1
+	}
+	b.clampSelection()
+}
+
+// drop removes the bookkeeping for an event that is about to be evicted.
+func (b *eventBrowser) drop(ev *model.Event) {
+	delete(b.seen, ev.ID)
+	for _, tag := range ev.Tags {
+		b.tagCounts[tag]--
+		if b.tagCounts[tag] <= 0 {
+			delete(b.tagCounts, tag)
+		}
+	}
+	if len(b.visible) > 0 && b.visible[0] == ev {
+		b.visible = b.visible[1:]
+		b.selected--
+		b.offset--
+	}
+}
+
+// isVisible checks if the event passes the tag facets. An event is hidden if
+// any of its tags has been excluded.
+func (b *eventBrowser) isVisible(ev *model.Event) bool {
+	for _, tag := range ev.Tags {
+		if b.excluded[tag] {
+			return false
+		}
+	}
+	return true
+}
+
+// refresh recalculates the list of visible events, trying to keep the current
+// event selected.
+func (b *eventBrowser) refresh() {
+	current := b.Selected()
+	b.visible = []*model.Event{}
+	b.selected = 0
+	for _, ev := range b.events {
+		if !b.isVisible(ev) {
+			continue
+		}
+		if ev == current {
+			b.selected = len(b.visible)
+		}
+		b.visible = append(b.visible, ev)
+	}
+	if b.follow {
+		b.selected = len(b.visible) - 1
+	}
+	b.clampSelection()
+}
+
+func (b *eventBrowser) clampSelection() {
+	if b.selected >= len(b.visible) {
+		b.selected = len(b.visible) - 1
+	}
+	if b.selected < 0 {
+		b.selected = 0
+	}
+	if b.offset < 0 {
+		b.offset = 0
+	}
+}
+
+// Visible returns the list of events that pass the tag facets.
+func (b *eventBrowser) Visible() []*model.Event {
+	return b.visible
+}
+
+// Selected returns the currently selected event, or nil if there are no
+// visible events.
+func (b *eventBrowser) Selected() *model.Event {
+	if b.selected < 0 || b.selected >= len(b.visible) {
+		return nil
+	}
+	return b.visible[b.selected]
+}
+
+// Move moves the selection by delta rows. Moving to the last row turns on
+// following of the new events.
+func (b *eventBrowser) Move(delta int) {
+	b.selected += delta
+	b.clampSelection()
+	b.follow = b.selected >= len(b.visible)-1
+}
+
+// Home selects the first visible event.
+func (b *eventBrowser) Home() {
+	b.selected = 0
+	b.follow = len(b.visible) <= 1
+}
+
+// End selects the last visible event and follows the new events.
+func (b *eventBrowser) End() {
+	b.selected = len(b.visible) - 1
+	b.clampSelection()
+	b.follow = true
+}
+
+// Scroll adjusts the scroll offset so that the selected event is shown in a
+// view with the given height. Returns the index of the first visible event to
+// be shown.
+func (b *eventBrowser) Scroll(height int) int {
+	if height <= 0 {
+		return b.offset
+	}
+	if b.selected < b.offset {
+		b.offset = b.selected
+	}
+	if b.selected >= b.offset+height {
+		b.offset = b.selected - height + 1
+	}
+	if max := len(b.visible) - height; b.offset > max {
+		b.offset = max
+	}
+	if b.offset < 0 {
+		b.offset = 0
+	}
+	return b.offset
+}
+
+// Paused returns true if the live stream is paused.
+func (b *eventBrowser) Paused() bool {
+	return b.paused
+}
+
+// Pending returns the number of events held back while paused.
+func (b *eventBrowser) Pending() int {
+	return len(b.pending)
+}
+
+// Dropped returns the number of events dropped while paused, because too
+// many events were held back.
+func (b *eventBrowser) Dropped() int {
+	return b.dropped
+}
+
+// TogglePause pauses or resumes the stream of events. On resume, the events
+// held back while paused are added to the browser.
+func (b *eventBrowser) TogglePause() {
+	b.paused = !b.paused
+	if b.paused {
+		return
+	}
+	pending := b.pending
+	b.pending = nil
+	b.dropped = 0
+	for _, ev := range pending {
+		b.add(ev)
+	}
+}
+
+// Tags returns the tag facets sorted by number of events, then by name.
+func (b *eventBrowser) Tags() []*tagFacet {
+	facets := []*tagFacet{}
+	for tag, count := range b.tagCounts {
+		facets = append(facets, &tagFacet{
+			Tag:      tag,
+			Count:    count,
+			Excluded: b.excluded[tag],
+		})
+	}
+	for tag := range b.excluded {
+		if _, ok := b.tagCounts[tag]; !ok {
+			facets = append(facets, &tagFacet{Tag: tag, Excluded: true})
+		}
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Tag < facets[j].Tag
+	})
+	return facets
+}
+
+// ToggleTag excludes the tag from the view, or includes it back if it has
+// already been excluded.
+func (b *eventBrowser) ToggleTag(tag string) {
+	if b.excluded[tag] {
+		delete(b.excluded, tag)
+	} else {
+		b.excluded[tag] = true
+	}
+	b.refresh()
+}
+
+// Search returns the current search term.
+func (b *eventBrowser) Search() string {
+	return b.search
+}
+
+// SetSearch sets the search term and selects the first matching event at or
+// after the current selection. Returns false if no event matches.
+func (b *eventBrowser) SetSearch(term string) bool {
+	b.search = term
+	if term == "" {
+		return true
+	}
+	return b.findMatch(b.selected, 1)
+}
+
+// NextMatch selects the next (dir > 0) or the previous (dir < 0) event that
+// matches the search term. The search wraps around the list of events.
+// Returns false if no event matches.
+func (b *eventBrowser) NextMatch(dir int) bool {
+	if b.search == "" {
+		return false
+	}
+	if dir < 0 {
+		return b.findMatch(b.selected-1, -1)
+	}
+	return b.findMatch(b.selected+1, 1)
+}
+
+func (b *eventBrowser) findMatch(from, dir int) bool {
+	n := len(b.visible)
+	for i := 0; i < n; i++ {
+		idx := ((from+dir*i)%n + n) % n
+		if b.Matches(b.visible[idx]) {
+			b.selected = idx
+			b.follow = idx == n-1
+			return true
+		}
+	}
+	return false
+}
+
+// Matches checks if the event matches the current search term. The term is
+// looked up, case insensitive, in the event ID, source, tags and content.
+func (b *eventBrowser) Matches(ev *model.Event) bool {
+	if b.search == "" {
+		return false
+	}
+	term := strings.ToLower(b.search)
+	if strings.Contains(strings.ToLower(ev.Content), term) ||
+		strings.Contains(strings.ToLower(ev.Source), term) ||
+		strings.Contains(strings.ToLower(ev.ID), term) {
+		return true
+	}
+	for _, tag := range ev.Tags {
+		if strings.Contains(strings.ToLower(tag), term) {
+			return true
+		}
+	}
+	return false
+}
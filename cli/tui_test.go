@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell"
+	"github.com/logrusorgru/aurora"
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+)
+
+func browserEvent(id string, content string, tags ...string) *model.Event {
+	return &model.Event{
+		ID:        id,
+		Timestamp: 1551733035.23,
+		Source:    "/src",
+		Tags:      tags,
+		Content:   content,
+	}
+}
+
+func TestEventBrowserPushAndFollow(t *testing.T) {
+	browser := newEventBrowser(3)
+
+	for i := 0; i < 5; i++ {
+		browser.Push(browserEvent(fmt.Sprintf("id-%d", i), "content", "tag"))
+	}
+	browser.Push(browserEvent("id-4", "duplicate"))
+
+	if len(browser.Visible()) != 3 {
+		t.Fatalf("Expected the browser to keep 3 events, but got %d", len(browser.Visible()))
+	}
+	if browser.Visible()[0].ID != "id-2" {
+		t.Fatal("Expected the oldest events to be discarded.")
+	}
+	if browser.Selected() == nil || browser.Selected().ID != "id-4" {
+		t.Fatal("Expected the browser to follow the last event.")
+	}
+	if browser.Tags()[0].Count != 3 {
+		t.Fatal("Expected the tag counts to be updated on discarded events.")
+	}
+
+	browser.Move(-1)
+	browser.Push(browserEvent("id-5", "content"))
+	if browser.Selected().ID != "id-3" {
+		t.Fatal("Expected the selection to stay in place when not following.")
+	}
+}
+
+func TestEventBrowserPause(t *testing.T) {
+	browser := newEventBrowser(0)
+	browser.Push(browserEvent("id-1", "content"))
+
+	browser.TogglePause()
+	browser.Push(browserEvent("id-2", "content"))
+	browser.Push(browserEvent("id-3", "content"))
+
+	if len(browser.Visible()) != 1 || browser.Pending() != 2 {
+		t.Fatal("Expected the events to be held back while paused.")
+	}
+
+	browser.TogglePause()
+	if len(browser.Visible()) != 3 || browser.Pending() != 0 {
+		t.Fatal("Expected the pending events to be added on resume.")
+	}
+}
+
+func TestEventBrowserPause_limit(t *testing.T) {
+	browser := newEventBrowser(2)
+	browser.TogglePause()
+	for _, id := range []string{"id-1", "id-2", "id-3", "id-4"} {
+		browser.Push(browserEvent(id, "content"))
+	}
+	if browser.Pending() != 2 || browser.Dropped() != 2 {
+		t.Fatalf("Expected 2 pending and 2 dropped events, but got %d and %d", browser.Pending(), browser.Dropped())
+	}
+
+	browser.TogglePause()
+	visible := browser.Visible()
+	if len(visible) != 2 || visible[0].ID != "id-3" || visible[1].ID != "id-4" {
+		t.Fatalf("Expected the newest events to be kept, but got %v", visible)
+	}
+	if browser.Dropped() != 0 {
+		t.Fatal("Expected the dropped count to be reset on resume.")
+	}
+}
+
+func TestEventBrowserToggleTag(t *testing.T) {
+	browser := newEventBrowser(0)
+	browser.Push(browserEvent("id-1", "content", "db", "error"))
+	browser.Push(browserEvent("id-2", "content", "api"))
+	browser.Push(browserEvent("id-3", "content", "db"))
+
+	browser.ToggleTag("db")
+	if len(browser.Visible()) != 1 || browser.Visible()[0].ID != "id-2" {
+		t.Fatal("Expected events tagged with excluded tag to be hidden.")
+	}
+	tags := browser.Tags()
+	if tags[0].Tag != "db" || !tags[0].Excluded {
+		t.Fatal("Expected the 'db' facet to be first and excluded.")
+	}
+
+	browser.ToggleTag("db")
+	if len(browser.Visible()) != 3 {
+		t.Fatal("Expected all events to be visible again.")
+	}
+}
+
+func TestEventBrowserSearch(t *testing.T) {
+	browser := newEventBrowser(0)
+	browser.Push(browserEvent("id-1", "connection timeout"))
+	browser.Push(browserEvent("id-2", "all good"))
+	browser.Push(browserEvent("id-3", "another TIMEOUT"))
+	browser.Home()
+
+	if !browser.SetSearch("timeout") || browser.Selected().ID != "id-1" {
+		t.Fatal("Expected to select the first match.")
+	}
+	if !browser.NextMatch(1) || browser.Selected().ID != "id-3" {
+		t.Fatal("Expected to select the next match.")
+	}
+	if !browser.NextMatch(1) || browser.Selected().ID != "id-1" {
+		t.Fatal("Expected the search to wrap around.")
+	}
+	if !browser.NextMatch(-1) || browser.Selected().ID != "id-3" {
+		t.Fatal("Expected to select the previous match.")
+	}
+	if browser.SetSearch("nothing") {
+		t.Fatal("Expected no match.")
+	}
+}
+
+func TestEventBrowserScroll(t *testing.T) {
+	browser := newEventBrowser(0)
+	for i := 0; i < 10; i++ {
+		browser.Push(browserEvent(fmt.Sprintf("id-%d", i), "content"))
+	}
+	if offset := browser.Scroll(4); offset != 6 {
+		t.Fatalf("Expected offset 6 when following, got %d", offset)
+	}
+	browser.Home()
+	if offset := browser.Scroll(4); offset != 0 {
+		t.Fatalf("Expected offset 0 at the top, got %d", offset)
+	}
+}
+
+func TestAuroraStyle(t *testing.T) {
+	style := auroraStyle(aurora.RedBg | aurora.BrownFg | aurora.BoldFm)
+	fg, bg, attr := style.Decompose()
+	if fg != tcell.ColorOlive || bg != tcell.ColorMaroon {
+		t.Fatalf("Colors not converted properly: fg=%v, bg=%v", fg, bg)
+	}
+	if attr&tcell.AttrBold == 0 {
+		t.Fatal("Expected bold style.")
+	}
+}
+
+func screenLine(screen tcell.SimulationScreen, y int) string {
+	cells, width, _ := screen.GetContents()
+	line := []rune{}
+	for x := 0; x < width; x++ {
+		line = append(line, cells[y*width+x].Runes...)
+	}
+	return string(line)
+}
+
+func TestTUIView(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	screen.SetSize(120, 20)
+
+	view := newTUIView(screen, newEventBrowser(0), newAuroraColors())
+	view.handleData(&comm.EventResponse{Event: browserEvent("id-0001", "first event", "db")})
+	view.handleData(&comm.EventResponse{Event: browserEvent("id-0002", "second event", "api")})
+	view.draw()
+
+	if !strings.Contains(screenLine(screen, 1), "first event") ||
+		!strings.Contains(screenLine(screen, 2), "second event") {
+		t.Fatal("Expected the events to be drawn.")
+	}
+
+	view.handleKey(tcell.NewEventKey(tcell.KeyRune, '/', tcell.ModNone))
+	for _, r := range "first" {
+		view.handleKey(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+	}
+	view.handleKey(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone))
+	if view.browser.Selected().ID != "id-0001" {
+		t.Fatal("Expected the incremental search to select the first event.")
+	}
+
+	view.handleKey(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone))
+	view.draw()
+	found := false
+	for y := 0; y < 20; y++ {
+		if strings.Contains(screenLine(screen, y), "ID:        id-0001") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("Expected the detail pane to show the event ID.")
+	}
+
+	view.handleKey(tcell.NewEventKey(tcell.KeyRune, ' ', tcell.ModNone))
+	view.handleData(&comm.EventResponse{Event: browserEvent("id-0003", "third event")})
+	if len(view.browser.Visible()) != 2 {
+		t.Fatal("Expected the stream to be paused.")
+	}
+
+	if !view.handleKey(tcell.NewEventKey(tcell.KeyRune, 'q', tcell.ModNone)) {
+		t.Fatal("Expected 'q' to quit.")
+	}
+}
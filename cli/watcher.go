@@ -1,17 +1,18 @@
 package cli
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"regexp"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
-	uuid "github.com/satori/go.uuid"
 	"github.com/theia-log/selene/model"
 
-	"github.com/theia-log/selene/comm"
 	"github.com/theia-log/selene/watcher"
 )
 
@@ -36,25 +37,77 @@ func RunWatcher(args *WatcherFlags) error {
 	if err != nil {
 		return err
 	}
-	client := comm.NewWebsocketClient(serverURL)
+	newClient, err := args.ClientFactory()
+	if err != nil {
+		return err
+	}
+	client, err := newPublishClient(serverURL, args.PublishFlags, newClient)
+	if err != nil {
+		return err
+	}
 
 	tags := []string{}
 	if args.Tags != nil && len(args.Tags) > 0 {
 		tags = args.Tags
 	}
 
-	source.OnSourceEvent(func(src string, diff []byte) {
-		ev := &model.Event{
-			ID:        uuid.Must(uuid.NewV4()).String(),
-			Source:    src,
-			Tags:      tags,
-			Timestamp: float64(time.Now().UnixNano()) / float64(time.Millisecond),
-			Content:   string(diff),
-		}
-		if err := client.Send(ev); err != nil {
-			log.Println("Failed to send event ", err.Error())
+	fields, err := parseFields(args.Fields)
+	if err != nil {
+		return err
+	}
+	extract, err := compileExtractor(asString(args.Extract))
+	if err != nil {
+		return err
+	}
+
+	maxSize := 0
+	if args.MaxSize != nil {
+		maxSize = *args.MaxSize
+	}
+	truncate := isSet(args.Truncate)
+
+	ids, err := model.NewIDGenerator(asString(args.IDStrategy))
+	if err != nil {
+		return err
+	}
+
+	handler := func(src string, offset int64, diff []byte) {
+		timestamp := float64(time.Now().UnixNano()) / float64(time.Millisecond)
+		parts, marker := limitContent(diff, maxSize, truncate)
+		for i, part := range parts {
+			ev := &model.Event{
+				Source:    src,
+				Tags:      tags,
+				Timestamp: timestamp,
+			}
+			ev.SetContentBytes(part)
+			ev.Fields = extractFields(fields, extract, part)
+			if marker != "" {
+				ev.Tags = append(append([]string{}, tags...), marker)
+			}
+			if marker == SplitTag {
+				if ev.Fields == nil {
+					ev.Fields = map[string]string{}
+				}
+				ev.Fields["part"] = fmt.Sprintf("%d/%d", i+1, len(parts))
+			}
+			ev.ID = ids.NewID(ev, offset)
+			if offset >= 0 {
+				offset += int64(len(part))
+			}
+			if err := client.Send(ev); err != nil {
+				log.Println("Failed to send event ", err.Error())
+			}
 		}
-	})
+	}
+	if offsetSource, ok := source.(watcher.OffsetEventSource); ok {
+		offsetSource.OnSourceEventAt(handler)
+	} else {
+		// the position of the changes is not known
+		source.OnSourceEvent(func(src string, diff []byte) {
+			handler(src, -1, diff)
+		})
+	}
 
 	if err := daemon.Start(); err != nil {
 		return err
@@ -88,3 +141,114 @@ func WatcherCommand(args []string) error {
 	}
 	return RunWatcher(watcherFlags)
 }
+
+// Marker tags attached to the events generated from diffs larger than the
+// maximal event size.
+const (
+	// TruncatedTag marks an event with truncated content.
+	TruncatedTag = "truncated"
+
+	// SplitTag marks an event that holds only a part of the diff. The "part"
+	// field holds the number of the part and the total number of parts, like
+	// "2/5".
+	SplitTag = "split"
+)
+
+// limitContent limits the size of the content of the generated events to
+// maxSize bytes. If the content is larger, it is either truncated, or split
+// into multiple parts. The content is split on the last new line that fits in
+// the part, or if there is none, on a UTF-8 character boundary.
+// Returns the parts and the marker tag (TruncatedTag or SplitTag), or the
+// content as the only part and an empty marker if the content fits.
+func limitContent(content []byte, maxSize int, truncate bool) ([][]byte, string) {
+	if maxSize <= 0 || len(content) <= maxSize {
+		return [][]byte{content}, ""
+	}
+	if truncate {
+		return [][]byte{content[:splitPoint(content, maxSize, false)]}, TruncatedTag
+	}
+	parts := [][]byte{}
+	for len(content) > maxSize {
+		end := splitPoint(content, maxSize, true)
+		parts = append(parts, content[:end])
+		content = content[end:]
+	}
+	if len(content) > 0 {
+		parts = append(parts, content)
+	}
+	return parts, SplitTag
+}
+
+// splitPoint finds where to cut the content so that the first part is at most
+// maxSize bytes long. If onNewLine is set, the content is cut after the last
+// new line, if there is one. Otherwise it is cut on a UTF-8 character
+// boundary, so multi-byte characters are not broken.
+func splitPoint(content []byte, maxSize int, onNewLine bool) int {
+	if onNewLine {
+		if idx := bytes.LastIndexByte(content[:maxSize], '\n'); idx >= 0 {
+			return idx + 1
+		}
+	}
+	// content[end] is the first byte of the next part, so it must be a
+	// beginning of a character
+	end := maxSize
+	for i := 0; i < utf8.UTFMax && end > 0 && !utf8.RuneStart(content[end]); i++ {
+		end--
+	}
+	if end == 0 || !utf8.RuneStart(content[end]) {
+		// not UTF-8 text, cut anywhere
+		return maxSize
+	}
+	return end
+}
+
+// compileExtractor compiles the regular expression used to extract fields from
+// the event content. The names of the named groups are used as field keys, so
+// they must be valid field keys.
+func compileExtractor(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	extract, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	named := 0
+	for _, name := range extract.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if err = model.ValidateFieldKey(name); err != nil {
+			return nil, err
+		}
+		named++
+	}
+	if named == 0 {
+		return nil, fmt.Errorf("no named groups in extract pattern: %s", pattern)
+	}
+	return extract, nil
+}
+
+// extractFields builds the fields for an event: the static fields, plus the
+// values of the named groups matched by the extract regular expression in the
+// content. Groups that did not match are not added.
+func extractFields(fields map[string]string, extract *regexp.Regexp, content []byte) map[string]string {
+	result := copyFields(fields)
+	if extract == nil {
+		return result
+	}
+	match := extract.FindSubmatchIndex(content)
+	if match == nil {
+		return result
+	}
+	for i, name := range extract.SubexpNames() {
+		if name == "" || match[2*i] < 0 {
+			continue
+		}
+		if result == nil {
+			result = map[string]string{}
+		}
+		result[name] = string(content[match[2*i]:match[2*i+1]])
+	}
+	return result
+}
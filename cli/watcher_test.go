@@ -90,3 +90,65 @@ func TestWatcherCommand(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestExtractFields(t *testing.T) {
+	extract, err := compileExtractor(`user=(?P<user>\w+)( ip=(?P<ip>[\d.]+))?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	static := map[string]string{"env": "prod"}
+
+	fields := extractFields(static, extract, []byte("login user=jdoe ip=10.0.0.1"))
+	if fields["env"] != "prod" || fields["user"] != "jdoe" || fields["ip"] != "10.0.0.1" {
+		t.Fatalf("Fields not extracted properly: %v", fields)
+	}
+
+	fields = extractFields(static, extract, []byte("login user=jdoe"))
+	if _, ok := fields["ip"]; ok || fields["user"] != "jdoe" {
+		t.Fatalf("Fields not extracted properly: %v", fields)
+	}
+
+	fields = extractFields(static, extract, []byte("no match"))
+	if len(fields) != 1 {
+		t.Fatalf("Expected only the static fields, but got: %v", fields)
+	}
+	fields["env"] = "changed"
+	if static["env"] != "prod" {
+		t.Fatal("Static fields must not be modified.")
+	}
+
+	for _, invalid := range []string{`(`, `(\w+)`, `(?P<id>\w+)`} {
+		if _, err = compileExtractor(invalid); err == nil {
+			t.Fatalf("Expected error for extract pattern %q", invalid)
+		}
+	}
+}
+
+func TestLimitContent(t *testing.T) {
+	parts, marker := limitContent([]byte("small"), 10, false)
+	if len(parts) != 1 || marker != "" {
+		t.Fatalf("Small content must not be split: %q %s", parts, marker)
+	}
+
+	parts, marker = limitContent([]byte("line1\nline2\nline3\n"), 13, false)
+	if marker != SplitTag || len(parts) != 2 || string(parts[0]) != "line1\nline2\n" || string(parts[1]) != "line3\n" {
+		t.Fatalf("Content not split on new lines: %q %s", parts, marker)
+	}
+
+	parts, marker = limitContent([]byte("abcdefghij"), 4, false)
+	if marker != SplitTag || len(parts) != 3 || string(parts[2]) != "ij" {
+		t.Fatalf("Content without new lines not split properly: %q %s", parts, marker)
+	}
+
+	// "č" is two bytes long and must not be broken
+	parts, marker = limitContent([]byte("abččč"), 5, true)
+	if marker != TruncatedTag || len(parts) != 1 || string(parts[0]) != "abč" {
+		t.Fatalf("Content not truncated properly: %q %s", parts, marker)
+	}
+
+	binary := []byte{0x80, 0x81, 0x82, 0x83, 0x84, 0x85}
+	parts, _ = limitContent(binary, 4, false)
+	if len(parts) != 2 || len(parts[0]) != 4 {
+		t.Fatalf("Binary content not split properly: %q", parts)
+	}
+}
@@ -135,3 +135,12 @@ type Client interface {
 	// matching events have been returned to the client.
 	Find(filter *EventFilter) (chan *EventResponse, error)
 }
+
+// CloseClient closes the client, if it can be closed. All clients in this
+// package can be closed.
+func CloseClient(client Client) error {
+	if closer, ok := client.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
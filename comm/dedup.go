@@ -0,0 +1,109 @@
+package comm
+
+import (
+	"container/list"
+	"time"
+)
+
+// DefaultDedupSize is the default number of event IDs remembered by a
+// Deduplicator.
+const DefaultDedupSize = 10000
+
+// Deduplicator remembers the IDs of the recently seen events, so the events
+// that arrive more than once can be detected.
+// At most size IDs are remembered; when full, the least recently seen ID is
+// forgotten. If window is set, the IDs are also forgotten once they have not
+// been seen for longer than the window.
+// A Deduplicator is not safe for concurrent use.
+type Deduplicator struct {
+	size    int
+	window  time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+	now     func() time.Time
+}
+
+// dedupEntry is a remembered event ID, with the time it was last seen.
+type dedupEntry struct {
+	id   string
+	seen time.Time
+}
+
+// NewDeduplicator creates a new Deduplicator that remembers up to size event
+// IDs (DefaultDedupSize if size is not positive) for the duration of window.
+// If window is zero, the IDs are forgotten only when the Deduplicator is full.
+func NewDeduplicator(size int, window time.Duration) *Deduplicator {
+	if size <= 0 {
+		size = DefaultDedupSize
+	}
+	return &Deduplicator{
+		size:    size,
+		window:  window,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// Seen records the event ID and returns true if the ID has already been seen
+// within the window. Empty IDs are never reported as seen.
+func (d *Deduplicator) Seen(id string) bool {
+	if id == "" {
+		return false
+	}
+	now := d.now()
+	d.expire(now)
+
+	if elem, ok := d.entries[id]; ok {
+		elem.Value.(*dedupEntry).seen = now
+		d.order.MoveToFront(elem)
+		return true
+	}
+
+	d.entries[id] = d.order.PushFront(&dedupEntry{id: id, seen: now})
+	if d.order.Len() > d.size {
+		d.remove(d.order.Back())
+	}
+	return false
+}
+
+// Len returns the number of the remembered IDs.
+func (d *Deduplicator) Len() int {
+	return d.order.Len()
+}
+
+// expire forgets the IDs that have not been seen within the window.
+func (d *Deduplicator) expire(now time.Time) {
+	if d.window <= 0 {
+		return
+	}
+	for elem := d.order.Back(); elem != nil; elem = d.order.Back() {
+		if now.Sub(elem.Value.(*dedupEntry).seen) <= d.window {
+			return
+		}
+		d.remove(elem)
+	}
+}
+
+func (d *Deduplicator) remove(elem *list.Element) {
+	d.order.Remove(elem)
+	delete(d.entries, elem.Value.(*dedupEntry).id)
+}
+
+// Dedup filters out the duplicate events from the EventResponse channel, as
+// detected by the Deduplicator. Returns a new EventResponse channel that
+// publishes every event only once. Errors are passed through unchanged.
+// The returned channel is closed once the input channel is closed.
+func Dedup(resp chan *EventResponse, dedup *Deduplicator) chan *EventResponse {
+	result := make(chan *EventResponse)
+	go func() {
+		defer close(result)
+		for event := range resp {
+			if event.Event != nil && dedup.Seen(event.Event.ID) {
+				continue
+			}
+			result <- event
+		}
+	}()
+	return result
+}
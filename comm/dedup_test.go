@@ -0,0 +1,78 @@
+package comm
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/theia-log/selene/model"
+)
+
+func TestDeduplicator_size(t *testing.T) {
+	dedup := NewDeduplicator(2, 0)
+	for _, id := range []string{"a", "b"} {
+		if dedup.Seen(id) {
+			t.Fatalf("%s was not seen before", id)
+		}
+	}
+	if !dedup.Seen("a") {
+		t.Fatal("Expected a to be seen.")
+	}
+	// b is the least recently seen, so it is forgotten
+	dedup.Seen("c")
+	if dedup.Len() != 2 {
+		t.Fatalf("Expected 2 remembered IDs, but got %d", dedup.Len())
+	}
+	if !dedup.Seen("a") {
+		t.Fatal("Expected a to be remembered.")
+	}
+	if dedup.Seen("b") {
+		t.Fatal("Expected b to be forgotten.")
+	}
+	if dedup.Seen("") || dedup.Seen("") {
+		t.Fatal("Empty IDs must never be seen.")
+	}
+}
+
+func TestDeduplicator_window(t *testing.T) {
+	now := time.Unix(1000, 0)
+	dedup := NewDeduplicator(0, time.Minute)
+	dedup.now = func() time.Time {
+		return now
+	}
+
+	dedup.Seen("a")
+	now = now.Add(30 * time.Second)
+	dedup.Seen("b")
+	now = now.Add(40 * time.Second)
+	if dedup.Seen("a") {
+		t.Fatal("Expected a to expire.")
+	}
+	if !dedup.Seen("b") {
+		t.Fatal("Expected b to be remembered.")
+	}
+}
+
+func TestDedup(t *testing.T) {
+	resp := make(chan *EventResponse)
+	go func() {
+		defer close(resp)
+		for _, id := range []string{"1", "2", "1", "3", "2"} {
+			resp <- &EventResponse{Event: &model.Event{ID: id}}
+		}
+		resp <- &EventResponse{Error: fmt.Errorf("error")}
+	}()
+
+	ids := ""
+	errors := 0
+	for event := range Dedup(resp, NewDeduplicator(10, 0)) {
+		if event.Error != nil {
+			errors++
+			continue
+		}
+		ids += event.Event.ID
+	}
+	if ids != "123" || errors != 1 {
+		t.Fatalf("Expected events 123 and one error, but got %s and %d errors", ids, errors)
+	}
+}
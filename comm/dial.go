@@ -0,0 +1,163 @@
+package comm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultDialTimeout is the default time limit for connecting to the server,
+// including the websocket handshake.
+const DefaultDialTimeout = 45 * time.Second
+
+// ProxyFunc selects the proxy for a request, the same as the Proxy of
+// http.Transport. If it returns nil, or the ProxyFunc itself is nil, the
+// connection is made directly.
+type ProxyFunc func(req *http.Request) (*url.URL, error)
+
+// ParseProxy returns the ProxyFunc for the proxy URL: http://host:port for an
+// HTTP CONNECT proxy, or socks5://[user:password@]host:port for a SOCKS5
+// proxy. The connections to localhost are never proxied.
+// If proxy is empty, the proxy is taken from the environment, the same as the
+// clients do by default. "direct" disables the proxy.
+func ParseProxy(proxy string) (ProxyFunc, error) {
+	switch proxy {
+	case "":
+		return proxyFromEnvironment, nil
+	case "direct":
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %s", proxy, err.Error())
+	}
+	if (proxyURL.Scheme != "http" && proxyURL.Scheme != "socks5") || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: expected http://host:port or socks5://host:port", proxy)
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if isLocalhost(req.URL.Hostname()) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+// proxyFromEnvironment selects the proxy from HTTPS_PROXY, HTTP_PROXY and
+// NO_PROXY, the same way as the standard HTTP client does. If none of the
+// first two is set, the SOCKS5 proxy in ALL_PROXY is used, for the hosts that
+// are not excluded by NO_PROXY.
+func proxyFromEnvironment(req *http.Request) (*url.URL, error) {
+	if proxyURL, err := http.ProxyFromEnvironment(req); proxyURL != nil || err != nil {
+		return proxyURL, err
+	}
+	if getenv("HTTPS_PROXY") != "" || getenv("HTTP_PROXY") != "" {
+		// excluded by NO_PROXY
+		return nil, nil
+	}
+	allProxy := getenv("ALL_PROXY")
+	host := req.URL.Hostname()
+	if allProxy == "" || isLocalhost(host) || noProxy(host) {
+		return nil, nil
+	}
+	return url.Parse(allProxy)
+}
+
+// getenv returns the value of the environment variable, given in upper case,
+// or of its lower case variant.
+func getenv(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return os.Getenv(strings.ToLower(name))
+}
+
+// noProxy checks if the host is excluded from proxying by NO_PROXY: "*", an IP
+// address or a network (CIDR), or a domain name, which excludes its
+// subdomains as well. The ports in NO_PROXY are ignored.
+func noProxy(host string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, entry := range strings.Split(getenv("NO_PROXY"), ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "*" {
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if entryHost, _, err := net.SplitHostPort(entry); err == nil {
+			entry = entryHost
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if entry != "" && (host == entry || strings.HasSuffix(host, "."+entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalhost checks if the host is the local machine.
+func isLocalhost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// unixSocket returns the socket path of a unix:// server URL, for example
+// unix:///var/run/theia.sock.
+func unixSocket(serverURL string) (string, bool) {
+	if !strings.HasPrefix(serverURL, "unix://") {
+		return "", false
+	}
+	return strings.TrimPrefix(serverURL, "unix://"), true
+}
+
+// newDialer creates the websocket dialer with the default dial options. If
+// socket is set, the connections are made to the unix socket instead.
+// The dialer negotiates per-message deflate compression with the server.
+// Servers that do not support compression simply ignore the offer.
+func newDialer(socket string) *websocket.Dialer {
+	dialer := &websocket.Dialer{
+		Proxy:             proxyFromEnvironment,
+		HandshakeTimeout:  DefaultDialTimeout,
+		EnableCompression: true,
+	}
+	if socket != "" {
+		dialer.Proxy = nil
+		dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+	}
+	return dialer
+}
+
+// newTransport creates the HTTP transport with the default dial options.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFromEnvironment
+	setDialTimeout(transport, DefaultDialTimeout)
+	return transport
+}
+
+// setDialTimeout sets the time limit for connecting to the server and the TLS
+// handshake of the transport.
+func setDialTimeout(transport *http.Transport, timeout time.Duration) {
+	transport.DialContext = (&net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = timeout
+}
@@ -116,4 +116,59 @@
 //			log.Println(resp.Event.Dump())	// print the event
 //		}
 //	}
+//
+// Filters can also be written in the selene query language. The parts of the
+// query that theia understands are sent to the server as EventFilter, and the
+// rest of the query is evaluated on the received events:
+//	respChan, err := comm.FindQuery(client,
+//		"tag:db AND (content:/timeout/ OR source:api*) AND time>-1h")
+//
+// The connections are pinged periodically, and the unused /event connection is
+// closed after a while. The defaults suit most servers, but can be changed:
+//	client := comm.NewWebsocketClient("ws://localhost:6433").
+//		Keepalive(15*time.Second, 5*time.Second).
+//		IdleTimeout(time.Minute)
+//	defer client.Close()
+//
+// Where websockets are not allowed, the HTTPClient talks to the server over
+// plain HTTP instead. NewClient selects the client by the URL scheme:
+//	client := comm.NewClient("http://localhost:6433")	// HTTPClient
+//	client = comm.NewClient("ws://localhost:6433")		// WebsocketClient
+//
+// When the same event may arrive more than once (for example after
+// reconnecting), the duplicates can be skipped by the event ID:
+//	respChan = comm.Dedup(respChan, comm.NewDeduplicator(10000, time.Hour))
+//
+// An EventFilter can be evaluated locally as well, with the same semantics as
+// on the server, for example to filter the events before sending them:
+//	if filter.Matches(event) {
+//		client.Send(event)
+//	}
+//
+// To publish the events to multiple servers, the clients can be combined in a
+// FanOutClient, which replicates the events to all servers, or fails over to
+// the next server when the first one is down. Routes send some of the events to
+// dedicated servers:
+//	client, err := comm.NewFanOutClient(comm.FanOutFailover,
+//		comm.NewWebsocketClient("ws://primary:6433"),
+//		comm.NewWebsocketClient("ws://secondary:6433"))
+//	client.Route(&comm.Route{
+//		Filter: comm.Filter(0).MatchTag("^security$"),
+//		Client: comm.NewWebsocketClient("ws://security:6433"),
+//	})
+//
+// To spread the load over multiple replicas of a server, a ClientPool keeps a
+// few connections to every replica and balances the events between them:
+//	pool, err := comm.NewClientPool([]string{"ws://theia-1:6433", "ws://theia-2:6433"},
+//		&comm.PoolOptions{Balance: comm.BalanceLeastInFlight})
+//	defer pool.Close()
+//
+// The clients connect through the proxy from the environment (HTTPS_PROXY,
+// HTTP_PROXY, NO_PROXY or ALL_PROXY), or through the proxy set on the client.
+// A local server can be reached over a unix socket as well:
+//	proxy, err := comm.ParseProxy("socks5://proxy:1080")
+//	client := comm.NewWebsocketClient("wss://theia:6433").Proxy(proxy).DialTimeout(10 * time.Second)
+//	local := comm.NewClient("unix:///var/run/theia.sock")
+// The ClientPool creates its clients with PoolOptions.NewClient, so the pooled
+// connections can be set up the same way.
 package comm
@@ -0,0 +1,88 @@
+package comm
+
+import (
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// ServerError is an error reported by the Theia server, for example when the
+// filter is not valid.
+type ServerError struct {
+	// Message is the error message sent by the server.
+	Message string
+
+	// Payload is the raw message received from the server.
+	Payload []byte
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error: %s", e.Message)
+}
+
+// TransportError is an error in the connection to the server: the connection
+// cannot be opened, or a message cannot be sent or received.
+type TransportError struct {
+	// Op is the operation that failed: dial, write or read.
+	Op string
+
+	// URL is the URL of the server endpoint.
+	URL string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Op, e.URL, e.Err.Error())
+}
+
+// Unwrap returns the underlying error.
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError is returned when a message received from the server is not a
+// valid event. The connection is still usable, and the following events may
+// be received normally.
+type DecodeError struct {
+	// Payload is the raw message that could not be decoded.
+	Payload []byte
+
+	// Err is the underlying error, usually one of the model parse errors.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cannot decode event: %s", e.Err.Error())
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ClosedError is returned when the connection is closed, either by the server
+// or by the client (see WebsocketClient.Close). No more events are received
+// after this error.
+type ClosedError struct {
+	// Code is the websocket close code, if the server closed the connection.
+	Code int
+
+	// Reason is the reason for closing the connection.
+	Reason string
+}
+
+func (e *ClosedError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("connection closed (%d): %s", e.Code, e.Reason)
+	}
+	return fmt.Sprintf("connection closed: %s", e.Reason)
+}
+
+// IsStreamEnd checks if the error is the normal end of a stream: the server
+// closed the connection properly after the last event.
+func IsStreamEnd(err error) bool {
+	closedErr, ok := err.(*ClosedError)
+	return ok && closedErr.Code == websocket.CloseNormalClosure
+}
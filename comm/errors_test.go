@@ -0,0 +1,97 @@
+package comm
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/theia-log/selene/model"
+)
+
+func TestGetServerError(t *testing.T) {
+	data := &theiaData{data: []byte(`{"error": "invalid filter: 100%d"}`)}
+	err := data.GetServerError()
+	serverErr, ok := err.(*ServerError)
+	if !ok {
+		t.Fatalf("Expected ServerError, but got %v", err)
+	}
+	if serverErr.Message != "invalid filter: 100%d" {
+		t.Fatalf("Server message not preserved: %q", serverErr.Message)
+	}
+	if string(serverErr.Payload) != string(data.data) {
+		t.Fatal("Payload not preserved.")
+	}
+
+	if err = (&theiaData{data: []byte("event:0 0 0\n")}).GetServerError(); err != nil {
+		t.Fatalf("Expected no server error, but got %v", err)
+	}
+}
+
+func TestReadError(t *testing.T) {
+	err := readError("ws://host/find", &websocket.CloseError{Code: websocket.CloseNormalClosure, Text: "done"}, false)
+	if closed, ok := err.(*ClosedError); !ok || closed.Code != websocket.CloseNormalClosure || closed.Reason != "done" {
+		t.Fatalf("Expected ClosedError, but got %v", err)
+	}
+
+	cause := errors.New("use of closed network connection")
+	if _, ok := readError("ws://host/find", cause, true).(*ClosedError); !ok {
+		t.Fatal("Expected ClosedError when closed by the client.")
+	}
+
+	err = readError("ws://host/find", cause, false)
+	if transportErr, ok := err.(*TransportError); !ok || transportErr.Op != "read" || !errors.Is(err, cause) {
+		t.Fatalf("Expected TransportError, but got %v", err)
+	}
+
+	err = readError("ws://host/find", &websocket.CloseError{Code: websocket.CloseAbnormalClosure}, false)
+	if _, ok := err.(*TransportError); !ok {
+		t.Fatalf("Expected TransportError for abnormal closure, but got %v", err)
+	}
+}
+
+func TestWebsocketClientFind_decodeError(t *testing.T) {
+	mock := NewWebsocketMock().
+		Respond("not an event")
+
+	client := NewWebsocketClient(mock.MockURL)
+	resp, err := client.Find(Filter(10.0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.WaitRequestsToComplete(1)
+
+	event := <-resp
+	var decodeErr *DecodeError
+	if !errors.As(event.Error, &decodeErr) {
+		t.Fatalf("Expected DecodeError, but got %v", event.Error)
+	}
+	if string(decodeErr.Payload) != "not an event" {
+		t.Fatalf("Payload not preserved: %q", decodeErr.Payload)
+	}
+	if !errors.Is(event.Error, model.ErrInvalidPreamble) {
+		t.Fatalf("Expected the model error to be wrapped, but got %v", event.Error)
+	}
+
+	client.Close()
+	for event = range resp {
+		if _, ok := event.Error.(*ClosedError); !ok {
+			t.Fatalf("Expected ClosedError, but got %v", event.Error)
+		}
+	}
+}
+
+func TestWebsocketClientSend_transportError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client := NewWebsocketClient("ws://" + addr)
+	err = client.Send(&model.Event{ID: "1"})
+	if transportErr, ok := err.(*TransportError); !ok || transportErr.Op != "dial" {
+		t.Fatalf("Expected TransportError, but got %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package comm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/theia-log/selene/model"
+)
+
+// Fan-out modes, as accepted by NewFanOutClient.
+const (
+	// FanOutReplicate sends every event to all servers.
+	FanOutReplicate = "replicate"
+
+	// FanOutFailover sends every event to the first server that is up. The
+	// servers are tried in the order in which they were given.
+	FanOutFailover = "failover"
+)
+
+// DefaultFailback is the default time after which the FanOutClient in
+// failover mode tries the primary server again.
+const DefaultFailback = 30 * time.Second
+
+// Route sends the events that match to a dedicated server.
+type Route struct {
+	// Filter matches the events by time, tags and content. Optional.
+	Filter *EventFilter
+
+	// Source is a pattern that the event source must match. Optional.
+	Source *regexp.Regexp
+
+	// Client is the client to the server that receives the matching events.
+	Client Client
+}
+
+// Matches checks if the event should be sent over this route.
+func (r *Route) Matches(ev *model.Event) bool {
+	if r.Filter != nil && !r.Filter.Matches(ev) {
+		return false
+	}
+	if r.Source != nil && !r.Source.MatchString(ev.Source) {
+		return false
+	}
+	return true
+}
+
+// FanOutError is returned by FanOutClient when the event could not be sent to
+// some of the servers, or when no server could serve a query.
+type FanOutError struct {
+	// Errors holds the error from every server that failed.
+	Errors []error
+}
+
+func (e *FanOutError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("%d server(s) failed: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the first error.
+func (e *FanOutError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors[0]
+}
+
+// FanOutClient is a Client that publishes the events to multiple Theia
+// servers.
+// The events that match a route are sent to the clients of all matching
+// routes. All other events are sent to the default clients: to all of them
+// in FanOutReplicate mode, or to the first one that is up in FanOutFailover
+// mode.
+// Find and Receive are served by the first default client that is up, in both
+// modes.
+// The FanOutClient is safe for concurrent use, as long as the underlying
+// clients are.
+type FanOutClient struct {
+	mode     string
+	clients  []Client
+	routes   []*Route
+	failback time.Duration
+
+	mux      sync.Mutex
+	active   int
+	failedAt time.Time
+	now      func() time.Time
+}
+
+// NewFanOutClient creates a new FanOutClient with the given mode
+// (FanOutReplicate or FanOutFailover) and default clients. In failover mode,
+// the first client is the primary.
+func NewFanOutClient(mode string, clients ...Client) (*FanOutClient, error) {
+	if mode != FanOutReplicate && mode != FanOutFailover {
+		return nil, fmt.Errorf("unknown fan-out mode: %s", mode)
+	}
+	return &FanOutClient{
+		mode:     mode,
+		clients:  clients,
+		failback: DefaultFailback,
+		now:      time.Now,
+	}, nil
+}
+
+// Route adds a route. The events that match the route are sent to its client
+// instead of the default clients.
+// Returns pointer to this FanOutClient.
+func (f *FanOutClient) Route(route *Route) *FanOutClient {
+	f.routes = append(f.routes, route)
+	return f
+}
+
+// Failback sets the time after which the primary client is tried again, once
+// the FanOutClient has failed over to another client.
+// Returns pointer to this FanOutClient.
+func (f *FanOutClient) Failback(after time.Duration) *FanOutClient {
+	f.failback = after
+	return f
+}
+
+// Send publishes the event to the servers selected by the routes and the
+// mode. Returns a *FanOutError if the event could not be sent to some of the
+// servers.
+func (f *FanOutClient) Send(event *model.Event) error {
+	routed := []Client{}
+	for _, route := range f.routes {
+		if route.Matches(event) {
+			routed = append(routed, route.Client)
+		}
+	}
+	if len(routed) > 0 {
+		return sendAll(routed, event)
+	}
+
+	if f.mode == FanOutReplicate {
+		return sendAll(f.clients, event)
+	}
+	return f.withFailover(func(client Client) error {
+		return client.Send(event)
+	})
+}
+
+// Receive opens a channel for real-time events on the first default client
+// that is up.
+func (f *FanOutClient) Receive(filter *EventFilter) (chan *EventResponse, error) {
+	var resp chan *EventResponse
+	err := f.withFailover(func(client Client) (err error) {
+		resp, err = client.Receive(filter)
+		return err
+	})
+	return resp, err
+}
+
+// Find looks up past events on the first default client that is up.
+func (f *FanOutClient) Find(filter *EventFilter) (chan *EventResponse, error) {
+	var resp chan *EventResponse
+	err := f.withFailover(func(client Client) (err error) {
+		resp, err = client.Find(filter)
+		return err
+	})
+	return resp, err
+}
+
+// Close closes all default and routed clients that can be closed.
+func (f *FanOutClient) Close() error {
+	var closeErr error
+	closed := map[Client]bool{}
+	clients := append([]Client{}, f.clients...)
+	for _, route := range f.routes {
+		clients = append(clients, route.Client)
+	}
+	for _, client := range clients {
+		closer, ok := client.(interface{ Close() error })
+		if !ok || closed[client] {
+			continue
+		}
+		closed[client] = true
+		if err := closer.Close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
+
+// sendAll sends the event to all clients.
+func sendAll(clients []Client, event *model.Event) error {
+	errs := []error{}
+	for _, client := range clients {
+		if err := client.Send(event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return &FanOutError{Errors: errs}
+	}
+	return nil
+}
+
+// withFailover calls op with the active client. If it fails, the following
+// clients are tried in order, and the first one that succeeds becomes the
+// active client. After the failback time, the primary client is tried first
+// again.
+func (f *FanOutClient) withFailover(op func(client Client) error) error {
+	if len(f.clients) == 0 {
+		return fmt.Errorf("no servers")
+	}
+	f.mux.Lock()
+	if f.active != 0 && f.now().Sub(f.failedAt) >= f.failback {
+		f.active = 0
+	}
+	start := f.active
+	f.mux.Unlock()
+
+	errs := []error{}
+	for i := 0; i < len(f.clients); i++ {
+		index := (start + i) % len(f.clients)
+		err := op(f.clients[index])
+		if err == nil {
+			if index != start {
+				f.mux.Lock()
+				f.active = index
+				f.failedAt = f.now()
+				f.mux.Unlock()
+			}
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return &FanOutError{Errors: errs}
+}
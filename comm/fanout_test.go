@@ -0,0 +1,161 @@
+package comm
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/theia-log/selene/model"
+)
+
+// recordingClient records the sent events, and fails when down.
+type recordingClient struct {
+	name    string
+	down    bool
+	sent    []string
+	queries int
+	closed  bool
+}
+
+var errDown = errors.New("server down")
+
+func (c *recordingClient) Send(event *model.Event) error {
+	if c.down {
+		return errDown
+	}
+	c.sent = append(c.sent, event.ID)
+	return nil
+}
+
+func (c *recordingClient) Receive(filter *EventFilter) (chan *EventResponse, error) {
+	return c.Find(filter)
+}
+
+func (c *recordingClient) Find(filter *EventFilter) (chan *EventResponse, error) {
+	if c.down {
+		return nil, errDown
+	}
+	c.queries++
+	resp := make(chan *EventResponse, 1)
+	resp <- &EventResponse{Event: &model.Event{ID: c.name}}
+	close(resp)
+	return resp, nil
+}
+
+func (c *recordingClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func assertSent(t *testing.T, client *recordingClient, expected ...string) {
+	if len(client.sent) != len(expected) {
+		t.Fatalf("%s: expected events %v, but got %v", client.name, expected, client.sent)
+	}
+	for i, id := range expected {
+		if client.sent[i] != id {
+			t.Fatalf("%s: expected events %v, but got %v", client.name, expected, client.sent)
+		}
+	}
+}
+
+func TestNewFanOutClient_invalidMode(t *testing.T) {
+	if _, err := NewFanOutClient("broadcast"); err == nil {
+		t.Fatal("Expected error for unknown mode.")
+	}
+}
+
+func TestFanOutClient_replicate(t *testing.T) {
+	first, second := &recordingClient{name: "first"}, &recordingClient{name: "second"}
+	client, err := NewFanOutClient(FanOutReplicate, first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Send(&model.Event{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	second.down = true
+	err = client.Send(&model.Event{ID: "2"})
+	var fanOutErr *FanOutError
+	if !errors.As(err, &fanOutErr) || len(fanOutErr.Errors) != 1 || !errors.Is(err, errDown) {
+		t.Fatalf("Expected FanOutError for the second server, but got %v", err)
+	}
+	assertSent(t, first, "1", "2")
+	assertSent(t, second, "1")
+}
+
+func TestFanOutClient_failover(t *testing.T) {
+	primary, secondary := &recordingClient{name: "primary"}, &recordingClient{name: "secondary"}
+	client, err := NewFanOutClient(FanOutFailover, primary, secondary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	client.now = func() time.Time { return now }
+
+	client.Send(&model.Event{ID: "1"})
+	primary.down = true
+	client.Send(&model.Event{ID: "2"})
+	primary.down = false
+	// stays on the secondary until the failback time
+	client.Send(&model.Event{ID: "3"})
+	now = now.Add(DefaultFailback)
+	client.Send(&model.Event{ID: "4"})
+
+	assertSent(t, primary, "1", "4")
+	assertSent(t, secondary, "2", "3")
+
+	primary.down, secondary.down = true, true
+	if err = client.Send(&model.Event{ID: "5"}); err == nil {
+		t.Fatal("Expected error when all servers are down.")
+	}
+}
+
+func TestFanOutClient_routes(t *testing.T) {
+	main, security, audit := &recordingClient{name: "main"}, &recordingClient{name: "security"}, &recordingClient{name: "audit"}
+	client, err := NewFanOutClient(FanOutReplicate, main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Route(&Route{Filter: Filter(0).MatchTag("^security$"), Client: security}).
+		Route(&Route{Source: regexp.MustCompile("^/var/log/auth"), Client: audit})
+
+	client.Send(&model.Event{ID: "1", Tags: []string{"app"}, Source: "/var/log/app.log"})
+	client.Send(&model.Event{ID: "2", Tags: []string{"security"}, Source: "/var/log/app.log"})
+	client.Send(&model.Event{ID: "3", Tags: []string{"security"}, Source: "/var/log/auth.log"})
+	client.Send(&model.Event{ID: "4", Source: "/var/log/auth.log"})
+
+	assertSent(t, main, "1")
+	assertSent(t, security, "2", "3")
+	assertSent(t, audit, "3", "4")
+
+	if err = client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !main.closed || !security.closed || !audit.closed {
+		t.Fatal("Expected all clients to be closed.")
+	}
+}
+
+func TestFanOutClient_queries(t *testing.T) {
+	primary, secondary := &recordingClient{name: "primary", down: true}, &recordingClient{name: "secondary"}
+	client, err := NewFanOutClient(FanOutReplicate, primary, secondary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []func(*EventFilter) (chan *EventResponse, error){client.Find, client.Receive} {
+		resp, err := query(Filter(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event := <-resp; event.Event == nil || event.Event.ID != "secondary" {
+			t.Fatalf("Expected the query to be served by the secondary, but got %v", event)
+		}
+	}
+
+	secondary.down = true
+	if _, err = client.Find(Filter(0)); err == nil {
+		t.Fatal("Expected error when all servers are down.")
+	}
+}
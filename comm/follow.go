@@ -0,0 +1,112 @@
+package comm
+
+// Follow looks up the past events that match the filter, and once all past
+// events have been returned, seamlessly switches to receiving the real-time
+// events.
+// The real-time stream is opened before the past events are looked up, so no
+// event published in between is lost. The real-time events are buffered until
+// all past events have been returned. The real-time events before the
+// timestamp of the last seen past event are skipped, and the events at that
+// exact timestamp that were already returned are detected by event ID and
+// skipped as well.
+func Follow(client Client, filter *EventFilter) (chan *EventResponse, error) {
+	return FollowAfter(client, filter, func() (chan *EventResponse, error) {
+		return client.Find(filter)
+	}, nil)
+}
+
+// FollowAfter publishes the past events returned by find and then switches to
+// the real-time events that match the filter, the same way as Follow does.
+// This is useful when the past events are obtained in some other way, for
+// example when only the last N events should be shown before following.
+// find is called only after the real-time stream has been opened. If
+// pastDone is set, it is called once all past events have been published.
+func FollowAfter(client Client, filter *EventFilter, find func() (chan *EventResponse, error), pastDone func()) (chan *EventResponse, error) {
+	live, err := client.Receive(&EventFilter{
+		Start:   filter.Start,
+		Tags:    filter.Tags,
+		Content: filter.Content,
+	})
+	if err != nil {
+		return nil, err
+	}
+	live = bufferResponses(live)
+
+	past, err := find()
+	if err != nil {
+		// the real-time stream ends when the client is closed
+		go func() {
+			for range live {
+			}
+		}()
+		return nil, err
+	}
+
+	resp := make(chan *EventResponse)
+	go func() {
+		defer close(resp)
+
+		lastTimestamp := filter.Start
+		boundary := map[string]bool{}
+
+		for event := range past {
+			if event.Event != nil {
+				ts := event.Event.Timestamp
+				if ts > lastTimestamp {
+					lastTimestamp = ts
+					boundary = map[string]bool{}
+				}
+				if ts == lastTimestamp {
+					boundary[event.Event.ID] = true
+				}
+			}
+			resp <- event
+		}
+		if pastDone != nil {
+			pastDone()
+		}
+
+		skipping := true
+		for event := range live {
+			if event.Event != nil && skipping {
+				ts := event.Event.Timestamp
+				if ts > lastTimestamp {
+					// past the boundary, no more duplicates are possible
+					skipping = false
+				} else if ts < lastTimestamp || boundary[event.Event.ID] {
+					continue
+				}
+			}
+			resp <- event
+		}
+	}()
+	return resp, nil
+}
+
+// bufferResponses queues the responses as they arrive, until they are read
+// from the returned channel, so that the producer is never blocked.
+func bufferResponses(in chan *EventResponse) chan *EventResponse {
+	out := make(chan *EventResponse)
+	go func() {
+		defer close(out)
+		queue := []*EventResponse{}
+		for in != nil || len(queue) > 0 {
+			var send chan *EventResponse
+			var next *EventResponse
+			if len(queue) > 0 {
+				send, next = out, queue[0]
+			}
+			select {
+			case event, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				queue = append(queue, event)
+			case send <- next:
+				queue = queue[1:]
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,112 @@
+package comm
+
+import (
+	"testing"
+
+	"github.com/theia-log/selene/model"
+)
+
+// staticClient is a Client that returns prepared events on Find and Receive.
+type staticClient struct {
+	past          []*model.Event
+	live          []*model.Event
+	receiveFilter *EventFilter
+	calls         string
+}
+
+func (c *staticClient) Send(event *model.Event) error {
+	return nil
+}
+
+func (c *staticClient) stream(events []*model.Event) chan *EventResponse {
+	resp := make(chan *EventResponse, len(events))
+	for _, ev := range events {
+		resp <- &EventResponse{Event: ev}
+	}
+	close(resp)
+	return resp
+}
+
+func (c *staticClient) Receive(filter *EventFilter) (chan *EventResponse, error) {
+	c.receiveFilter = filter
+	c.calls += "receive "
+	return c.stream(c.live), nil
+}
+
+func (c *staticClient) Find(filter *EventFilter) (chan *EventResponse, error) {
+	c.calls += "find "
+	return c.stream(c.past), nil
+}
+
+func TestFollow(t *testing.T) {
+	client := &staticClient{
+		past: []*model.Event{
+			{ID: "1", Timestamp: 10},
+			{ID: "2", Timestamp: 20},
+			{ID: "3", Timestamp: 20},
+		},
+		live: []*model.Event{
+			{ID: "1", Timestamp: 10},
+			{ID: "3", Timestamp: 20},
+			{ID: "4", Timestamp: 20},
+			{ID: "5", Timestamp: 30},
+			{ID: "2", Timestamp: 20},
+		},
+	}
+
+	resp, err := Follow(client, Filter(5).MatchTag("tag"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := ""
+	for event := range resp {
+		if event.Error != nil {
+			t.Fatal(event.Error)
+		}
+		ids += event.Event.ID
+	}
+
+	if ids != "123452" {
+		t.Fatalf("Expected events 123452, but got %s", ids)
+	}
+	if client.calls != "receive find " {
+		t.Fatalf("Expected the live stream to be opened before the lookup, but got %q", client.calls)
+	}
+	if client.receiveFilter.Start != 5 {
+		t.Fatal("Expected to receive live events from the filter start.")
+	}
+	if len(client.receiveFilter.Tags) != 1 {
+		t.Fatal("Expected the live filter to keep the tag patterns.")
+	}
+}
+
+func TestFollowAfter_pastDone(t *testing.T) {
+	client := &staticClient{
+		past: []*model.Event{{ID: "1", Timestamp: 10}},
+		live: []*model.Event{{ID: "2", Timestamp: 20}},
+	}
+	pastDone := make(chan struct{})
+	resp, err := FollowAfter(client, Filter(0), func() (chan *EventResponse, error) {
+		return client.Find(Filter(0))
+	}, func() {
+		close(pastDone)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := ""
+	for event := range resp {
+		if event.Event.ID == "2" {
+			select {
+			case <-pastDone:
+			default:
+				t.Fatal("Expected the callback before the live events.")
+			}
+		}
+		ids += event.Event.ID
+	}
+	if ids != "12" {
+		t.Fatalf("Expected events 12, but got %s", ids)
+	}
+}
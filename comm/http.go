@@ -0,0 +1,341 @@
+package comm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/theia-log/selene/model"
+)
+
+// Content types of the HTTP transport.
+const (
+	// EventsContentType is the content type of a body with one or more events
+	// in the same preamble-framed format as the events sent over websockets,
+	// separated by a new line.
+	EventsContentType = "application/x-theia-events"
+
+	// EventStreamContentType is the content type of a server-sent events
+	// stream.
+	EventStreamContentType = "text/event-stream"
+)
+
+// maxErrorSize is the maximal size of an error response that is read.
+const maxErrorSize = 64 * 1024
+
+// HTTPClient implements the Client interface over plain HTTP, for the
+// environments where websockets are not allowed through the proxies.
+// The endpoints are the same as the websocket endpoints:
+//   - POST /event publishes one or more events, in EventsContentType;
+//   - POST /find with the EventFilter JSON streams back the past events, in
+//     EventsContentType, with chunked transfer encoding;
+//   - POST /live with the EventFilter JSON streams the real-time events as
+//     server-sent events. Every event is the data of one message; errors are
+//     sent as messages of type "error", with the same JSON as over websockets.
+//
+// The server reports invalid requests with an error status and a JSON body,
+// {"error": "message"}, which is returned as *ServerError.
+// The HTTPClient is safe for concurrent use. The settings (Proxy and
+// DialTimeout) must be set before the client is used.
+type HTTPClient struct {
+	baseURL   string
+	transport *http.Transport
+	client    *http.Client
+
+	mux     sync.Mutex
+	nextID  uint64
+	streams map[uint64]context.CancelFunc
+}
+
+// NewHTTPClient creates new HTTP Client to theia server on the given server
+// URL (http:// or https://).
+func NewHTTPClient(serverURL string) *HTTPClient {
+	transport := newTransport()
+	return &HTTPClient{
+		baseURL:   strings.TrimSuffix(serverURL, "/"),
+		transport: transport,
+		client:    &http.Client{Transport: transport},
+		streams:   map[uint64]context.CancelFunc{},
+	}
+}
+
+// Proxy sets the proxy to connect through. By default, the proxy is taken from
+// the environment (see ParseProxy).
+// Returns pointer to this HTTPClient.
+func (h *HTTPClient) Proxy(proxy ProxyFunc) *HTTPClient {
+	h.transport.Proxy = proxy
+	return h
+}
+
+// DialTimeout sets the time limit for connecting to the server, including the
+// TLS handshake. Zero means no limit.
+// Returns pointer to this HTTPClient.
+func (h *HTTPClient) DialTimeout(timeout time.Duration) *HTTPClient {
+	setDialTimeout(h.transport, timeout)
+	return h
+}
+
+// NewClient creates a Client to theia server, selected by the URL scheme:
+// HTTPClient for http:// and https://, WebsocketClient otherwise.
+func NewClient(serverURL string) Client {
+	if strings.HasPrefix(serverURL, "http://") || strings.HasPrefix(serverURL, "https://") {
+		return NewHTTPClient(serverURL)
+	}
+	return NewWebsocketClient(serverURL)
+}
+
+// Send publishes an event to the server.
+func (h *HTTPClient) Send(event *model.Event) error {
+	return h.SendBatch([]*model.Event{event})
+}
+
+// SendBatch publishes multiple events to the server in a single request.
+// The server decodes the whole request before storing the events, so if any
+// event is invalid, none of them is stored.
+func (h *HTTPClient) SendBatch(events []*model.Event) error {
+	var body bytes.Buffer
+	encoder := model.NewEncoder(&body)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	url := h.baseURL + "/event"
+	req, err := http.NewRequest(http.MethodPost, url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", EventsContentType)
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return &TransportError{Op: "post", URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return responseError(resp)
+	}
+	// drain the body, so the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// Receive opens a stream of real-time events that match the EventFilter.
+func (h *HTTPClient) Receive(filter *EventFilter) (chan *EventResponse, error) {
+	return h.query("live", filter, EventStreamContentType, readEventStream)
+}
+
+// Find looks up past events that match the given EventFilter.
+func (h *HTTPClient) Find(filter *EventFilter) (chan *EventResponse, error) {
+	return h.query("find", filter, EventsContentType, readEvents)
+}
+
+// query posts the filter to the endpoint, and reads the events from the
+// response body with the given reader. The stream can be cancelled with
+// Close.
+func (h *HTTPClient) query(endpoint string, filter *EventFilter, accept string, read func(url string, body io.Reader, emit func(*EventResponse)) error) (chan *EventResponse, error) {
+	filterData, err := filter.DumpBytes()
+	if err != nil {
+		return nil, err
+	}
+	url := h.baseURL + "/" + endpoint
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(filterData))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+
+	id := h.track(cancel)
+	resp, err := h.client.Do(req)
+	if err != nil {
+		h.untrack(id)
+		return nil, &TransportError{Op: "post", URL: url, Err: err}
+	}
+	if resp.StatusCode/100 != 2 {
+		defer h.untrack(id)
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+
+	eventChan := make(chan *EventResponse)
+	go func() {
+		defer close(eventChan)
+		defer h.untrack(id)
+		defer resp.Body.Close()
+		err := read(url, resp.Body, func(event *EventResponse) {
+			eventChan <- event
+		})
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			eventChan <- &EventResponse{Error: &ClosedError{Reason: "client closed"}}
+		default:
+			eventChan <- &EventResponse{Error: err}
+		}
+	}()
+	return eventChan, nil
+}
+
+// track keeps the cancel function of a stream until the stream ends, so that
+// Close can cancel it.
+func (h *HTTPClient) track(cancel context.CancelFunc) uint64 {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.nextID++
+	h.streams[h.nextID] = cancel
+	return h.nextID
+}
+
+// untrack releases the resources of a stream that ended.
+func (h *HTTPClient) untrack(id uint64) {
+	h.mux.Lock()
+	cancel, ok := h.streams[id]
+	delete(h.streams, id)
+	h.mux.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// Close cancels all open streams and closes the idle connections. The
+// streams opened with Find and Receive end with a *ClosedError. The client
+// can be reused after Close.
+func (h *HTTPClient) Close() error {
+	h.mux.Lock()
+	streams := h.streams
+	h.streams = map[uint64]context.CancelFunc{}
+	h.mux.Unlock()
+	for _, cancel := range streams {
+		cancel()
+	}
+	h.transport.CloseIdleConnections()
+	return nil
+}
+
+// responseError converts an error response into a *ServerError.
+func responseError(resp *http.Response) error {
+	payload, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorSize))
+	errMap := map[string]string{}
+	if err := json.Unmarshal(payload, &errMap); err == nil && errMap["error"] != "" {
+		return &ServerError{Message: errMap["error"], Payload: payload}
+	}
+	return &ServerError{Message: resp.Status, Payload: payload}
+}
+
+// readEvents reads the events from a body in EventsContentType. A frame that
+// cannot be decoded ends the stream, as the following frames cannot be
+// located reliably.
+func readEvents(url string, body io.Reader, emit func(*EventResponse)) error {
+	decoder := model.NewDecoder(body)
+	for {
+		ev := &model.Event{}
+		err := decoder.Decode(ev)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var frameErr *model.FrameError
+			if errors.As(err, &frameErr) && frameErr.Corrupted() && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return &DecodeError{Err: err}
+			}
+			return &TransportError{Op: "read", URL: url, Err: err}
+		}
+		emit(&EventResponse{Event: ev})
+	}
+}
+
+// readEventStream reads the events from a server-sent events stream.
+func readEventStream(url string, body io.Reader, emit func(*EventResponse)) error {
+	reader := bufio.NewReader(body)
+	eventType, data := "", []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return &TransportError{Op: "read", URL: url, Err: err}
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "":
+			// a blank line ends the message
+			if len(data) > 0 {
+				emit(streamMessage(eventType, strings.Join(data, "\n")))
+			}
+			eventType, data = "", data[:0]
+		case strings.HasPrefix(line, ":"):
+			// comment, sent to keep the connection open
+		default:
+			field, value := line, ""
+			if colon := strings.Index(line, ":"); colon >= 0 {
+				field, value = line[:colon], strings.TrimPrefix(line[colon+1:], " ")
+			}
+			switch field {
+			case "event":
+				eventType = value
+			case "data":
+				data = append(data, value)
+			}
+		}
+	}
+}
+
+// streamMessage converts a server-sent message into an EventResponse.
+func streamMessage(eventType, data string) *EventResponse {
+	if eventType == "error" {
+		if err := (&theiaData{data: []byte(data)}).GetServerError(); err != nil {
+			return &EventResponse{Error: err}
+		}
+		return &EventResponse{Error: &ServerError{Message: data, Payload: []byte(data)}}
+	}
+	ev := &model.Event{}
+	if err := ev.LoadBytes([]byte(data)); err != nil {
+		return &EventResponse{Error: &DecodeError{Payload: []byte(data), Err: err}}
+	}
+	return &EventResponse{Event: ev}
+}
+
+// WriteEventStream writes the event as a server-sent message: every line of
+// the serialized event is sent as a data line.
+func WriteEventStream(w io.Writer, event *model.Event) error {
+	data, err := event.DumpBytes()
+	if err != nil {
+		return err
+	}
+	return writeStreamMessage(w, "", data)
+}
+
+// WriteEventStreamError writes the error as a server-sent message of type
+// "error".
+func WriteEventStreamError(w io.Writer, message string) error {
+	data, err := json.Marshal(map[string]string{"error": message})
+	if err != nil {
+		return err
+	}
+	return writeStreamMessage(w, "error", data)
+}
+
+func writeStreamMessage(w io.Writer, eventType string, data []byte) error {
+	var buff bytes.Buffer
+	if eventType != "" {
+		buff.WriteString("event: " + eventType + "\n")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		buff.WriteString("data: " + line + "\n")
+	}
+	buff.WriteString("\n")
+	_, err := w.Write(buff.Bytes())
+	return err
+}
@@ -0,0 +1,223 @@
+package comm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theia-log/selene/model"
+)
+
+// collect reads the responses from the channel until it is closed.
+func collect(t *testing.T, resp chan *EventResponse) ([]*model.Event, []error) {
+	events, errs := []*model.Event{}, []error{}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-resp:
+			if !ok {
+				return events, errs
+			}
+			if event.Error != nil {
+				errs = append(errs, event.Error)
+			} else {
+				events = append(events, event.Event)
+			}
+		case <-timeout:
+			t.Fatal("Timeout while reading events.")
+		}
+	}
+}
+
+// encodeEvents serializes the events in EventsContentType.
+func encodeEvents(t *testing.T, events ...*model.Event) []byte {
+	var buff bytes.Buffer
+	encoder := model.NewEncoder(&buff)
+	for _, ev := range events {
+		if err := encoder.Encode(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buff.Bytes()
+}
+
+func TestNewClient(t *testing.T) {
+	if _, ok := NewClient("http://localhost:6433").(*HTTPClient); !ok {
+		t.Fatal("Expected HTTPClient for http://.")
+	}
+	if _, ok := NewClient("https://localhost:6433").(*HTTPClient); !ok {
+		t.Fatal("Expected HTTPClient for https://.")
+	}
+	if _, ok := NewClient("ws://localhost:6433").(*WebsocketClient); !ok {
+		t.Fatal("Expected WebsocketClient for ws://.")
+	}
+}
+
+func TestHTTPClient_sendBatch(t *testing.T) {
+	received := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/event" || req.Header.Get("Content-Type") != EventsContentType {
+			t.Errorf("Unexpected request: %s %s (%s)", req.Method, req.URL.Path, req.Header.Get("Content-Type"))
+		}
+		data, _ := ioutil.ReadAll(req.Body)
+		received <- data
+		resp.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL + "/")
+	events := []*model.Event{
+		{ID: "1", Timestamp: 1, Content: "first"},
+		{ID: "2", Timestamp: 2, Content: "second\nline"},
+	}
+	if err := client.SendBatch(events); err != nil {
+		t.Fatal(err)
+	}
+	if data := <-received; !bytes.Equal(data, encodeEvents(t, events...)) {
+		t.Fatalf("Events not sent properly: %q", data)
+	}
+}
+
+func TestHTTPClient_serverError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/event" {
+			http.Error(resp, "no space left", http.StatusInternalServerError)
+			return
+		}
+		resp.WriteHeader(http.StatusBadRequest)
+		resp.Write([]byte(`{"error":"invalid pattern"}`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	err := client.Send(&model.Event{ID: "1"})
+	if serverErr, ok := err.(*ServerError); !ok || !strings.Contains(serverErr.Message, "500") {
+		t.Fatalf("Expected ServerError with the status, but got %v", err)
+	}
+	_, err = client.Find(Filter(0))
+	if serverErr, ok := err.(*ServerError); !ok || serverErr.Message != "invalid pattern" {
+		t.Fatalf("Expected ServerError with the message, but got %v", err)
+	}
+}
+
+func TestHTTPClient_find(t *testing.T) {
+	body := encodeEvents(t, &model.Event{ID: "1", Content: "first"}, &model.Event{ID: "2", Content: "second"})
+	filters := make(chan string, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		filters <- string(data)
+		resp.Header().Set("Content-Type", EventsContentType)
+		// the start of the filter selects the response
+		switch string(data) {
+		case `{"start":1}`:
+			resp.Write(body[:len(body)-5])
+		case `{"start":2}`:
+			resp.Write(append(body, []byte("not an event\n")...))
+		default:
+			resp.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	resp, err := client.Find(Filter(10).MatchContent("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events, errs := collect(t, resp); len(events) != 2 || len(errs) != 0 {
+		t.Fatalf("Expected 2 events, but got %v %v", events, errs)
+	}
+	if filter := <-filters; filter != `{"start":10,"content":"first"}` {
+		t.Fatalf("Filter not sent properly: %s", filter)
+	}
+
+	// truncated stream
+	if resp, err = client.Find(Filter(1)); err != nil {
+		t.Fatal(err)
+	}
+	events, errs := collect(t, resp)
+	if len(events) != 1 || len(errs) != 1 {
+		t.Fatalf("Expected 1 event and an error, but got %v %v", events, errs)
+	}
+	if _, ok := errs[0].(*TransportError); !ok {
+		t.Fatalf("Expected TransportError, but got %v", errs[0])
+	}
+
+	// invalid event
+	if resp, err = client.Find(Filter(2)); err != nil {
+		t.Fatal(err)
+	}
+	events, errs = collect(t, resp)
+	if len(events) != 2 || len(errs) != 1 {
+		t.Fatalf("Expected 2 events and an error, but got %v %v", events, errs)
+	}
+	if _, ok := errs[0].(*DecodeError); !ok {
+		t.Fatalf("Expected DecodeError, but got %v", errs[0])
+	}
+}
+
+func TestReadEventStream(t *testing.T) {
+	var stream bytes.Buffer
+	stream.WriteString(": keepalive\n\n")
+	if err := WriteEventStream(&stream, &model.Event{ID: "1", Tags: []string{"a"}, Content: "multi\nline\n"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteEventStreamError(&stream, "too slow"); err != nil {
+		t.Fatal(err)
+	}
+	stream.WriteString("data: not an event\n\n")
+
+	responses := []*EventResponse{}
+	err := readEventStream("http://host/live", &stream, func(resp *EventResponse) {
+		responses = append(responses, resp)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("Expected 3 messages, but got %d", len(responses))
+	}
+	if ev := responses[0].Event; ev == nil || ev.ID != "1" || ev.Content != "multi\nline\n" {
+		t.Fatalf("Event not read properly: %v", responses[0])
+	}
+	if serverErr, ok := responses[1].Error.(*ServerError); !ok || serverErr.Message != "too slow" {
+		t.Fatalf("Expected ServerError, but got %v", responses[1].Error)
+	}
+	if _, ok := responses[2].Error.(*DecodeError); !ok {
+		t.Fatalf("Expected DecodeError, but got %v", responses[2].Error)
+	}
+}
+
+func TestHTTPClient_receiveAndClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Accept") != EventStreamContentType {
+			t.Errorf("Unexpected Accept header: %s", req.Header.Get("Accept"))
+		}
+		resp.Header().Set("Content-Type", EventStreamContentType)
+		WriteEventStream(resp, &model.Event{ID: "1", Content: "live"})
+		resp.(http.Flusher).Flush()
+		<-req.Context().Done()
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	resp, err := client.Receive(Filter(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := <-resp; event.Error != nil || event.Event.ID != "1" {
+		t.Fatalf("Expected event 1, but got %v", event)
+	}
+	client.Close()
+	events, errs := collect(t, resp)
+	if len(events) != 0 || len(errs) != 1 {
+		t.Fatalf("Expected the stream to be closed, but got %v %v", events, errs)
+	}
+	if _, ok := errs[0].(*ClosedError); !ok {
+		t.Fatalf("Expected ClosedError, but got %v", errs[0])
+	}
+}
@@ -0,0 +1,105 @@
+package comm
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/theia-log/selene/model"
+)
+
+// maxCachedPatterns is the maximal number of compiled patterns kept in the
+// pattern cache. Once the cache is full, it is cleared.
+const maxCachedPatterns = 1024
+
+// compiledPattern is a cached result of compiling a filter pattern.
+type compiledPattern struct {
+	re  *regexp.Regexp
+	err error
+}
+
+// patterns caches the compiled tag and content patterns of the filters, so
+// that matching many events does not compile the same patterns over and over.
+var patterns = struct {
+	sync.RWMutex
+	compiled map[string]*compiledPattern
+}{
+	compiled: map[string]*compiledPattern{},
+}
+
+// compileFilterPattern compiles the pattern, or returns the cached result.
+func compileFilterPattern(pattern string) (*regexp.Regexp, error) {
+	patterns.RLock()
+	cached, ok := patterns.compiled[pattern]
+	patterns.RUnlock()
+	if ok {
+		return cached.re, cached.err
+	}
+
+	re, err := regexp.Compile(pattern)
+	patterns.Lock()
+	if len(patterns.compiled) >= maxCachedPatterns {
+		patterns.compiled = map[string]*compiledPattern{}
+	}
+	patterns.compiled[pattern] = &compiledPattern{re: re, err: err}
+	patterns.Unlock()
+	return re, err
+}
+
+// Validate checks that all tag and content patterns of the filter are valid
+// regular expressions.
+func (f *EventFilter) Validate() error {
+	for _, tag := range f.Tags {
+		if _, err := compileFilterPattern(tag); err != nil {
+			return err
+		}
+	}
+	if f.Content != nil {
+		if _, err := compileFilterPattern(*f.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Matches checks if the event matches the filter, the same way Theia matches
+// the events on the server:
+//   - the event timestamp must be within Start and End, both inclusive;
+//   - every tag pattern must match at least one of the event tags;
+//   - the content pattern must match the event content.
+//
+// The patterns match anywhere in the value, unless anchored with ^ and $.
+// The compiled patterns are cached, so the filter may be used to match many
+// events efficiently. An invalid pattern never matches; use Validate to check
+// the filter first.
+// Matches is safe for concurrent use, as long as the filter is not modified.
+func (f *EventFilter) Matches(ev *model.Event) bool {
+	if ev.Timestamp < f.Start {
+		return false
+	}
+	if f.End != nil && ev.Timestamp > *f.End {
+		return false
+	}
+	for _, tag := range f.Tags {
+		re, err := compileFilterPattern(tag)
+		if err != nil || !matchesAny(re, ev.Tags) {
+			return false
+		}
+	}
+	if f.Content != nil {
+		re, err := compileFilterPattern(*f.Content)
+		if err != nil || !re.MatchString(ev.Content) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny checks if the pattern matches any of the values.
+func matchesAny(re *regexp.Regexp, values []string) bool {
+	for _, value := range values {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
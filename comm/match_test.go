@@ -0,0 +1,89 @@
+package comm
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/theia-log/selene/model"
+)
+
+func TestEventFilterMatches(t *testing.T) {
+	ev := &model.Event{
+		ID:        "1",
+		Timestamp: 100,
+		Tags:      []string{"db", "error"},
+		Content:   "connection timeout after 30s",
+	}
+
+	cases := []struct {
+		name     string
+		filter   *EventFilter
+		expected bool
+	}{
+		{"empty filter", &EventFilter{}, true},
+		{"start inclusive", Filter(100), true},
+		{"after start", Filter(101), false},
+		{"end inclusive", Filter(0).MatchEnd(100), true},
+		{"before end", Filter(0).MatchEnd(99.9), false},
+		{"tag", Filter(0).MatchTag("db"), true},
+		{"tag unanchored", Filter(0).MatchTag("rr"), true},
+		{"tag anchored", Filter(0).MatchTag("^rr$"), false},
+		{"all tags", Filter(0).MatchTag("db", "err.*"), true},
+		{"one tag missing", Filter(0).MatchTag("db", "warn"), false},
+		{"content", Filter(0).MatchContent(`\d+s$`), true},
+		{"content mismatch", Filter(0).MatchContent("refused"), false},
+		{"invalid tag", Filter(0).MatchTag("("), false},
+		{"invalid content", Filter(0).MatchContent("["), false},
+		{"all conditions", Filter(50).MatchEnd(150).MatchTag("error").MatchContent("timeout"), true},
+	}
+	for _, c := range cases {
+		if actual := c.filter.Matches(ev); actual != c.expected {
+			t.Fatalf("%s: expected %v, but got %v", c.name, c.expected, actual)
+		}
+	}
+}
+
+func TestEventFilterValidate(t *testing.T) {
+	if err := Filter(0).MatchTag("a.*", "^b$").MatchContent("c+").Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Filter(0).MatchTag("a", "(").Validate(); err == nil {
+		t.Fatal("Expected error for invalid tag pattern.")
+	}
+	if err := Filter(0).MatchContent("[").Validate(); err == nil {
+		t.Fatal("Expected error for invalid content pattern.")
+	}
+}
+
+func TestEventFilterMatches_concurrent(t *testing.T) {
+	filter := Filter(0).MatchTag("t[0-9]").MatchContent("x+")
+	ev := &model.Event{Tags: []string{"t1"}, Content: "xx"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if !filter.Matches(ev) {
+					t.Error("Expected event to match.")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCompileFilterPattern_cacheLimit(t *testing.T) {
+	for i := 0; i < maxCachedPatterns+10; i++ {
+		compileFilterPattern(fmt.Sprintf("pattern%d", i))
+	}
+	patterns.RLock()
+	size := len(patterns.compiled)
+	patterns.RUnlock()
+	if size > maxCachedPatterns {
+		t.Fatalf("Expected at most %d cached patterns, but got %d", maxCachedPatterns, size)
+	}
+}
@@ -0,0 +1,331 @@
+package comm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/theia-log/selene/model"
+)
+
+// Load balancing strategies of the ClientPool.
+const (
+	// BalanceRoundRobin picks the servers in turn.
+	BalanceRoundRobin = "round-robin"
+
+	// BalanceLeastInFlight picks the server with the fewest events being sent
+	// at the moment.
+	BalanceLeastInFlight = "least-in-flight"
+)
+
+// Default ClientPool options.
+const (
+	// DefaultPoolSize is the default number of connections per server.
+	DefaultPoolSize = 4
+
+	// DefaultHealthCheck is the default interval of checking if the servers
+	// that failed are up again.
+	DefaultHealthCheck = 10 * time.Second
+)
+
+// PoolOptions configures the ClientPool.
+type PoolOptions struct {
+	// Size is the number of /event connections per server. Defaults to
+	// DefaultPoolSize.
+	Size int
+
+	// Balance is the load balancing strategy: BalanceRoundRobin (the default)
+	// or BalanceLeastInFlight.
+	Balance string
+
+	// HealthCheck is the interval of checking if the servers that failed are
+	// up again. Defaults to DefaultHealthCheck.
+	HealthCheck time.Duration
+
+	// NewClient creates the clients to a server, for example with a proxy
+	// and a dial timeout set (see WebsocketClient.Proxy). The health checks
+	// connect with the same settings. Defaults to NewWebsocketClient.
+	NewClient func(url string) *WebsocketClient
+}
+
+// errPoolClosed is returned when the ClientPool is used after it was closed.
+var errPoolClosed = fmt.Errorf("pool closed")
+
+// poolServer is a server in the ClientPool, with its idle connections, and
+// the client for the queries.
+type poolServer struct {
+	url      string
+	idle     chan Client
+	queries  Client
+	inFlight int32
+	healthy  int32
+}
+
+func (s *poolServer) isHealthy() bool {
+	return atomic.LoadInt32(&s.healthy) != 0
+}
+
+func (s *poolServer) setHealthy(healthy bool) {
+	value := int32(0)
+	if healthy {
+		value = 1
+	}
+	atomic.StoreInt32(&s.healthy, value)
+}
+
+// ClientPool is a Client that balances the events over a pool of connections
+// to multiple replicas of a Theia server.
+// Every event is sent over a connection to one of the servers, selected by the
+// balancing strategy. If the connection to the server fails, the server is
+// marked as down and the event is sent to another server. Other errors, such
+// as an event that cannot be serialized, are returned right away. The servers that are down are checked
+// periodically and used again once they are up.
+// Find and Receive open a stream on one of the servers that are up. The open
+// streams end with a *ClosedError when the pool is closed.
+// The ClientPool is safe for concurrent use.
+type ClientPool struct {
+	servers []*poolServer
+	balance string
+	next    uint32
+	done    chan struct{}
+	once    sync.Once
+
+	// newClient creates a client to the server, probe checks if the server
+	// is up. These are replaced in tests.
+	newClient func(url string) Client
+	probe     func(url string) error
+}
+
+// NewClientPool creates a new ClientPool to the given server URLs. If options
+// is nil, the default options are used.
+// The pool must be closed with Close to stop the health checks.
+func NewClientPool(urls []string, options *PoolOptions) (*ClientPool, error) {
+	newClient := NewWebsocketClient
+	if options != nil && options.NewClient != nil {
+		newClient = options.NewClient
+	}
+	return newClientPool(urls, options, func(url string) Client {
+		return newClient(url)
+	}, func(url string) error {
+		return probeServer(newClient(url))
+	})
+}
+
+func newClientPool(urls []string, options *PoolOptions, newClient func(url string) Client, probe func(url string) error) (*ClientPool, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no servers")
+	}
+	opts := PoolOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.Size <= 0 {
+		opts.Size = DefaultPoolSize
+	}
+	if opts.Balance == "" {
+		opts.Balance = BalanceRoundRobin
+	}
+	if opts.Balance != BalanceRoundRobin && opts.Balance != BalanceLeastInFlight {
+		return nil, fmt.Errorf("unknown balancing strategy: %s", opts.Balance)
+	}
+	if opts.HealthCheck <= 0 {
+		opts.HealthCheck = DefaultHealthCheck
+	}
+
+	pool := &ClientPool{
+		balance:   opts.Balance,
+		done:      make(chan struct{}),
+		newClient: newClient,
+		probe:     probe,
+	}
+	for _, url := range urls {
+		server := &poolServer{
+			url:     url,
+			idle:    make(chan Client, opts.Size),
+			queries: newClient(url),
+			healthy: 1,
+		}
+		for i := 0; i < opts.Size; i++ {
+			// the websocket clients connect lazily, on the first send
+			server.idle <- newClient(url)
+		}
+		pool.servers = append(pool.servers, server)
+	}
+	go pool.checkHealth(opts.HealthCheck)
+	return pool, nil
+}
+
+// probeServer checks if the server accepts websocket connections from the
+// client.
+func probeServer(client *WebsocketClient) error {
+	conn := client.newConn("event")
+	if err := conn.Open(); err != nil {
+		return err
+	}
+	conn.discard()
+	return conn.Close("health check")
+}
+
+// checkHealth periodically probes the servers that are down.
+func (p *ClientPool) checkHealth(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.probeDown()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// probeDown probes the servers that are down, and marks them as up if they
+// respond.
+func (p *ClientPool) probeDown() {
+	for _, server := range p.servers {
+		if !server.isHealthy() && p.probe(server.url) == nil {
+			server.setHealthy(true)
+		}
+	}
+}
+
+// candidates returns the servers to try, in order. The servers that are up
+// come first, ordered by the balancing strategy; the servers that are down
+// are tried last.
+func (p *ClientPool) candidates() []*poolServer {
+	count := len(p.servers)
+	offset := int(atomic.AddUint32(&p.next, 1)-1) % count
+
+	up, down := []*poolServer{}, []*poolServer{}
+	for i := 0; i < count; i++ {
+		server := p.servers[(offset+i)%count]
+		if server.isHealthy() {
+			up = append(up, server)
+		} else {
+			down = append(down, server)
+		}
+	}
+	if p.balance == BalanceLeastInFlight {
+		for i := 1; i < len(up); i++ {
+			// move the least loaded server first, keep the rest in turn
+			if atomic.LoadInt32(&up[i].inFlight) < atomic.LoadInt32(&up[0].inFlight) {
+				up[0], up[i] = up[i], up[0]
+			}
+		}
+	}
+	return append(up, down...)
+}
+
+// isTransportError checks if the error is a failure of the connection to the
+// server, after which the next server is tried.
+func isTransportError(err error) bool {
+	var transportErr *TransportError
+	return errors.As(err, &transportErr)
+}
+
+// Send sends the event over one of the pooled connections. If the connection
+// fails, the event is sent to the next server. Returns a *FanOutError if the
+// event could not be sent to any server.
+// The event is validated before it is sent, and an invalid event is reported
+// without trying any server.
+func (p *ClientPool) Send(event *model.Event) error {
+	select {
+	case <-p.done:
+		return errPoolClosed
+	default:
+	}
+	if _, err := event.DumpBytes(); err != nil {
+		return err
+	}
+	errs := []error{}
+	for _, server := range p.candidates() {
+		err := p.sendTo(server, event)
+		if !isTransportError(err) {
+			return err
+		}
+		server.setHealthy(false)
+		errs = append(errs, err)
+	}
+	return &FanOutError{Errors: errs}
+}
+
+// sendTo sends the event over an idle connection to the server. It waits
+// for a connection if all connections are busy.
+func (p *ClientPool) sendTo(server *poolServer, event *model.Event) error {
+	// the events waiting for a connection count as in flight as well
+	atomic.AddInt32(&server.inFlight, 1)
+	defer atomic.AddInt32(&server.inFlight, -1)
+
+	var client Client
+	select {
+	case client = <-server.idle:
+	case <-p.done:
+		return errPoolClosed
+	}
+	err := client.Send(event)
+	if isTransportError(err) {
+		// drop the broken connection, a new one is opened on the next send
+		CloseClient(client)
+	}
+	server.idle <- client
+	return err
+}
+
+// Receive opens a channel for real-time events on one of the servers that
+// are up.
+func (p *ClientPool) Receive(filter *EventFilter) (chan *EventResponse, error) {
+	return p.query(func(client Client) (chan *EventResponse, error) {
+		return client.Receive(filter)
+	})
+}
+
+// Find looks up past events on one of the servers that are up.
+func (p *ClientPool) Find(filter *EventFilter) (chan *EventResponse, error) {
+	return p.query(func(client Client) (chan *EventResponse, error) {
+		return client.Find(filter)
+	})
+}
+
+// query runs the query on the query client of a server. If the connection to
+// the server fails, the next server is tried. Other errors, such as a filter
+// rejected by the server, are returned right away.
+func (p *ClientPool) query(op func(client Client) (chan *EventResponse, error)) (chan *EventResponse, error) {
+	select {
+	case <-p.done:
+		return nil, errPoolClosed
+	default:
+	}
+	errs := []error{}
+	for _, server := range p.candidates() {
+		resp, err := op(server.queries)
+		if !isTransportError(err) {
+			return resp, err
+		}
+		server.setHealthy(false)
+		errs = append(errs, err)
+	}
+	return nil, &FanOutError{Errors: errs}
+}
+
+// Close stops the health checks, closes all pooled connections and ends the
+// open streams. Closing waits for the events that are being sent.
+func (p *ClientPool) Close() error {
+	var closeErr error
+	p.once.Do(func() {
+		close(p.done)
+		for _, server := range p.servers {
+			if err := CloseClient(server.queries); err != nil && closeErr == nil {
+				closeErr = err
+			}
+			for i := 0; i < cap(server.idle); i++ {
+				if err := CloseClient(<-server.idle); err != nil && closeErr == nil {
+					closeErr = err
+				}
+			}
+		}
+	})
+	return closeErr
+}
@@ -0,0 +1,330 @@
+package comm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/theia-log/selene/model"
+)
+
+// poolBackend is a fake server shared by all pooled clients to it.
+type poolBackend struct {
+	mux     sync.Mutex
+	down    bool
+	sent    []string
+	closed  int
+	release chan struct{}
+}
+
+func (b *poolBackend) isDown() bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.down
+}
+
+func (b *poolBackend) setDown(down bool) {
+	b.mux.Lock()
+	b.down = down
+	b.mux.Unlock()
+}
+
+func (b *poolBackend) sentCount() int {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return len(b.sent)
+}
+
+// poolClient is a client to a poolBackend.
+type poolClient struct {
+	backend *poolBackend
+}
+
+func (c *poolClient) Send(event *model.Event) error {
+	if c.backend.release != nil {
+		<-c.backend.release
+	}
+	c.backend.mux.Lock()
+	defer c.backend.mux.Unlock()
+	if c.backend.down {
+		return &TransportError{Op: "write", URL: "pool", Err: errDown}
+	}
+	c.backend.sent = append(c.backend.sent, event.ID)
+	return nil
+}
+
+func (c *poolClient) Receive(filter *EventFilter) (chan *EventResponse, error) {
+	return c.Find(filter)
+}
+
+func (c *poolClient) Find(filter *EventFilter) (chan *EventResponse, error) {
+	if c.backend.isDown() {
+		return nil, &TransportError{Op: "dial", URL: "pool", Err: errDown}
+	}
+	if filter.Content != nil && *filter.Content == "(" {
+		return nil, &ServerError{Message: "invalid content pattern"}
+	}
+	resp := make(chan *EventResponse)
+	close(resp)
+	return resp, nil
+}
+
+func (c *poolClient) Close() error {
+	c.backend.mux.Lock()
+	c.backend.closed++
+	c.backend.mux.Unlock()
+	return nil
+}
+
+// newTestPool creates a pool over fake backends, one per URL.
+func newTestPool(t *testing.T, options *PoolOptions, urls ...string) (*ClientPool, map[string]*poolBackend) {
+	backends := map[string]*poolBackend{}
+	for _, url := range urls {
+		backends[url] = &poolBackend{}
+	}
+	pool, err := newClientPool(urls, options, func(url string) Client {
+		return &poolClient{backend: backends[url]}
+	}, func(url string) error {
+		if backends[url].isDown() {
+			return errDown
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool, backends
+}
+
+func TestNewClientPool_invalidOptions(t *testing.T) {
+	if _, err := NewClientPool(nil, nil); err == nil {
+		t.Fatal("Expected error for no servers.")
+	}
+	if _, err := NewClientPool([]string{"ws://localhost:6433"}, &PoolOptions{Balance: "random"}); err == nil {
+		t.Fatal("Expected error for unknown balancing strategy.")
+	}
+}
+
+func TestNewClientPool_newClient(t *testing.T) {
+	server := startTestServer(nil)
+	defer server.Close()
+	proxyURL, _, stop := startConnectProxy(t, server.Listener.Addr().String())
+	defer stop()
+	proxy, err := ParseProxy(proxyURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server is reachable only through the proxy
+	url := "ws://theia.example:6433"
+	pool, err := NewClientPool([]string{url}, &PoolOptions{
+		Size: 1,
+		NewClient: func(url string) *WebsocketClient {
+			return NewWebsocketClient(url).Proxy(proxy)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if err = pool.probe(url); err != nil {
+		t.Fatal(err)
+	}
+	if err = pool.Send(&model.Event{ID: "1", Content: "proxied"}); err != nil {
+		t.Fatal(err)
+	}
+	server.waitEvents(t, 1)
+}
+
+func TestClientPool_roundRobin(t *testing.T) {
+	pool, backends := newTestPool(t, nil, "a", "b", "c")
+	defer pool.Close()
+
+	for i := 0; i < 9; i++ {
+		if err := pool.Send(&model.Event{ID: fmt.Sprintf("%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for url, backend := range backends {
+		if backend.sentCount() != 3 {
+			t.Fatalf("Expected 3 events on %s, but got %v.", url, backend.sent)
+		}
+	}
+}
+
+func TestClientPool_leastInFlight(t *testing.T) {
+	pool, backends := newTestPool(t, &PoolOptions{Balance: BalanceLeastInFlight}, "a", "b")
+	defer pool.Close()
+
+	// hold one event in flight on a
+	backends["a"].release = make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- pool.sendTo(pool.servers[0], &model.Event{ID: "held"})
+	}()
+	for i := 0; atomic.LoadInt32(&pool.servers[0].inFlight) == 0 && i < 100; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := pool.Send(&model.Event{ID: fmt.Sprintf("%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(backends["a"].release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if backends["b"].sentCount() != 4 {
+		t.Fatalf("Expected all events on the idle server, but got %v.", backends["b"].sent)
+	}
+}
+
+func TestClientPool_failover(t *testing.T) {
+	pool, backends := newTestPool(t, nil, "a", "b")
+	defer pool.Close()
+
+	backends["a"].setDown(true)
+	for i := 0; i < 4; i++ {
+		if err := pool.Send(&model.Event{ID: fmt.Sprintf("%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if backends["b"].sentCount() != 4 {
+		t.Fatalf("Expected all events on b, but got %v.", backends["b"].sent)
+	}
+	if pool.servers[0].isHealthy() {
+		t.Fatal("Expected a to be marked down.")
+	}
+	if backends["a"].closed == 0 {
+		t.Fatal("Expected the failed connection to be closed.")
+	}
+
+	// a is still down, the health check keeps it out
+	pool.probeDown()
+	if pool.servers[0].isHealthy() {
+		t.Fatal("Expected a to stay down.")
+	}
+
+	backends["a"].setDown(false)
+	pool.probeDown()
+	if !pool.servers[0].isHealthy() {
+		t.Fatal("Expected a to be up again.")
+	}
+	for i := 0; i < 4; i++ {
+		if err := pool.Send(&model.Event{ID: fmt.Sprintf("%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if backends["a"].sentCount() != 2 {
+		t.Fatalf("Expected a to get events again, but got %v.", backends["a"].sent)
+	}
+}
+
+func TestClientPool_allDown(t *testing.T) {
+	pool, backends := newTestPool(t, nil, "a", "b")
+	defer pool.Close()
+
+	backends["a"].setDown(true)
+	backends["b"].setDown(true)
+	err := pool.Send(&model.Event{ID: "1"})
+	fanOutErr, ok := err.(*FanOutError)
+	if !ok {
+		t.Fatalf("Expected *FanOutError, but got %v.", err)
+	}
+	if len(fanOutErr.Errors) != 2 {
+		t.Fatalf("Expected 2 errors, but got %v.", fanOutErr.Errors)
+	}
+}
+
+func TestClientPool_queries(t *testing.T) {
+	pool, backends := newTestPool(t, nil, "a", "b")
+	defer pool.Close()
+
+	backends["a"].setDown(true)
+	if _, err := pool.Find(&EventFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Receive(&EventFilter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	backends["b"].setDown(true)
+	if _, err := pool.Find(&EventFilter{}); err == nil {
+		t.Fatal("Expected error when all servers are down.")
+	}
+}
+
+func TestClientPool_invalidRequest(t *testing.T) {
+	pool, backends := newTestPool(t, nil, "a", "b")
+	defer pool.Close()
+
+	err := pool.Send(&model.Event{ID: "1", Fields: map[string]string{"a:b": "value"}})
+	if !errors.Is(err, model.ErrInvalidField) {
+		t.Fatalf("Expected invalid field error, but got %v.", err)
+	}
+	content := "("
+	if _, err = pool.Find(&EventFilter{Content: &content}); err == nil {
+		t.Fatal("Expected the server to reject the filter.")
+	} else if _, ok := err.(*ServerError); !ok {
+		t.Fatalf("Expected *ServerError, but got %v.", err)
+	}
+	for i, server := range pool.servers {
+		if !server.isHealthy() {
+			t.Fatalf("Expected server %d to stay up.", i)
+		}
+	}
+	for url, backend := range backends {
+		if backend.closed != 0 || backend.sentCount() != 0 {
+			t.Fatalf("Expected no events and no closed connections on %s.", url)
+		}
+	}
+}
+
+func TestClientPool_concurrentSend(t *testing.T) {
+	pool, backends := newTestPool(t, &PoolOptions{Size: 2, Balance: BalanceLeastInFlight}, "a", "b")
+	defer pool.Close()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := pool.Send(&model.Event{ID: fmt.Sprintf("%d-%d", i, j)}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if total := backends["a"].sentCount() + backends["b"].sentCount(); total != 200 {
+		t.Fatalf("Expected 200 events, but got %d.", total)
+	}
+}
+
+func TestClientPool_close(t *testing.T) {
+	pool, backends := newTestPool(t, &PoolOptions{Size: 3}, "a", "b")
+
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for url, backend := range backends {
+		// the pooled connections and the query client
+		if backend.closed != 4 {
+			t.Fatalf("Expected 4 connections to %s closed, but got %d.", url, backend.closed)
+		}
+	}
+	if _, err := pool.Find(&EventFilter{}); err != errPoolClosed {
+		t.Fatalf("Expected pool closed error, but got %v.", err)
+	}
+	if err := pool.Send(&model.Event{ID: "1"}); err != errPoolClosed {
+		t.Fatalf("Expected pool closed error, but got %v.", err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,662 @@
+package comm
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/theia-log/selene/model"
+)
+
+// Query fields that can be matched in a query term.
+const (
+	FieldTag     = "tag"
+	FieldContent = "content"
+	FieldSource  = "source"
+	FieldID      = "id"
+	FieldTime    = "time"
+)
+
+// Expr is a node in the query AST.
+// Every node can be evaluated against an event on the client side.
+type Expr interface {
+	// Match evaluates the expression against the event.
+	Match(event *model.Event) bool
+
+	// String returns the query string representation of the expression.
+	String() string
+}
+
+// AndExpr matches if both Left and Right expressions match.
+type AndExpr struct {
+	Left  Expr
+	Right Expr
+}
+
+// Match evaluates both sides of the AND expression.
+func (e *AndExpr) Match(event *model.Event) bool {
+	return e.Left.Match(event) && e.Right.Match(event)
+}
+
+func (e *AndExpr) String() string {
+	return fmt.Sprintf("(%s AND %s)", e.Left.String(), e.Right.String())
+}
+
+// OrExpr matches if either Left or Right expression matches.
+type OrExpr struct {
+	Left  Expr
+	Right Expr
+}
+
+// Match evaluates the OR expression.
+func (e *OrExpr) Match(event *model.Event) bool {
+	return e.Left.Match(event) || e.Right.Match(event)
+}
+
+func (e *OrExpr) String() string {
+	return fmt.Sprintf("(%s OR %s)", e.Left.String(), e.Right.String())
+}
+
+// NotExpr negates the wrapped expression.
+type NotExpr struct {
+	Expr Expr
+}
+
+// Match returns true if the wrapped expression does not match.
+func (e *NotExpr) Match(event *model.Event) bool {
+	return !e.Expr.Match(event)
+}
+
+func (e *NotExpr) String() string {
+	return fmt.Sprintf("NOT %s", e.Expr.String())
+}
+
+// TermExpr matches a single event field.
+// Text fields (tag, content, source, id) are matched against the Pattern. The
+// time field is compared to Time using the comparison operator Op.
+type TermExpr struct {
+	// Field is the name of the event field: tag, content, source, id or time.
+	Field string
+
+	// Op is the comparison operator. For text fields it is always ":". For the
+	// time field it is one of: >, >=, <, <=, =.
+	Op string
+
+	// Value is the value as written in the query.
+	Value string
+
+	// Pattern is the compiled regular expression for the text fields.
+	Pattern *regexp.Regexp
+
+	// Time is the timestamp, in milliseconds, to compare the event timestamp
+	// to.
+	Time float64
+}
+
+// Match evaluates the term against the event.
+func (e *TermExpr) Match(event *model.Event) bool {
+	switch e.Field {
+	case FieldTag:
+		for _, tag := range event.Tags {
+			if e.Pattern.MatchString(tag) {
+				return true
+			}
+		}
+		return false
+	case FieldContent:
+		return e.Pattern.MatchString(event.Content)
+	case FieldSource:
+		return e.Pattern.MatchString(event.Source)
+	case FieldID:
+		return e.Pattern.MatchString(event.ID)
+	case FieldTime:
+		switch e.Op {
+		case ">":
+			return event.Timestamp > e.Time
+		case ">=":
+			return event.Timestamp >= e.Time
+		case "<":
+			return event.Timestamp < e.Time
+		case "<=":
+			return event.Timestamp <= e.Time
+		case "=":
+			return event.Timestamp == e.Time
+		}
+	}
+	return false
+}
+
+func (e *TermExpr) String() string {
+	return fmt.Sprintf("%s%s%s", e.Field, e.Op, e.Value)
+}
+
+// Query is a parsed query string.
+//
+// The query language is a boolean combination of terms:
+//	tag:db AND (content:/timeout/ OR source:api*) AND time>-1h
+//
+// A term has the form field:value, where field is one of tag, content, source
+// or id. The value may be a regular expression enclosed in slashes
+// (/time(out)?/), a quoted literal ("connection reset") or a glob pattern where
+// * matches any sequence of characters and ? matches a single character. Tags,
+// sources and IDs must match the glob pattern completely, while the content
+// only needs to contain it. A word without a field is matched against the
+// content.
+//
+// The time field is compared with one of the operators >, >=, <, <= or =. The
+// time may be a timestamp in milliseconds (the unit of the event timestamps
+// written by selene), an RFC3339 date, "now", or relative to now, like -1h or
+// -30m (units: ms, s, m, h, d, w).
+//
+// Terms are combined with AND, OR and NOT and grouped with parentheses.
+// Adjacent terms without an operator are combined with AND.
+type Query struct {
+	// Expr is the root of the query AST.
+	Expr Expr
+}
+
+// Match evaluates the whole query against the event.
+func (q *Query) Match(event *model.Event) bool {
+	if q.Expr == nil {
+		return true
+	}
+	return q.Expr.Match(event)
+}
+
+func (q *Query) String() string {
+	if q.Expr == nil {
+		return ""
+	}
+	return q.Expr.String()
+}
+
+// Compile sets the parts of the query that the server can evaluate on the
+// given EventFilter and returns the expression that must be evaluated on the
+// client side. Returns nil if the server can evaluate the whole query.
+//
+// Only the top-level AND terms can be evaluated by the server: tag patterns,
+// a single content pattern and the time bounds. The patterns already set on
+// the filter are kept.
+func (q *Query) Compile(filter *EventFilter) Expr {
+	var residual Expr
+	for _, expr := range conjunction(q.Expr) {
+		if !compileTerm(filter, expr) {
+			if residual == nil {
+				residual = expr
+			} else {
+				residual = &AndExpr{Left: residual, Right: expr}
+			}
+		}
+	}
+	return residual
+}
+
+// Filter compiles the query to a new EventFilter. Returns the filter and the
+// expression that must be evaluated on the client side (nil if none).
+func (q *Query) Filter() (*EventFilter, Expr) {
+	filter := &EventFilter{}
+	return filter, q.Compile(filter)
+}
+
+// conjunction flattens the top-level AND expressions to a list of operands.
+func conjunction(expr Expr) []Expr {
+	if expr == nil {
+		return nil
+	}
+	if and, ok := expr.(*AndExpr); ok {
+		return append(conjunction(and.Left), conjunction(and.Right)...)
+	}
+	return []Expr{expr}
+}
+
+// compileTerm sets the term on the filter, if possible. Returns false if the
+// term must (also) be evaluated on the client side.
+func compileTerm(filter *EventFilter, expr Expr) bool {
+	term, ok := expr.(*TermExpr)
+	if !ok {
+		return false
+	}
+	switch term.Field {
+	case FieldTag:
+		filter.MatchTag(term.Pattern.String())
+		return true
+	case FieldContent:
+		if filter.Content != nil {
+			return false
+		}
+		filter.MatchContent(term.Pattern.String())
+		return true
+	case FieldTime:
+		if term.Op == ">" || term.Op == ">=" || term.Op == "=" {
+			if term.Time > filter.Start {
+				filter.Start = term.Time
+			}
+		}
+		if term.Op == "<" || term.Op == "<=" || term.Op == "=" {
+			if filter.End == nil || term.Time < *filter.End {
+				filter.MatchEnd(term.Time)
+			}
+		}
+		// the filter bounds are inclusive
+		return term.Op != ">" && term.Op != "<"
+	}
+	return false
+}
+
+// ParseQuery parses the query string into a Query.
+// Returns an error with the position of the offending token if the query is
+// not valid.
+func ParseQuery(query string) (*Query, error) {
+	return parseQuery(query, time.Now())
+}
+
+func parseQuery(query string, now time.Time) (*Query, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens, now: now}
+	if len(tokens) == 0 {
+		return &Query{}, nil
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != nil {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", tok.text, tok.pos)
+	}
+	return &Query{Expr: expr}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenTerm tokenKind = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	pos   int
+	field string
+	op    string
+	value string
+	raw   string
+	regex bool
+	quote bool
+}
+
+// tokenize splits the query string into tokens.
+func tokenize(query string) ([]*token, error) {
+	tokens := []*token{}
+	runes := []rune(query)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, &token{kind: tokenOpen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, &token{kind: tokenClose, text: ")", pos: i})
+			i++
+		default:
+			tok, next, err := readTerm(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			i = next
+		}
+	}
+	return tokens, nil
+}
+
+// readTerm reads a keyword or a term starting at position start.
+func readTerm(runes []rune, start int) (*token, int, error) {
+	i := start
+	for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+		i++
+	}
+	field := strings.ToLower(string(runes[start:i]))
+	if i < len(runes) && runes[i] == ':' {
+		tok := &token{kind: tokenTerm, pos: start, field: field, op: ":"}
+		next, err := readValue(runes, i+1, tok)
+		if err != nil {
+			return nil, 0, err
+		}
+		tok.text = string(runes[start:next])
+		return tok, next, nil
+	}
+	if field == FieldTime && i < len(runes) && strings.ContainsRune("<>=", runes[i]) {
+		op := string(runes[i])
+		i++
+		if op != "=" && i < len(runes) && runes[i] == '=' {
+			op += "="
+			i++
+		}
+		tok := &token{kind: tokenTerm, pos: start, field: field, op: op}
+		next, err := readValue(runes, i, tok)
+		if err != nil {
+			return nil, 0, err
+		}
+		tok.text = string(runes[start:next])
+		return tok, next, nil
+	}
+
+	// a keyword or a bare word
+	i = start
+	for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+		i++
+	}
+	word := string(runes[start:i])
+	switch strings.ToUpper(word) {
+	case "AND":
+		return &token{kind: tokenAnd, text: word, pos: start}, i, nil
+	case "OR":
+		return &token{kind: tokenOr, text: word, pos: start}, i, nil
+	case "NOT":
+		return &token{kind: tokenNot, text: word, pos: start}, i, nil
+	}
+	tok := &token{kind: tokenTerm, pos: start, field: FieldContent, op: ":"}
+	next, err := readValue(runes, start, tok)
+	if err != nil {
+		return nil, 0, err
+	}
+	tok.text = string(runes[start:next])
+	return tok, next, nil
+}
+
+// readValue reads the value of a term: a regular expression between slashes,
+// a quoted string or a plain word.
+func readValue(runes []rune, start int, tok *token) (int, error) {
+	if start >= len(runes) {
+		return 0, fmt.Errorf("missing value for '%s' at position %d", tok.field, tok.pos)
+	}
+	delim := runes[start]
+	if delim == '/' || delim == '"' {
+		var value strings.Builder
+		for i := start + 1; i < len(runes); i++ {
+			if runes[i] == '\\' && i+1 < len(runes) && runes[i+1] == delim {
+				value.WriteRune(delim)
+				i++
+				continue
+			}
+			if runes[i] == '\\' && delim == '"' && i+1 < len(runes) && runes[i+1] == '\\' {
+				value.WriteRune('\\')
+				i++
+				continue
+			}
+			if runes[i] == delim {
+				tok.value = value.String()
+				tok.raw = string(runes[start : i+1])
+				tok.regex = delim == '/'
+				tok.quote = delim == '"'
+				return i + 1, nil
+			}
+			value.WriteRune(runes[i])
+		}
+		return 0, fmt.Errorf("unterminated %c at position %d", delim, start)
+	}
+	i := start
+	for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+		i++
+	}
+	if i == start {
+		return 0, fmt.Errorf("missing value for '%s' at position %d", tok.field, tok.pos)
+	}
+	tok.value = string(runes[start:i])
+	tok.raw = tok.value
+	return i, nil
+}
+
+type queryParser struct {
+	tokens []*token
+	pos    int
+	now    time.Time
+}
+
+func (p *queryParser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() *token {
+	tok := p.peek()
+	if tok != nil {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *queryParser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok != nil && tok.kind == tokenOr; tok = p.peek() {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &OrExpr{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok != nil && tok.kind != tokenOr && tok.kind != tokenClose; tok = p.peek() {
+		if tok.kind == tokenAnd {
+			p.next()
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &AndExpr{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseUnary() (Expr, error) {
+	tok := p.next()
+	if tok == nil {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	switch tok.kind {
+	case tokenNot:
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{Expr: expr}, nil
+	case tokenOpen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing == nil || closing.kind != tokenClose {
+			return nil, fmt.Errorf("missing ')' for '(' at position %d", tok.pos)
+		}
+		return expr, nil
+	case tokenTerm:
+		return p.buildTerm(tok)
+	}
+	return nil, fmt.Errorf("unexpected '%s' at position %d", tok.text, tok.pos)
+}
+
+// buildTerm creates TermExpr from a term token, compiling the pattern or
+// parsing the time value.
+func (p *queryParser) buildTerm(tok *token) (Expr, error) {
+	term := &TermExpr{
+		Field: tok.field,
+		Op:    tok.op,
+		Value: tok.raw,
+	}
+	switch tok.field {
+	case FieldTag, FieldSource, FieldID, FieldContent:
+		if tok.op != ":" {
+			return nil, fmt.Errorf("invalid operator '%s' for '%s' at position %d", tok.op, tok.field, tok.pos)
+		}
+		pattern, err := valuePattern(tok, tok.field != FieldContent)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern at position %d: %s", tok.pos, err.Error())
+		}
+		term.Pattern = pattern
+	case FieldTime:
+		if tok.op == ":" {
+			term.Op = ">="
+		}
+		tm, err := parseQueryTime(tok.value, p.now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time at position %d: %s", tok.pos, err.Error())
+		}
+		term.Time = tm
+	default:
+		return nil, fmt.Errorf("unknown field '%s' at position %d", tok.field, tok.pos)
+	}
+	return term, nil
+}
+
+// valuePattern compiles the value of a term to a regular expression. Glob
+// patterns and quoted literals are anchored if the whole value must match.
+func valuePattern(tok *token, anchored bool) (*regexp.Regexp, error) {
+	if tok.regex {
+		return regexp.Compile(tok.value)
+	}
+	var pattern string
+	if tok.quote {
+		pattern = regexp.QuoteMeta(tok.value)
+	} else {
+		pattern = globToRegexp(tok.value)
+	}
+	if anchored {
+		pattern = "^" + pattern + "$"
+	}
+	return regexp.Compile(pattern)
+}
+
+// globToRegexp converts a glob pattern (with * and ?) to a regular expression.
+func globToRegexp(glob string) string {
+	var builder strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			builder.WriteString(".*")
+		case '?':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return builder.String()
+}
+
+var queryTimeUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+var relativeTimePattern = regexp.MustCompile(`^([+-])(\d+(?:\.\d+)?)(ms|s|m|h|d|w)$`)
+
+// parseQueryTime parses a time value in a query to a timestamp in
+// milliseconds.
+func parseQueryTime(value string, now time.Time) (float64, error) {
+	if strings.ToLower(value) == "now" {
+		return toTimestamp(now), nil
+	}
+	if match := relativeTimePattern.FindStringSubmatch(value); match != nil {
+		amount, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			return 0, err
+		}
+		offset := time.Duration(amount * float64(queryTimeUnits[match[3]]))
+		if match[1] == "-" {
+			offset = -offset
+		}
+		return toTimestamp(now.Add(offset)), nil
+	}
+	if ts, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(ts) && !math.IsInf(ts, 0) {
+		return ts, nil
+	}
+	tm, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse time '%s'", value)
+	}
+	return toTimestamp(tm), nil
+}
+
+// toTimestamp converts the time to a timestamp in milliseconds.
+func toTimestamp(tm time.Time) float64 {
+	return float64(tm.UnixNano()) / float64(time.Millisecond)
+}
+
+// MatchResponses applies the matcher on the events from the EventResponse
+// channel. Returns a new EventResponse channel that publishes only the events
+// that match. Errors are passed through unchanged.
+// The returned channel is closed once the input channel is closed.
+func MatchResponses(resp chan *EventResponse, match func(event *model.Event) bool) chan *EventResponse {
+	matched := make(chan *EventResponse)
+	go func() {
+		defer close(matched)
+		for event := range resp {
+			if event.Error == nil && event.Event != nil && !match(event.Event) {
+				continue
+			}
+			matched <- event
+		}
+	}()
+	return matched
+}
+
+// FindQuery looks up past events that match the query string.
+// The query is compiled to an EventFilter for the server, and the parts of the
+// query that the server cannot evaluate are evaluated on the returned events.
+func FindQuery(client Client, query string) (chan *EventResponse, error) {
+	return doQuery(client.Find, query)
+}
+
+// ReceiveQuery receives real-time events that match the query string.
+// The query is compiled the same way as in FindQuery.
+func ReceiveQuery(client Client, query string) (chan *EventResponse, error) {
+	return doQuery(client.Receive, query)
+}
+
+func doQuery(receive func(*EventFilter) (chan *EventResponse, error), query string) (chan *EventResponse, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	filter, residual := q.Filter()
+	resp, err := receive(filter)
+	if err != nil {
+		return nil, err
+	}
+	if residual != nil {
+		resp = MatchResponses(resp, residual.Match)
+	}
+	return resp, nil
+}
@@ -0,0 +1,190 @@
+package comm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theia-log/selene/model"
+)
+
+func TestParseQuery(t *testing.T) {
+	now := time.Unix(1551733035, 0)
+	query, err := parseQuery("tag:db AND (content:/time\\/out/ OR source:api*) AND time>-1h", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "((tag:db AND (content:/time\\/out/ OR source:api*)) AND time>-1h)"
+	if query.String() != expected {
+		t.Fatalf("Expected '%s' but got '%s'", expected, query.String())
+	}
+
+	and, ok := query.Expr.(*AndExpr)
+	if !ok {
+		t.Fatal("Expected AND at the root of the query.")
+	}
+	term, ok := and.Right.(*TermExpr)
+	if !ok || term.Field != FieldTime || term.Op != ">" {
+		t.Fatal("Expected time term.")
+	}
+	if term.Time != (1551733035-3600)*1000 {
+		t.Fatalf("Relative time not parsed properly, got %f", term.Time)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	invalid := []string{
+		"tag:db AND",
+		"(tag:db OR tag:api",
+		"tag:db)",
+		"color:red",
+		"content:/unterminated",
+		"content:/(/",
+		"time>yesterday",
+		"tag:",
+	}
+	for _, q := range invalid {
+		if _, err := ParseQuery(q); err == nil {
+			t.Fatalf("Expected query '%s' to fail.", q)
+		}
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	query, err := ParseQuery("tag:db (content:/timeout/ OR source:api*) NOT id:\"skip me\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		event    *model.Event
+		expected bool
+	}{
+		{&model.Event{ID: "1", Tags: []string{"db"}, Content: "connection timeout"}, true},
+		{&model.Event{ID: "2", Tags: []string{"db", "x"}, Source: "api-1", Content: "ok"}, true},
+		{&model.Event{ID: "3", Tags: []string{"dbx"}, Content: "connection timeout"}, false},
+		{&model.Event{ID: "4", Tags: []string{"db"}, Source: "web", Content: "ok"}, false},
+		{&model.Event{ID: "skip me", Tags: []string{"db"}, Content: "timeout"}, false},
+	}
+	for _, c := range cases {
+		if query.Match(c.event) != c.expected {
+			t.Fatalf("Event %s: expected match to be %v", c.event.ID, c.expected)
+		}
+	}
+
+	empty, err := ParseQuery("  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !empty.Match(&model.Event{}) {
+		t.Fatal("Expected empty query to match everything.")
+	}
+}
+
+func TestQueryCompile(t *testing.T) {
+	query, err := ParseQuery("tag:db AND content:timeout AND time>=100 AND time<200.5 AND (source:api OR tag:x)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter, residual := query.Filter()
+	if filter.Start != 100 {
+		t.Fatal("Expected start to be set.")
+	}
+	if filter.End == nil || *filter.End != 200.5 {
+		t.Fatal("Expected end to be set.")
+	}
+	if len(filter.Tags) != 1 || filter.Tags[0] != "^db$" {
+		t.Fatal("Expected tag pattern to be set.")
+	}
+	if filter.Content == nil || *filter.Content != "timeout" {
+		t.Fatal("Expected content pattern to be set.")
+	}
+	if residual == nil || residual.String() != "(time<200.5 AND (source:api OR tag:x))" {
+		t.Fatalf("Unexpected client-side expression: %v", residual)
+	}
+
+	query, err = ParseQuery("tag:db content:x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, residual = query.Filter(); residual != nil {
+		t.Fatal("Expected the whole query to be evaluated on the server.")
+	}
+}
+
+func TestMatchResponses(t *testing.T) {
+	resp := make(chan *EventResponse)
+	go func() {
+		resp <- &EventResponse{Event: &model.Event{ID: "keep"}}
+		resp <- &EventResponse{Event: &model.Event{ID: "skip"}}
+		resp <- &EventResponse{Error: fmt.Errorf("error")}
+		close(resp)
+	}()
+
+	matched := MatchResponses(resp, func(ev *model.Event) bool {
+		return ev.ID == "keep"
+	})
+
+	results := []*EventResponse{}
+	for event := range matched {
+		results = append(results, event)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 responses, but got %d", len(results))
+	}
+	if results[0].Event.ID != "keep" {
+		t.Fatal("Expected the matching event to pass.")
+	}
+	if results[1].Error == nil {
+		t.Fatal("Expected the error to pass through.")
+	}
+}
+
+func TestFindQuery(t *testing.T) {
+	mock := NewWebsocketMock().
+		Expect("{\"start\":10,\"tags\":[\"^db$\"]}").
+		Respond("ok").
+		Respond(strings.Join([]string{
+			"event:71 65 6",
+			"id:id-001",
+			"timestamp:1551733035.230000",
+			"source:/src",
+			"tags:tag1,tag2",
+			"event1",
+		}, "\n")).
+		Respond(strings.Join([]string{
+			"event:72 66 6",
+			"id:id-002",
+			"timestamp:1551733035.230000",
+			"source:/api/",
+			"tags:tag1,tag2",
+			"event2",
+		}, "\n"))
+
+	client := NewWebsocketClient(mock.MockURL)
+
+	resp, err := FindQuery(client, "tag:db time>=10 source:/api/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.WaitRequestsToComplete(1)
+	if mock.Errors != nil {
+		for _, err := range mock.Errors {
+			t.Log(err)
+		}
+		t.FailNow()
+	}
+
+	event := <-resp
+	if event.Error != nil {
+		t.Fatal(event.Error)
+	}
+	if event.Event == nil || event.Event.ID != "id-002" {
+		t.Fatal("Expected the event to be filtered on the client side.")
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/theia-log/selene/model"
@@ -27,7 +30,7 @@ func (d *theiaData) IsACK() bool {
 
 // GetServerError checks if the data packet from the server is actually an error
 // instead of event data.
-// If so, it returns an error. Otherwise returns nil.
+// If so, it returns a *ServerError. Otherwise returns nil.
 func (d *theiaData) GetServerError() error {
 	if d.data == nil {
 		return nil
@@ -39,56 +42,174 @@ func (d *theiaData) GetServerError() error {
 			// it is not a server error
 			return nil
 		}
-		return fmt.Errorf(errMap["error"])
+		return &ServerError{
+			Message: errMap["error"],
+			Payload: d.data,
+		}
 	}
 	return nil
 }
 
+// closeTimeout is the time to wait for the server to confirm the close
+// message, before the connection is broken up.
+const closeTimeout = time.Second
+
 // theiaConn represents an open websocket connection to Theia sever.
-// This connection can be reused.
+// The writes to the connection are serialized, so the connection can be
+// written to from multiple goroutines.
 type theiaConn struct {
+	// lastSend is the time of the last Send, in Unix nanoseconds. Kept first
+	// for the alignment of the atomic operations.
+	lastSend int64
+
 	url  string
 	conn *websocket.Conn
+
+	// dialer opens the connection to dialURL. This is the same as url, unless
+	// the server listens on a unix socket.
+	dialer  *websocket.Dialer
+	dialURL string
+
+	// keepalive is the interval of the pings, and pongTimeout is the time to
+	// wait for the pong. Zero keepalive disables the pings.
+	keepalive   time.Duration
+	pongTimeout time.Duration
+
+	// writeTimeout limits the time to write a message. Zero means no limit.
+	writeTimeout time.Duration
+
+	// writeMux serializes the writes, as the websocket connection supports
+	// only one concurrent writer.
+	writeMux sync.Mutex
+
+	// closed is set when the client closes the connection, so the reader can
+	// tell that apart from a broken connection.
+	closed *int32
+
+	data     chan *theiaData
+	done     chan struct{}
+	readDone chan struct{}
 }
 
 // Open connects and opens the actual connection to Theia.
+// Once open, the connection is read in the background, and pinged if
+// keepalive is set.
 func (t *theiaConn) Open() error {
-	c, _, err := websocket.DefaultDialer.Dial(t.url, nil)
+	c, _, err := t.dialer.Dial(t.dialURL, nil)
 	if err != nil {
-		return err
+		return &TransportError{Op: "dial", URL: t.url, Err: err}
 	}
 	t.conn = c
+	t.closed = new(int32)
+	t.done = make(chan struct{})
+	t.readDone = make(chan struct{})
+	atomic.StoreInt64(&t.lastSend, time.Now().UnixNano())
+	if t.keepalive > 0 {
+		t.extendReadDeadline()
+		c.SetPongHandler(func(string) error {
+			return t.extendReadDeadline()
+		})
+		go t.ping()
+	}
+	t.data = t.read()
 	return nil
 }
 
+// extendReadDeadline gives the server another keepalive interval to send a
+// message or answer a ping.
+func (t *theiaConn) extendReadDeadline() error {
+	if t.keepalive <= 0 {
+		return nil
+	}
+	return t.conn.SetReadDeadline(time.Now().Add(t.keepalive + t.pongTimeout))
+}
+
+// ping pings the server periodically, until the connection is closed. If the
+// server does not answer, the read deadline breaks the connection.
+func (t *theiaConn) ping() {
+	ticker := time.NewTicker(t.keepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(t.pongTimeout)); err != nil {
+				return
+			}
+		case <-t.done:
+			return
+		case <-t.readDone:
+			return
+		}
+	}
+}
+
 // Send sends raw data to theia server.
 func (t *theiaConn) Send(data []byte) error {
-	return t.conn.WriteMessage(websocket.BinaryMessage, data)
+	t.writeMux.Lock()
+	defer t.writeMux.Unlock()
+	atomic.StoreInt64(&t.lastSend, time.Now().UnixNano())
+	if t.writeTimeout > 0 {
+		t.conn.SetWriteDeadline(time.Now().Add(t.writeTimeout))
+	}
+	if err := t.conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		return &TransportError{Op: "write", URL: t.url, Err: err}
+	}
+	return nil
 }
 
-// Read consumes data (websocket messages) from the open websocket channel to
-//  theia server.
-// Once the data is received, it is wrapped in theiaData packet.
+// discard drops the messages read from the connection, for the connections
+// whose messages are not needed.
+func (t *theiaConn) discard() {
+	go func() {
+		for range t.data {
+		}
+	}()
+}
+
+// isClosed checks if the client closed the connection.
+func (t *theiaConn) isClosed() bool {
+	return atomic.LoadInt32(t.closed) != 0
+}
+
+// idle returns the time since the last Send.
+func (t *theiaConn) idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&t.lastSend)))
+}
+
+// Read returns the channel of data (websocket messages) read from the open
+// websocket channel to theia server.
+// The messages are read from the moment the connection is opened. Once the
+// data is received, it is wrapped in theiaData packet.
 // These packets are then published on a theiaData channel for further
-// processing.
+// processing. The channel is closed after the first error.
 func (t *theiaConn) Read() chan *theiaData {
+	return t.data
+}
+
+// read consumes the websocket messages in the background.
+func (t *theiaConn) read() chan *theiaData {
 	dataChan := make(chan *theiaData)
+	conn, closed, url := t.conn, t.closed, t.url
 	go func() {
 		for {
-			messageType, data, err := t.conn.ReadMessage()
+			messageType, data, err := conn.ReadMessage()
 			if err != nil {
+				close(t.readDone)
 				dataChan <- &theiaData{
-					err: err,
+					err: readError(url, err, atomic.LoadInt32(closed) != 0),
 				}
 				close(dataChan)
 				return
 			}
+			t.extendReadDeadline()
 			switch messageType {
 			case websocket.CloseMessage:
+				close(t.readDone)
 				dataChan <- &theiaData{
-					err: fmt.Errorf(string(data)),
+					err: &ClosedError{Reason: string(data)},
 				}
 				close(dataChan)
+				return
 			case websocket.BinaryMessage:
 				dataChan <- &theiaData{
 					data: data,
@@ -107,49 +228,241 @@ func (t *theiaConn) Read() chan *theiaData {
 
 // Close closes the underlying websocket connection with the given reason.
 // A formal close message is issued to the server before breaking up
-// the connection.
+// the connection, and the server is given a moment to confirm it, so that the
+// messages already on the way are read. Closing the connection again has no
+// effect.
 func (t *theiaConn) Close(reason string) error {
-	return t.conn.WriteMessage(websocket.CloseMessage,
-		websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason))
+	if !atomic.CompareAndSwapInt32(t.closed, 0, 1) {
+		return nil
+	}
+	close(t.done)
+	// the connection may already be broken, it is closed anyway
+	t.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason),
+		time.Now().Add(closeTimeout))
+	timer := time.NewTimer(closeTimeout)
+	defer timer.Stop()
+	select {
+	case <-t.readDone:
+	case <-timer.C:
+	}
+	return t.conn.Close()
+}
+
+// readError converts the error from reading a websocket message into
+// ClosedError, if the connection was closed by either side, or TransportError.
+func readError(url string, err error, closedByClient bool) error {
+	// abnormal closure means that the connection broke without a close
+	// message, which is a transport error
+	if closeErr, ok := err.(*websocket.CloseError); ok && closeErr.Code != websocket.CloseAbnormalClosure {
+		return &ClosedError{Code: closeErr.Code, Reason: closeErr.Text}
+	}
+	if closedByClient {
+		return &ClosedError{Reason: "client closed"}
+	}
+	return &TransportError{Op: "read", URL: url, Err: err}
 }
 
 // newConn creates new raw theia connection to a given server and for a
 // particular action.
 func newConn(baseURL, action string) *theiaConn {
-	return &theiaConn{
-		url: fmt.Sprintf("%s/%s", baseURL, action),
+	socket, _ := unixSocket(baseURL)
+	return newConnWith(baseURL, action, newDialer(socket))
+}
+
+// newConnWith creates new raw theia connection that is opened with the given
+// dialer.
+func newConnWith(baseURL, action string, dialer *websocket.Dialer) *theiaConn {
+	conn := &theiaConn{
+		url:     fmt.Sprintf("%s/%s", baseURL, action),
+		dialer:  dialer,
+		dialURL: fmt.Sprintf("%s/%s", baseURL, action),
 	}
+	if _, ok := unixSocket(baseURL); ok {
+		// the host is only used for the Host header
+		conn.dialURL = "ws://localhost/" + action
+	}
+	return conn
 }
 
+// Default connection lifecycle settings of the WebsocketClient.
+const (
+	// DefaultKeepalive is the default interval of the pings to the server.
+	DefaultKeepalive = 30 * time.Second
+
+	// DefaultPongTimeout is the default time to wait for the server to answer
+	// a ping.
+	DefaultPongTimeout = 10 * time.Second
+
+	// DefaultWriteTimeout is the default time limit for writing a message.
+	DefaultWriteTimeout = 10 * time.Second
+
+	// DefaultIdleTimeout is the default time after which an unused /event
+	// connection is closed.
+	DefaultIdleTimeout = 5 * time.Minute
+)
+
 // WebsocketClient implements the Client interface.
 // Implements a client to a particular Theia server.
-// Connections to the theia actions, like /event, /find and /live are reused if
-// possible - new connections will not be opened if a channel is already
-// established on the endpoint.
+// The events are sent over a single connection to /event, which is opened on
+// the first Send and reused afterwards. Every Find and Receive opens a new
+// connection to /find or /live, which is closed once the stream ends.
+// The connections are pinged periodically, so a connection that silently
+// died (for example behind a NAT) is noticed: the /event connection is
+// reopened on the next Send, and the streams end with a *TransportError.
+// The /event connection is closed when not used for a while.
+// The WebsocketClient is safe for concurrent use. The settings (Keepalive,
+// WriteTimeout, IdleTimeout, Proxy and DialTimeout) must be set before the
+// client is used.
 type WebsocketClient struct {
-	baseURL     string
-	connections map[string]*theiaConn
+	baseURL      string
+	dialer       *websocket.Dialer
+	keepalive    time.Duration
+	pongTimeout  time.Duration
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+
+	mux     sync.Mutex
+	event   *theiaConn
+	streams map[*theiaConn]bool
+}
+
+// Keepalive sets the interval of the pings, and the time to wait for the
+// server to answer. Zero interval disables the pings.
+// Returns pointer to this WebsocketClient.
+func (w *WebsocketClient) Keepalive(interval, pongTimeout time.Duration) *WebsocketClient {
+	w.keepalive = interval
+	w.pongTimeout = pongTimeout
+	return w
+}
+
+// WriteTimeout sets the time limit for writing a message to the server. Zero
+// means no limit.
+// Returns pointer to this WebsocketClient.
+func (w *WebsocketClient) WriteTimeout(timeout time.Duration) *WebsocketClient {
+	w.writeTimeout = timeout
+	return w
+}
+
+// IdleTimeout sets the time after which an unused /event connection is
+// closed. Zero keeps the connection open until the client is closed.
+// Returns pointer to this WebsocketClient.
+func (w *WebsocketClient) IdleTimeout(timeout time.Duration) *WebsocketClient {
+	w.idleTimeout = timeout
+	return w
 }
 
-// getConn returns an exiting connection for a particular endpoint.
-// The connections are reused, new connection is created only if a connection to
-// the requested endpoint does not exist.
-func (w *WebsocketClient) getConn(endpoint string) (*theiaConn, error) {
-	conn, ok := w.connections[endpoint]
-	if !ok {
-		return nil, fmt.Errorf("no such endpoint")
+// Proxy sets the proxy to connect through. By default, the proxy is taken from
+// the environment (see ParseProxy). The proxy is not used for unix sockets.
+// Returns pointer to this WebsocketClient.
+func (w *WebsocketClient) Proxy(proxy ProxyFunc) *WebsocketClient {
+	if _, ok := unixSocket(w.baseURL); !ok {
+		w.dialer.Proxy = proxy
 	}
-	if conn.conn == nil {
+	return w
+}
+
+// DialTimeout sets the time limit for connecting to the server, including the
+// handshake. Zero means no limit.
+// Returns pointer to this WebsocketClient.
+func (w *WebsocketClient) DialTimeout(timeout time.Duration) *WebsocketClient {
+	w.dialer.HandshakeTimeout = timeout
+	return w
+}
+
+// newConn creates a connection to the endpoint with the client settings.
+func (w *WebsocketClient) newConn(endpoint string) *theiaConn {
+	conn := newConnWith(w.baseURL, endpoint, w.dialer)
+	conn.keepalive = w.keepalive
+	conn.pongTimeout = w.pongTimeout
+	conn.writeTimeout = w.writeTimeout
+	return conn
+}
+
+// eventConn returns the connection to /event, opening it if needed.
+func (w *WebsocketClient) eventConn() (*theiaConn, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.event == nil {
+		conn := w.newConn("event")
 		if err := conn.Open(); err != nil {
 			return nil, err
 		}
+		w.event = conn
+		go w.watchEvent(conn)
+		if w.idleTimeout > 0 {
+			go w.reapIdle(conn)
+		}
 	}
+	return w.event, nil
+}
+
+// watchEvent reads the /event connection, so that a broken connection is
+// dropped before the next Send. The messages from the server are ignored, as
+// the events are not acknowledged.
+func (w *WebsocketClient) watchEvent(conn *theiaConn) {
+	for data := range conn.Read() {
+		if data.err != nil {
+			w.dropEvent(conn, "connection broken")
+		}
+	}
+}
+
+// reapIdle closes the /event connection once it has not been used for the
+// idle timeout.
+func (w *WebsocketClient) reapIdle(conn *theiaConn) {
+	timer := time.NewTimer(w.idleTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			idle := conn.idle()
+			if idle >= w.idleTimeout {
+				w.dropEvent(conn, "idle")
+				return
+			}
+			timer.Reset(w.idleTimeout - idle)
+		case <-conn.done:
+			return
+		}
+	}
+}
+
+// dropEvent closes the /event connection, so that the next Send opens a new
+// one.
+func (w *WebsocketClient) dropEvent(conn *theiaConn, reason string) {
+	w.mux.Lock()
+	if w.event == conn {
+		w.event = nil
+	}
+	w.mux.Unlock()
+	conn.Close(reason)
+}
+
+// openStream opens a new connection to the endpoint and tracks it until the
+// stream ends or the client is closed.
+func (w *WebsocketClient) openStream(endpoint string) (*theiaConn, error) {
+	conn := w.newConn(endpoint)
+	if err := conn.Open(); err != nil {
+		return nil, err
+	}
+	w.mux.Lock()
+	w.streams[conn] = true
+	w.mux.Unlock()
 	return conn, nil
 }
 
+// closeStream stops tracking the stream connection and closes it.
+func (w *WebsocketClient) closeStream(conn *theiaConn) {
+	w.mux.Lock()
+	delete(w.streams, conn)
+	w.mux.Unlock()
+	conn.Close("stream ended")
+}
+
 // Send send an event to the server.
 func (w *WebsocketClient) Send(event *model.Event) error {
-	conn, err := w.getConn("event")
+	conn, err := w.eventConn()
 	if err != nil {
 		return err
 	}
@@ -157,7 +470,21 @@ func (w *WebsocketClient) Send(event *model.Event) error {
 	if err != nil {
 		return err
 	}
-	return conn.Send(data)
+	err = conn.Send(data)
+	if err != nil && conn.isClosed() {
+		// the connection was closed in the meantime as idle or broken, so
+		// the event is sent over a new one
+		if conn, err = w.eventConn(); err != nil {
+			return err
+		}
+		err = conn.Send(data)
+	}
+	if err != nil {
+		// drop the broken connection, the next Send opens a new one
+		w.dropEvent(conn, "write failed")
+		return err
+	}
+	return nil
 }
 
 // doReceive sends EventFilter data to the endpoint on the server, then listens
@@ -165,17 +492,19 @@ func (w *WebsocketClient) Send(event *model.Event) error {
 // The returned theiaData packets are decoded to EventResponse structure and
 // published on the EventResponse channel.
 func (w *WebsocketClient) doReceive(endpoint string, filter *EventFilter) (chan *EventResponse, error) {
-	conn, err := w.getConn(endpoint)
+	filterData, err := filter.DumpBytes()
 	if err != nil {
 		return nil, err
 	}
 
-	filterData, err := filter.DumpBytes()
+	conn, err := w.openStream(endpoint)
 	if err != nil {
 		return nil, err
 	}
 
 	if err = conn.Send(filterData); err != nil {
+		conn.discard()
+		w.closeStream(conn)
 		return nil, err
 	}
 
@@ -183,10 +512,12 @@ func (w *WebsocketClient) doReceive(endpoint string, filter *EventFilter) (chan
 	eventChan := make(chan *EventResponse)
 
 	go func() {
+		var err error
 		for {
 			data, ok := <-dataChan
 			if !ok {
 				// channel closed
+				w.closeStream(conn)
 				close(eventChan)
 				break
 			}
@@ -210,7 +541,7 @@ func (w *WebsocketClient) doReceive(endpoint string, filter *EventFilter) (chan
 			ev := &model.Event{}
 			if err = ev.LoadBytes(data.data); err != nil {
 				eventChan <- &EventResponse{
-					Error: err,
+					Error: &DecodeError{Payload: data.data, Err: err},
 				}
 				continue
 			}
@@ -234,15 +565,58 @@ func (w *WebsocketClient) Find(filter *EventFilter) (chan *EventResponse, error)
 	return w.doReceive("find", filter)
 }
 
+// Close closes all open connections to the server.
+// A close message is sent to the server on every open connection, and the
+// server is given a moment to confirm it, then the underlying socket is
+// closed. The streams opened with Find and Receive are closed as well, and end
+// with a *ClosedError. The client can be reused after Close - new connections
+// are opened as needed.
+func (w *WebsocketClient) Close() error {
+	w.mux.Lock()
+	conns := make([]*theiaConn, 0, len(w.streams)+1)
+	if w.event != nil {
+		conns = append(conns, w.event)
+		w.event = nil
+	}
+	for conn := range w.streams {
+		conns = append(conns, conn)
+	}
+	w.streams = map[*theiaConn]bool{}
+	w.mux.Unlock()
+
+	// the connections are closed in parallel, so that the slow ones do not
+	// hold up the rest
+	errs := make([]error, len(conns))
+	wg := sync.WaitGroup{}
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn *theiaConn) {
+			defer wg.Done()
+			errs[i] = conn.Close("client closed")
+		}(i, conn)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // NewWebsocketClient creates new websocket Client to theia server on the given
-// server URL.
+// server URL: ws:// or wss://, or unix:// followed by the socket path (for
+// example unix:///var/run/theia.sock) for a local server listening on a unix
+// socket.
 func NewWebsocketClient(serverURL string) *WebsocketClient {
+	socket, _ := unixSocket(serverURL)
 	return &WebsocketClient{
-		baseURL: serverURL,
-		connections: map[string]*theiaConn{
-			"event": newConn(serverURL, "event"),
-			"live":  newConn(serverURL, "live"),
-			"find":  newConn(serverURL, "find"),
-		},
+		baseURL:      serverURL,
+		dialer:       newDialer(socket),
+		keepalive:    DefaultKeepalive,
+		pongTimeout:  DefaultPongTimeout,
+		writeTimeout: DefaultWriteTimeout,
+		idleTimeout:  DefaultIdleTimeout,
+		streams:      map[*theiaConn]bool{},
 	}
 }
@@ -133,8 +133,9 @@ func (w *WebsocketMock) Terminate() error {
 func NewWebsocketMock() *WebsocketMock {
 	mock := &WebsocketMock{
 		upgrader: websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
+			ReadBufferSize:    1024,
+			WriteBufferSize:   1024,
+			EnableCompression: true,
 		},
 		done: make(chan bool, 5),
 	}
@@ -1,9 +1,15 @@
 package comm
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/theia-log/selene/model"
 )
 
@@ -129,3 +135,292 @@ func TestWebsocketClientFind(t *testing.T) {
 		t.Fatal("Event not parsed properly")
 	}
 }
+
+// TestWebsocketClientCompression tests that the client negotiates per-message
+// deflate compression with the server.
+func TestWebsocketClientCompression(t *testing.T) {
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	extensions := make(chan string, 1)
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		extensions <- req.Header.Get("Sec-Websocket-Extensions")
+		conn, err := upgrader.Upgrade(resp, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		received <- string(data)
+	}))
+	defer server.Close()
+
+	client := NewWebsocketClient("ws" + strings.TrimPrefix(server.URL, "http"))
+	content := strings.Repeat("compressible content ", 1000)
+	if err := client.Send(&model.Event{ID: "id-001", Content: content}); err != nil {
+		t.Fatal(err)
+	}
+	if ext := <-extensions; !strings.Contains(ext, "permessage-deflate") {
+		t.Fatalf("Expected per-message deflate to be offered, but got: %q", ext)
+	}
+	if data := <-received; !strings.HasSuffix(data, content) {
+		t.Fatalf("Event not received properly: %.100s", data)
+	}
+}
+
+// testServer is a websocket server for the client tests. Unless a handler is
+// given, it counts the received events, answers every /find request with one
+// event and keeps /live open.
+type testServer struct {
+	*httptest.Server
+	mux    sync.Mutex
+	events int
+	conns  int
+}
+
+// startTestServer starts the testServer on a local port. If handler is set,
+// it is called for every connection instead.
+func startTestServer(handler func(path string, conn *websocket.Conn)) *testServer {
+	s := &testServer{}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(resp, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.mux.Lock()
+		s.conns++
+		s.mux.Unlock()
+		if handler != nil {
+			handler(req.URL.Path, conn)
+			return
+		}
+		s.serve(req.URL.Path, conn)
+	}))
+	return s
+}
+
+func (s *testServer) serve(path string, conn *websocket.Conn) {
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		switch path {
+		case "/event":
+			s.mux.Lock()
+			s.events++
+			s.mux.Unlock()
+		case "/find":
+			conn.WriteMessage(websocket.TextMessage, []byte("ok"))
+			data, _ := (&model.Event{ID: "found", Content: "event"}).DumpBytes()
+			conn.WriteMessage(websocket.BinaryMessage, data)
+			conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		case "/live":
+			conn.WriteMessage(websocket.TextMessage, []byte("ok"))
+		}
+	}
+}
+
+func (s *testServer) url() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+func (s *testServer) counts() (int, int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.events, s.conns
+}
+
+// waitEvents waits until the server received n events.
+func (s *testServer) waitEvents(t *testing.T, n int) {
+	for i := 0; i < 200; i++ {
+		if events, _ := s.counts(); events >= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d events to be received.", n)
+}
+
+func TestWebsocketClient_concurrentSend(t *testing.T) {
+	server := startTestServer(nil)
+	defer server.Close()
+	client := NewWebsocketClient(server.url())
+	defer client.Close()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := client.Send(&model.Event{ID: fmt.Sprintf("%d-%d", i, j), Content: "event"}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	server.waitEvents(t, 200)
+	if _, conns := server.counts(); conns != 1 {
+		t.Fatalf("Expected the events to share one connection, but got %d.", conns)
+	}
+}
+
+func TestWebsocketClient_concurrentFind(t *testing.T) {
+	server := startTestServer(nil)
+	defer server.Close()
+	client := NewWebsocketClient(server.url())
+	defer client.Close()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Find(Filter(0))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			found := 0
+			for event := range resp {
+				if event.Event != nil {
+					found++
+				}
+			}
+			if found != 1 {
+				t.Errorf("Expected 1 event, but got %d.", found)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, conns := server.counts(); conns != 10 {
+		t.Fatalf("Expected a connection per Find, but got %d.", conns)
+	}
+}
+
+func TestWebsocketClient_closeStreams(t *testing.T) {
+	server := startTestServer(nil)
+	defer server.Close()
+	client := NewWebsocketClient(server.url())
+
+	streams := []chan *EventResponse{}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Receive(Filter(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		streams = append(streams, resp)
+	}
+	if err := client.Send(&model.Event{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for _, resp := range streams {
+			for event := range resp {
+				if _, ok := event.Error.(*ClosedError); !ok {
+					t.Errorf("Expected ClosedError, but got %v", event.Error)
+				}
+			}
+		}
+		close(done)
+	}()
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected all streams to be closed.")
+	}
+
+	// the client can be used again
+	if err := client.Send(&model.Event{ID: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
+
+func TestWebsocketClient_pongTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server := startTestServer(func(path string, conn *websocket.Conn) {
+		conn.ReadMessage()
+		conn.WriteMessage(websocket.TextMessage, []byte("ok"))
+		// stop reading, so the pings are never answered
+		<-release
+	})
+	defer server.Close()
+
+	client := NewWebsocketClient(server.url()).Keepalive(50*time.Millisecond, 50*time.Millisecond)
+	defer client.Close()
+	resp, err := client.Receive(Filter(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-resp:
+		if _, ok := event.Error.(*TransportError); !ok {
+			t.Fatalf("Expected TransportError, but got %v", event.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the dead connection to be noticed.")
+	}
+}
+
+func TestWebsocketClient_idleTimeout(t *testing.T) {
+	server := startTestServer(nil)
+	defer server.Close()
+	client := NewWebsocketClient(server.url()).IdleTimeout(50 * time.Millisecond)
+	defer client.Close()
+
+	for i := 1; i <= 2; i++ {
+		if err := client.Send(&model.Event{ID: fmt.Sprintf("%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	server.waitEvents(t, 2)
+	if _, conns := server.counts(); conns != 2 {
+		t.Fatalf("Expected a new connection after the idle one was closed, but got %d.", conns)
+	}
+}
+
+func TestWebsocketClient_closeHandshake(t *testing.T) {
+	closed := make(chan error, 1)
+	server := startTestServer(func(path string, conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	})
+	defer server.Close()
+
+	client := NewWebsocketClient(server.url())
+	if err := client.Send(&model.Event{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= closeTimeout {
+		t.Fatalf("Expected the server to confirm the close, but Close took %s.", elapsed)
+	}
+	err := <-closed
+	if closeErr, ok := err.(*websocket.CloseError); !ok || closeErr.Code != websocket.CloseNormalClosure || closeErr.Text != "client closed" {
+		t.Fatalf("Expected normal close from the client, but got %v", err)
+	}
+}
@@ -4,10 +4,12 @@ go 1.13
 
 require (
 	github.com/fsnotify/fsnotify v1.4.7
+	github.com/gdamore/tcell v1.4.0
 	github.com/gorilla/websocket v1.4.0
+	github.com/klauspost/compress v1.11.13
 	github.com/logrusorgru/aurora v0.0.0-20181002194514-a7b3b318ed4e
+	github.com/mattn/go-runewidth v0.0.7
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
 	github.com/satori/go.uuid v1.2.1-0.20181028125025-b2ce2384e17b
-	golang.org/x/sys v0.0.0-20190124100055-b90733256f2e // indirect
 	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
 )
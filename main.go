@@ -12,6 +12,11 @@ func main() {
 		AddCommand("watch", cli.WatcherCommand, "Watch for file changes. Runs selene in agent mode.").
 		AddCommand("query", cli.QueryCommand, "Query the server for past and live events.").
 		AddCommand("event", cli.EventCommand, "Generate event and publish to Theia server.").
+		AddCommand("export", cli.ExportCommand, "Export past events to an archive file.").
+		AddCommand("import", cli.ImportCommand, "Import events from an archive file and publish them to Theia server.").
+		AddCommand("stats", cli.StatsCommand, "Count past events by tag, source and time.").
+		AddCommand("tui", cli.TUICommand, "Browse and tail events in an interactive terminal view.").
+		AddCommand("serve", cli.ServeCommand, "Run a local Theia compatible server.").
 		AddCommand("version", printVersion, "Print selene version and exit.")
 
 	if err := selene.Execute(); err != nil {
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxEventSize is the default limit of the size of a single event
+// frame (header and content), in bytes, for the Decoder and the Encoder.
+const DefaultMaxEventSize = 16 * 1024 * 1024
+
+// maxPreambleSize is the maximal length of the preamble line. The preamble
+// holds only three numbers, so anything longer than this is not a preamble.
+const maxPreambleSize = 128
+
+// FrameError is returned by the Decoder when an event frame cannot be read
+// or parsed. It holds the position of the offending event in the stream.
+type FrameError struct {
+	// Event is the ordinal number (starting from 1) of the event in the stream.
+	Event int
+
+	// Offset is the byte offset in the stream where the event frame starts.
+	Offset int64
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("event %d at offset %d: %s", e.Event, e.Offset, e.Err.Error())
+}
+
+// Unwrap returns the underlying error.
+func (e *FrameError) Unwrap() error {
+	return e.Err
+}
+
+// Corrupted checks if the frame is invalid or incomplete, as opposed to a
+// failure to read the underlying stream.
+func (e *FrameError) Corrupted() bool {
+	for _, cause := range []error{
+		io.ErrUnexpectedEOF,
+		ErrInvalidPreamble,
+		ErrSizeMismatch,
+		ErrInvalidHeader,
+		ErrInvalidField,
+	} {
+		if errors.Is(e.Err, cause) {
+			return true
+		}
+	}
+	return false
+}
+
+// Decoder reads a sequence of preamble-framed events from an input stream.
+// The events may be separated by blank lines.
+// The Decoder reads only one event frame in memory at a time, and refuses to
+// read events larger than the maximal event size.
+type Decoder struct {
+	reader  *bufio.Reader
+	maxSize int64
+	offset  int64
+	count   int
+}
+
+// NewDecoder creates a new Decoder that reads the events from r. The Decoder
+// buffers the input, so it may read more data from r than the events that
+// were decoded.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		reader:  bufio.NewReader(r),
+		maxSize: DefaultMaxEventSize,
+	}
+}
+
+// MaxSize sets the maximal size of an event frame (header and content), in
+// bytes. If zero or negative, the size of the events is not limited.
+func (d *Decoder) MaxSize(size int64) *Decoder {
+	d.maxSize = size
+	return d
+}
+
+// Offset returns the number of bytes from the stream consumed so far.
+func (d *Decoder) Offset() int64 {
+	return d.offset
+}
+
+// Decode reads the next event from the stream and stores it in ev.
+// Returns io.EOF when there are no more events in the stream. If the stream
+// ends in the middle of an event, the error wraps io.ErrUnexpectedEOF.
+// All other errors are returned as *FrameError.
+func (d *Decoder) Decode(ev *Event) error {
+	if err := d.skipBlank(); err != nil {
+		return err
+	}
+	d.count++
+	start := d.offset
+	frameError := func(err error) error {
+		return &FrameError{Event: d.count, Offset: start, Err: err}
+	}
+
+	preamble, err := d.readPreamble()
+	if err != nil {
+		return frameError(err)
+	}
+	total, header, content, err := parsePreamble(preamble)
+	if err != nil {
+		return frameError(err)
+	}
+	if d.maxSize > 0 && total > d.maxSize {
+		return frameError(fmt.Errorf("%w: size %d exceeds the limit of %d bytes", ErrEventTooLarge, total, d.maxSize))
+	}
+
+	frame := make([]byte, total)
+	read, err := io.ReadFull(d.reader, frame)
+	d.offset += int64(read)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return frameError(err)
+	}
+
+	*ev = Event{}
+	if err = ev.loadHeader(frame[:header]); err != nil {
+		return frameError(err)
+	}
+	ev.Content = string(frame[header : header+content])
+	return nil
+}
+
+// skipBlank skips the blank lines between the event frames.
+func (d *Decoder) skipBlank() error {
+	for {
+		c, err := d.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if c != '\n' && c != '\r' && c != ' ' && c != '\t' {
+			return d.reader.UnreadByte()
+		}
+		d.offset++
+	}
+}
+
+// readPreamble reads the preamble line, without the trailing new line.
+func (d *Decoder) readPreamble() ([]byte, error) {
+	var preamble []byte
+	for {
+		c, err := d.reader.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		d.offset++
+		if c == '\n' {
+			return preamble, nil
+		}
+		if len(preamble) >= maxPreambleSize {
+			return nil, fmt.Errorf("%w: line too long", ErrInvalidPreamble)
+		}
+		preamble = append(preamble, c)
+	}
+}
+
+// Encoder writes events to an output stream, in the same preamble-framed
+// format as the events are sent to the server, separated by a new line.
+type Encoder struct {
+	writer  io.Writer
+	maxSize int64
+}
+
+// NewEncoder creates a new Encoder that writes the events to w.
+// Every event is written with a single call to w.Write.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		writer:  w,
+		maxSize: DefaultMaxEventSize,
+	}
+}
+
+// MaxSize sets the maximal size of an event frame (header and content), in
+// bytes. If zero or negative, the size of the events is not limited.
+func (e *Encoder) MaxSize(size int64) *Encoder {
+	e.maxSize = size
+	return e
+}
+
+// Encode serializes the event and writes it to the stream. Returns an error
+// if the event is larger than the maximal event size; nothing is written in
+// that case.
+func (e *Encoder) Encode(ev *Event) error {
+	frame, err := ev.dump()
+	if err != nil {
+		return err
+	}
+	if e.maxSize > 0 && int64(len(frame)) > e.maxSize {
+		return fmt.Errorf("%w: size %d exceeds the limit of %d bytes", ErrEventTooLarge, len(frame), e.maxSize)
+	}
+	var buff bytes.Buffer
+	buff.Grow(len(frame) + maxPreambleSize)
+	fmt.Fprintf(&buff, "event:%d %d %d\n", len(frame), len(frame)-len(ev.Content), len(ev.Content))
+	buff.WriteString(frame)
+	buff.WriteByte('\n')
+	_, err = e.writer.Write(buff.Bytes())
+	return err
+}
@@ -0,0 +1,140 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func codecEvents() []*Event {
+	return []*Event{
+		{ID: "id-1", Timestamp: 1509989630.5, Source: "/src", Tags: []string{"a", "b"}, Content: "first\nmultiline\n"},
+		{ID: "id-2", Timestamp: 1509989631, Source: "/src", Content: ""},
+		{ID: "id-3", Timestamp: 1509989632.25, Source: "/other", Tags: []string{"c"}, Content: "third"},
+	}
+}
+
+// TestEncodeDecode tests round trip of a sequence of events through the
+// Encoder and the Decoder.
+func TestEncodeDecode(t *testing.T) {
+	var buff bytes.Buffer
+	encoder := NewEncoder(&buff)
+	for _, ev := range codecEvents() {
+		if err := encoder.Encode(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := int64(buff.Len())
+
+	decoder := NewDecoder(&buff)
+	for i, expected := range codecEvents() {
+		ev := &Event{}
+		if err := decoder.Decode(ev); err != nil {
+			t.Fatalf("event %d: %s", i, err.Error())
+		}
+		if ev.ID != expected.ID || ev.Timestamp != expected.Timestamp || ev.Source != expected.Source || ev.Content != expected.Content {
+			t.Fatalf("Event %d decoded incorrectly: %+v", i, ev)
+		}
+		if len(ev.Tags) != len(expected.Tags) {
+			t.Fatalf("Event %d tags decoded incorrectly: %v", i, ev.Tags)
+		}
+	}
+	if err := decoder.Decode(&Event{}); err != io.EOF {
+		t.Fatalf("Expected EOF, got %v", err)
+	}
+	if decoder.Offset() != size {
+		t.Fatalf("Expected offset %d, got %d", size, decoder.Offset())
+	}
+}
+
+// TestDecoder_compatible tests that the Decoder reads the events in the format
+// produced by Dump, including the preamble with extra spaces.
+func TestDecoder_compatible(t *testing.T) {
+	data, err := codecEvents()[0].Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := strings.Join([]string{
+		data,
+		"",
+		"event: 155 133 22",
+		"id:331c531d-6eb4-4fb5-84d3-ea6937b01fdd",
+		"timestamp: 1509989630.6749051",
+		"source:/dev/sensors/door1-sensor",
+		"tags:sensors,home,doors,door1",
+		"Door has been unlocked",
+	}, "\n")
+	decoder := NewDecoder(strings.NewReader(input))
+	ev := &Event{}
+	if err = decoder.Decode(ev); err != nil {
+		t.Fatal(err)
+	}
+	if err = decoder.Decode(ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.ID != "331c531d-6eb4-4fb5-84d3-ea6937b01fdd" || ev.Content != "Door has been unlocked" {
+		t.Fatalf("Event decoded incorrectly: %+v", ev)
+	}
+}
+
+// TestDecoder_errors tests that the decoding errors report the position of the
+// offending event.
+func TestDecoder_errors(t *testing.T) {
+	var buff bytes.Buffer
+	if err := NewEncoder(&buff).Encode(codecEvents()[0]); err != nil {
+		t.Fatal(err)
+	}
+	valid := buff.String()
+
+	cases := map[string]struct {
+		input string
+		cause error
+	}{
+		"invalid preamble": {input: valid + "not an event\n"},
+		"missing sizes":    {input: valid + "event:10 10\n"},
+		"size mismatch":    {input: valid + "event:10 5 6\nid:1\nabcdef"},
+		"too large":        {input: valid + "event:100000 99999 1\n"},
+		"long preamble":    {input: valid + "event:" + strings.Repeat("1", 200) + "\n"},
+		"truncated":        {input: valid + "event:100 90 10\nid:1\n", cause: io.ErrUnexpectedEOF},
+	}
+
+	for name, c := range cases {
+		decoder := NewDecoder(strings.NewReader(c.input)).MaxSize(1000)
+		if err := decoder.Decode(&Event{}); err != nil {
+			t.Fatalf("%s: first event: %s", name, err.Error())
+		}
+		err := decoder.Decode(&Event{})
+		frameErr, ok := err.(*FrameError)
+		if !ok {
+			t.Fatalf("%s: expected FrameError, got %v", name, err)
+		}
+		if frameErr.Event != 2 || frameErr.Offset != int64(len(valid)) {
+			t.Fatalf("%s: wrong position: %s", name, err.Error())
+		}
+		if c.cause != nil && !errors.Is(err, c.cause) {
+			t.Fatalf("%s: expected cause %v, got %v", name, c.cause, err)
+		}
+		if corrupted := frameErr.Corrupted(); corrupted != (name != "too large") {
+			t.Fatalf("%s: expected corrupted to be %v", name, !corrupted)
+		}
+	}
+
+	readErr := &FrameError{Event: 1, Err: errors.New("read failed")}
+	if readErr.Corrupted() {
+		t.Fatal("Expected read error not to be reported as corrupted frame.")
+	}
+}
+
+// TestEncoder_maxSize tests that the Encoder refuses to write too large events.
+func TestEncoder_maxSize(t *testing.T) {
+	var buff bytes.Buffer
+	encoder := NewEncoder(&buff).MaxSize(10)
+	if err := encoder.Encode(codecEvents()[0]); err == nil {
+		t.Fatal("Expected error for too large event.")
+	}
+	if buff.Len() != 0 {
+		t.Fatal("Nothing should be written for too large event.")
+	}
+}
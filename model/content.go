@@ -0,0 +1,115 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Content types reported by Event.ContentType.
+const (
+	// ContentTypeText is the content type of events with textual content.
+	ContentTypeText = "text/plain; charset=utf-8"
+
+	// ContentTypeBinary is the content type of events with binary content.
+	ContentTypeBinary = "application/octet-stream"
+)
+
+// ContentEncodingBase64 is the value of the "content_encoding" JSON property
+// when the content is encoded with standard base64 encoding.
+const ContentEncodingBase64 = "base64"
+
+// ContentBytes returns the raw bytes of the event content.
+// The Content is a Go string, so it can hold arbitrary bytes, not only valid
+// UTF-8 text.
+func (ev *Event) ContentBytes() []byte {
+	return []byte(ev.Content)
+}
+
+// SetContentBytes sets the event content to the given raw bytes.
+func (ev *Event) SetContentBytes(content []byte) {
+	ev.Content = string(content)
+}
+
+// IsBinary returns true if the content is not printable text: it is not valid
+// UTF-8, or contains control characters other than white space and the
+// escape character (used by the terminal colors in logs).
+func (ev *Event) IsBinary() bool {
+	if !utf8.ValidString(ev.Content) {
+		return true
+	}
+	for i := 0; i < len(ev.Content); i++ {
+		c := ev.Content[i]
+		if (c < 0x20 || c == 0x7f) && !isTextControl(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTextControl checks if the control character is commonly found in text.
+func isTextControl(c byte) bool {
+	switch c {
+	case '\t', '\n', '\v', '\f', '\r', 0x1b:
+		return true
+	}
+	return false
+}
+
+// ContentType returns a hint of the type of the content: ContentTypeBinary for
+// binary content, otherwise ContentTypeText.
+func (ev *Event) ContentType() string {
+	if ev.IsBinary() {
+		return ContentTypeBinary
+	}
+	return ContentTypeText
+}
+
+// eventAlias has the same fields as the Event, but not the JSON methods.
+type eventAlias Event
+
+// eventJSON is the JSON representation of an Event. The content is base64
+// encoded if the event content is binary.
+type eventJSON struct {
+	*eventAlias
+	Content         string `json:"content,omitempty"`
+	ContentEncoding string `json:"content_encoding,omitempty"`
+}
+
+// MarshalJSON serializes the event as JSON. Binary content (see IsBinary) is
+// encoded with base64 and the "content_encoding" property is set to
+// "base64". Textual content is written as is.
+func (ev Event) MarshalJSON() ([]byte, error) {
+	data := eventJSON{
+		eventAlias: (*eventAlias)(&ev),
+		Content:    ev.Content,
+	}
+	if ev.IsBinary() {
+		data.Content = base64.StdEncoding.EncodeToString(ev.ContentBytes())
+		data.ContentEncoding = ContentEncodingBase64
+	}
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON loads the event from JSON, decoding the content if the
+// "content_encoding" property is set.
+func (ev *Event) UnmarshalJSON(data []byte) error {
+	value := eventJSON{eventAlias: (*eventAlias)(ev)}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch value.ContentEncoding {
+	case "":
+		ev.Content = value.Content
+	case ContentEncodingBase64:
+		content, err := base64.StdEncoding.DecodeString(value.Content)
+		if err != nil {
+			return err
+		}
+		ev.SetContentBytes(content)
+	default:
+		return fmt.Errorf("unknown content encoding: %s", value.ContentEncoding)
+	}
+	return nil
+}
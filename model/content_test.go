@@ -0,0 +1,93 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestIsBinary tests the detection of binary content.
+func TestIsBinary(t *testing.T) {
+	cases := map[string]bool{
+		"plain text":                   false,
+		"multi\nline\r\n\ttext":        false,
+		"\x1b[31mcolored\x1b[0m":       false,
+		"unicode: čćžšđ":               false,
+		"nul\x00byte":                  true,
+		"invalid \xff\xfe utf-8":       true,
+		string([]byte{0x89, 'P', 'N'}): true,
+	}
+	for content, binary := range cases {
+		ev := &Event{Content: content}
+		if ev.IsBinary() != binary {
+			t.Fatalf("Expected IsBinary to be %t for %q", binary, content)
+		}
+		expectedType := ContentTypeText
+		if binary {
+			expectedType = ContentTypeBinary
+		}
+		if ev.ContentType() != expectedType {
+			t.Fatalf("Expected content type %s for %q", expectedType, content)
+		}
+	}
+}
+
+// TestMarshalJSON_text tests that textual content is written as is.
+func TestMarshalJSON_text(t *testing.T) {
+	ev := &Event{ID: "1", Timestamp: 10, Source: "src", Tags: []string{"a"}, Content: "text"}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"id":"1","timestamp":10,"source":"src","tags":["a"],"content":"text"}`
+	if string(data) != expected {
+		t.Fatalf("Expected %s, but got %s", expected, string(data))
+	}
+}
+
+// TestMarshalJSON_binary tests base64 encoding of binary content in JSON.
+func TestMarshalJSON_binary(t *testing.T) {
+	ev := &Event{ID: "1", Timestamp: 10}
+	ev.SetContentBytes([]byte{0x00, 0xff, 0x10, 'a'})
+	data, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"content":"AP8QYQ==","content_encoding":"base64"`) {
+		t.Fatalf("Content not encoded properly: %s", string(data))
+	}
+
+	loaded := &Event{}
+	if err = json.Unmarshal(data, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if string(loaded.ContentBytes()) != string(ev.ContentBytes()) || loaded.ID != "1" {
+		t.Fatalf("Event not loaded properly: %+v", loaded)
+	}
+
+	if err = json.Unmarshal([]byte(`{"id":"1","content":"x","content_encoding":"rot13"}`), loaded); err == nil {
+		t.Fatal("Expected error for unknown content encoding.")
+	}
+}
+
+// TestDumpLoad_binary tests that binary content survives a Dump/Load round
+// trip unchanged.
+func TestDumpLoad_binary(t *testing.T) {
+	content := make([]byte, 256)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	ev := &Event{ID: "1"}
+	ev.SetContentBytes(content)
+	data, err := ev.DumpBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := &Event{}
+	if err = loaded.LoadBytes(data); err != nil {
+		t.Fatal(err)
+	}
+	if string(loaded.ContentBytes()) != string(content) {
+		t.Fatal("Binary content not loaded properly.")
+	}
+}
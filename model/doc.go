@@ -1,4 +1,6 @@
 // Package model contains the Event model definition and
 // tools for serializing and decoding an event from
 // byte array or string.
+// Streams of events can be read and written with the
+// Decoder and the Encoder.
 package model
@@ -0,0 +1,162 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Header values are written on a single line. A value that contains a
+// character that would break the header is escaped: it is marked with the
+// escapedPrefix, and the characters are escaped with a backslash:
+//
+//	\\      backslash
+//	\n      new line
+//	\r      carriage return
+//	\,      comma in a tag (the tags are separated by commas)
+//	\xHH    other ASCII control characters and white space at the start or
+//	        the end of the value (which would otherwise be trimmed)
+//	\uHHHH  non-ASCII white space at the start or the end of the value
+//
+// All other values, including the values with backslashes, are written
+// unchanged, and only the marked values are unescaped. So the events written
+// by the Theia servers and clients that do not know about escaping are loaded
+// unchanged, and these clients read the same values as before. In a marked
+// value, a backslash followed by anything else is kept as it is.
+
+// escapedPrefix marks an escaped header value, or an escaped tag.
+const escapedPrefix = `\~`
+
+// escapeValue escapes a header value, if needed. If tag is true, commas are
+// escaped as well.
+func escapeValue(value string, tag bool) string {
+	if !needsEscaping(value, tag) {
+		return value
+	}
+	var builder strings.Builder
+	builder.WriteString(escapedPrefix)
+	first, last := edgeSpace(value)
+	for i := 0; i < len(value); {
+		r, size := utf8.DecodeRuneInString(value[i:])
+		switch {
+		case r == '\\':
+			builder.WriteString(`\\`)
+		case r == '\n':
+			builder.WriteString(`\n`)
+		case r == '\r':
+			builder.WriteString(`\r`)
+		case r == ',' && tag:
+			builder.WriteString(`\,`)
+		case r < 0x20 || r == 0x7f || ((i < first || i >= last) && unicode.IsSpace(r)):
+			if r < utf8.RuneSelf {
+				fmt.Fprintf(&builder, `\x%02x`, r)
+			} else {
+				fmt.Fprintf(&builder, `\u%04x`, r)
+			}
+		default:
+			// write the original bytes, so invalid UTF-8 is preserved
+			builder.WriteString(value[i : i+size])
+		}
+		i += size
+	}
+	return builder.String()
+}
+
+// needsEscaping checks if the value contains any character that must be
+// escaped, or starts with the escapedPrefix and would be taken for escaped.
+func needsEscaping(value string, tag bool) bool {
+	if strings.TrimSpace(value) != value || strings.HasPrefix(value, escapedPrefix) {
+		return true
+	}
+	for _, r := range value {
+		if r < 0x20 || r == 0x7f || (r == ',' && tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// edgeSpace returns the byte offsets of the first and the end of the last
+// non-white space character in the value.
+func edgeSpace(value string) (first, last int) {
+	trimmed := strings.TrimLeftFunc(value, unicode.IsSpace)
+	first = len(value) - len(trimmed)
+	last = first + len(strings.TrimRightFunc(trimmed, unicode.IsSpace))
+	return first, last
+}
+
+// unescapeValue reverses escapeValue. The values that are not marked as
+// escaped are returned unchanged.
+func unescapeValue(value string) string {
+	if !strings.HasPrefix(value, escapedPrefix) {
+		return value
+	}
+	value = value[len(escapedPrefix):]
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			builder.WriteByte(value[i])
+			continue
+		}
+		switch next := value[i+1]; next {
+		case '\\', ',':
+			builder.WriteByte(next)
+			i++
+		case 'n':
+			builder.WriteByte('\n')
+			i++
+		case 'r':
+			builder.WriteByte('\r')
+			i++
+		case 'x', 'u':
+			size := 2
+			if next == 'u' {
+				size = 4
+			}
+			if i+2+size <= len(value) {
+				if code, err := strconv.ParseUint(value[i+2:i+2+size], 16, 32); err == nil {
+					builder.WriteRune(rune(code))
+					i += 1 + size
+					continue
+				}
+			}
+			builder.WriteByte('\\')
+		default:
+			builder.WriteByte('\\')
+		}
+	}
+	return builder.String()
+}
+
+// joinTags escapes the tags and joins them with commas.
+func joinTags(tags []string) string {
+	escaped := make([]string, len(tags))
+	for i, tag := range tags {
+		escaped[i] = escapeValue(tag, true)
+	}
+	return strings.Join(escaped, ",")
+}
+
+// splitTags splits the tags on the commas that are not escaped, and unescapes
+// every tag. In the tags that are not marked as escaped, every comma separates
+// the tags.
+func splitTags(value string) []string {
+	tags := []string{}
+	start := 0
+	escaped := strings.HasPrefix(value, escapedPrefix)
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if escaped {
+				i++
+			}
+		case ',':
+			tags = append(tags, unescapeValue(value[start:i]))
+			start = i + 1
+			escaped = strings.HasPrefix(value[start:], escapedPrefix)
+		}
+	}
+	return append(tags, unescapeValue(value[start:]))
+}
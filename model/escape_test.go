@@ -0,0 +1,108 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestEscapeValue tests escaping of the header values.
+func TestEscapeValue(t *testing.T) {
+	cases := []struct {
+		value    string
+		tag      bool
+		expected string
+	}{
+		{"/dev/sensors/door1-sensor", false, "/dev/sensors/door1-sensor"},
+		{"http://host:8080", false, "http://host:8080"},
+		{"a,b", false, "a,b"},
+		{"a,b", true, `\~a\,b`},
+		{"line1\nline2\r\n", false, `\~line1\nline2\r\n`},
+		{`C:\logs`, false, `C:\logs`},
+		{"C:\\new\n", false, `\~C:\\new\n`},
+		{" padded\t", false, `\~\x20padded\x09`},
+		{"in side", false, "in side"},
+		{"\u00a0x", false, `\~\u00a0x`},
+		{"bell\a", false, `\~bell\x07`},
+		{`\~x`, false, `\~\\~x`},
+	}
+	for _, c := range cases {
+		if escaped := escapeValue(c.value, c.tag); escaped != c.expected {
+			t.Fatalf("Expected %q to be escaped as %q, but got %q", c.value, c.expected, escaped)
+		}
+		if unescaped := unescapeValue(c.expected); unescaped != c.value {
+			t.Fatalf("Expected %q to be unescaped as %q, but got %q", c.expected, c.value, unescaped)
+		}
+	}
+}
+
+// TestUnescapeValue_unknown tests that the values that are not marked as
+// escaped are kept as they are, and so are the unknown escape sequences.
+func TestUnescapeValue_unknown(t *testing.T) {
+	cases := map[string]string{
+		`C:\logs\app.log`:   `C:\logs\app.log`,
+		`C:\new\x41`:        `C:\new\x41`,
+		`\~C:\logs\app.log`: `C:\logs\app.log`,
+		`\~trailing\`:       `trailing\`,
+		`\~\xZZ`:            `\xZZ`,
+		`\~\u12`:            `\u12`,
+	}
+	for value, expected := range cases {
+		if unescaped := unescapeValue(value); unescaped != expected {
+			t.Fatalf("Expected %q to be unescaped as %q, but got %q", value, expected, unescaped)
+		}
+	}
+}
+
+// TestLoadDump_legacy tests that the header values written by the clients that
+// do not escape are loaded and dumped back unchanged.
+func TestLoadDump_legacy(t *testing.T) {
+	header := "id:1\ntimestamp:1.000000\nsource:C:\\new\\x41\ntags:a\\,b,c\n"
+	ev := &Event{}
+	if err := ev.Load(fmt.Sprintf("event:%d %d 0\n%s", len(header), len(header), header)); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Source != `C:\new\x41` || len(ev.Tags) != 3 || ev.Tags[0] != `a\` {
+		t.Fatalf("Legacy values not loaded unchanged: %q %q", ev.Source, ev.Tags)
+	}
+	data, err := ev.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(data, "\n"+header) {
+		t.Fatalf("Legacy values not dumped unchanged:\n%s", data)
+	}
+}
+
+// TestDumpLoad_escaped tests round trip of an event with special characters in
+// the header values.
+func TestDumpLoad_escaped(t *testing.T) {
+	ev := &Event{
+		ID:      "id\nwith new line",
+		Source:  " source: with\\backslash ",
+		Tags:    []string{"a,b", "", "c\\", "d"},
+		Content: "content",
+	}
+	data, err := ev.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(data, "\n") != 5 {
+		t.Fatalf("Header values must be single line:\n%s", data)
+	}
+	loaded := &Event{}
+	if err = loaded.Load(data); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ID != ev.ID || loaded.Source != ev.Source || loaded.Content != ev.Content {
+		t.Fatalf("Event not loaded properly: %+v", loaded)
+	}
+	if len(loaded.Tags) != len(ev.Tags) {
+		t.Fatalf("Tags not loaded properly: %q", loaded.Tags)
+	}
+	for i, tag := range ev.Tags {
+		if loaded.Tags[i] != tag {
+			t.Fatalf("Tags not loaded properly: %q", loaded.Tags)
+		}
+	}
+}
@@ -1,28 +1,56 @@
 package model
 
 import (
-	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
-	"io"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	uuid "github.com/satori/go.uuid"
 )
 
+// Errors returned when parsing a malformed event. The returned
+// errors wrap these, so use errors.Is to check for them.
+var (
+	// ErrInvalidPreamble is returned when the preamble line is
+	// missing or malformed.
+	ErrInvalidPreamble = errors.New("invalid preamble")
+
+	// ErrSizeMismatch is returned when the sizes declared in the
+	// preamble do not add up or do not match the actual event data.
+	ErrSizeMismatch = errors.New("size mismatch")
+
+	// ErrInvalidHeader is returned when a header line is malformed.
+	ErrInvalidHeader = errors.New("invalid header")
+
+	// ErrInvalidField is returned when the event has a field
+	// that cannot be written in the header.
+	ErrInvalidField = errors.New("invalid field")
+
+	// ErrEventTooLarge is returned when the event exceeds the
+	// maximal allowed event size.
+	ErrEventTooLarge = errors.New("event too large")
+)
+
 // Event defines the model structure of an event.
 // Each event must have an ID, a globally unique identifier,
 // and timestamp, floating point number of seconds from 1.1.1970
 // with high degree of precision.
 // The event usually contanis a content, although that is not
 // strictly necessary. The event may contain a source and tags.
+// Any other header values are kept in Fields, as key/value
+// pairs.
 type Event struct {
-	ID        string   `json:"id"`
-	Timestamp float64  `json:"timestamp"`
-	Source    string   `json:"source,omitempty"`
-	Tags      []string `json:"tags,omitempty"`
-	Content   string   `json:"content,omitempty"`
+	ID        string            `json:"id"`
+	Timestamp float64           `json:"timestamp"`
+	Source    string            `json:"source,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Content   string            `json:"content,omitempty"`
 }
 
 // Load loads (parses) an event from a given string.
@@ -35,66 +63,73 @@ func (ev *Event) Load(eventData string) (err error) {
 // LoadBytes loads (parses) an event from an array of bytes.
 // This expects for the preamble to be present in the
 // given event data.
+// The sizes in the preamble must match the actual size of
+// the header and the content, otherwise ErrSizeMismatch is
+// returned. Only white space may follow the event frame.
 func (ev *Event) LoadBytes(eventData []byte) (err error) {
-	reader := bytes.NewReader(eventData)
-	preamble, _, headerSize, contentSize, err := parsePreamble(bufio.NewReader(reader))
-	if err != nil {
-		return err
+	end := bytes.IndexByte(eventData, '\n')
+	if end < 0 {
+		return fmt.Errorf("%w: missing new line after preamble", ErrInvalidPreamble)
 	}
-
-	buff := make([]byte, headerSize)
-	_, err = reader.Seek(preamble, io.SeekStart)
+	total, headerSize, contentSize, err := parsePreamble(eventData[:end])
 	if err != nil {
 		return err
 	}
-	if read, err := reader.Read(buff); err != nil || int64(read) != headerSize {
-		if err != nil {
-			return err
-		}
-		return fmt.Errorf("corrupted header")
+	frame := eventData[end+1:]
+	if int64(len(frame)) < total {
+		return fmt.Errorf("%w: expected %d bytes, but got only %d", ErrSizeMismatch, total, len(frame))
+	}
+	if len(bytes.TrimSpace(frame[total:])) > 0 {
+		return fmt.Errorf("%w: %d unexpected bytes after the event", ErrSizeMismatch, int64(len(frame))-total)
 	}
-	scanner := bufio.NewScanner(bytes.NewReader(buff))
+	if err = ev.loadHeader(frame[:headerSize]); err != nil {
+		return err
+	}
+	ev.Content = string(frame[headerSize : headerSize+contentSize])
+	return nil
+}
 
-	for {
-		if scanner.Err() != nil {
-			return scanner.Err()
+// loadHeader parses the header lines of the event and sets the values of the
+// known header keys. Every header line must be a key and a value separated by
+// a colon. The value is everything after the first colon.
+// The lines with keys that cannot be used as Fields keys, written by other
+// producers, are skipped, so the event can still be read.
+func (ev *Event) loadHeader(header []byte) (err error) {
+	if len(header) > 0 && header[len(header)-1] != '\n' {
+		return fmt.Errorf("%w: header does not end with a new line", ErrInvalidHeader)
+	}
+	for n, line := range strings.Split(string(header), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
 		}
-		if !scanner.Scan() {
-			break
+		sep := strings.Index(line, ":")
+		if sep < 0 {
+			return fmt.Errorf("%w: line %d: missing colon: %q", ErrInvalidHeader, n+1, line)
 		}
-		line := scanner.Text()
-		if line != "" {
-			parts := strings.Split(line, ":")
-			key := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-			switch key {
-			case "id":
-				ev.ID = value
-			case "source":
-				ev.Source = value
-			case "timestamp":
-				if ev.Timestamp, err = strconv.ParseFloat(value, 64); err != nil {
-					return err
-				}
-			case "tags":
-				ev.Tags = strings.Split(value, ",")
-			default:
-				// ignore unknown key
-			}
+		key := strings.TrimSpace(line[:sep])
+		value := strings.TrimSpace(line[sep+1:])
+		if !isReservedKey(key) && ValidateFieldKey(key) != nil {
+			continue
 		}
-
-	}
-	buff = make([]byte, contentSize)
-	if read, err := reader.Read(buff); err != nil || int64(read) != contentSize {
-		if err != nil {
-			return err
+		switch key {
+		case "id":
+			ev.ID = unescapeValue(value)
+		case "source":
+			ev.Source = unescapeValue(value)
+		case "timestamp":
+			if ev.Timestamp, err = strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("%w: line %d: invalid timestamp: %q", ErrInvalidHeader, n+1, value)
+			}
+		case "tags":
+			ev.Tags = splitTags(value)
+		default:
+			if ev.Fields == nil {
+				ev.Fields = map[string]string{}
+			}
+			ev.Fields[key] = unescapeValue(value)
 		}
-		return fmt.Errorf("corrupted content")
 	}
-
-	ev.Content = string(buff)
-
-	return
+	return nil
 }
 
 // Dump serializes the given event to a string representation.
@@ -105,8 +140,14 @@ func (ev *Event) LoadBytes(eventData []byte) (err error) {
 //	source:/dev/sensors/door1-sensor
 //	tags:sensors,home,doors,door1
 //	Door has been unlocked
+// The header values with new lines and other special characters
+// are escaped with a backslash, so any value is loaded back
+// unchanged.
 func (ev *Event) Dump() (eventData string, err error) {
-	event := ev.dump()
+	event, err := ev.dump()
+	if err != nil {
+		return "", err
+	}
 	contentSize := len([]byte(ev.Content))
 	totalSize := len([]byte(event))
 	headerSize := totalSize - contentSize
@@ -114,19 +155,63 @@ func (ev *Event) Dump() (eventData string, err error) {
 	return fmt.Sprintf("%s\n%s", preamble, event), nil
 }
 
-func (ev *Event) dump() string {
+func (ev *Event) dump() (string, error) {
 	var builder strings.Builder
 
-	builder.WriteString(fmt.Sprintf("id:%s\n", ev.ID))
+	builder.WriteString(fmt.Sprintf("id:%s\n", escapeValue(ev.ID, false)))
 	builder.WriteString(fmt.Sprintf("timestamp:%f\n", ev.Timestamp))
-	builder.WriteString(fmt.Sprintf("source:%s\n", ev.Source))
+	builder.WriteString(fmt.Sprintf("source:%s\n", escapeValue(ev.Source, false)))
 	if ev.Tags != nil {
-		builder.WriteString(fmt.Sprintf("tags:%s\n", strings.Join(ev.Tags, ",")))
+		builder.WriteString(fmt.Sprintf("tags:%s\n", joinTags(ev.Tags)))
+	}
+	keys := make([]string, 0, len(ev.Fields))
+	for key := range ev.Fields {
+		if err := ValidateFieldKey(key); err != nil {
+			return "", err
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		builder.WriteString(fmt.Sprintf("%s:%s\n", key, escapeValue(ev.Fields[key], false)))
 	}
 
 	builder.WriteString(ev.Content)
 
-	return builder.String()
+	return builder.String(), nil
+}
+
+// reservedKeys are the header keys of the Event properties, which cannot be
+// used as field keys.
+var reservedKeys = map[string]bool{
+	"id":        true,
+	"timestamp": true,
+	"source":    true,
+	"tags":      true,
+}
+
+// isReservedKey checks if the key is one of the Event property keys.
+func isReservedKey(key string) bool {
+	return reservedKeys[key]
+}
+
+// ValidateFieldKey checks if the key can be used as a key in the event Fields.
+// The key must not be empty, must not contain colons, white space or control
+// characters, and must not be one of the keys of the Event properties (id,
+// timestamp, source and tags).
+func ValidateFieldKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: empty key", ErrInvalidField)
+	}
+	if isReservedKey(key) {
+		return fmt.Errorf("%w: reserved key: %s", ErrInvalidField, key)
+	}
+	for _, r := range key {
+		if r == ':' || unicode.IsSpace(r) || unicode.IsControl(r) || r == utf8.RuneError {
+			return fmt.Errorf("%w: invalid character in key: %q", ErrInvalidField, key)
+		}
+	}
+	return nil
 }
 
 // DumpBytes serializes an event data as an array of bytes.
@@ -138,28 +223,29 @@ func (ev *Event) DumpBytes() (eventData []byte, err error) {
 	return
 }
 
-// parsePreamble parses the Event preamble to extract the total
-// number of bytes, the size of the header and content of the
-// Event.
-func parsePreamble(event *bufio.Reader) (preamble, total, header, content int64, err error) {
-	lnbytes, err := event.ReadBytes('\n')
-	if err != nil {
-		return 0, 0, 0, 0, err
+// parsePreamble parses the Event preamble line to extract the
+// total number of bytes, the size of the header and content of
+// the Event. The sizes must add up to the total.
+func parsePreamble(line []byte) (total, header, content int64, err error) {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte("event:")) {
+		return 0, 0, 0, fmt.Errorf("%w: missing 'event:' prefix", ErrInvalidPreamble)
 	}
-	preamble = int64(len(lnbytes))
-	line := string(lnbytes)
-	if !strings.HasPrefix(line, "event:") {
-		return 0, 0, 0, 0, fmt.Errorf("invalid preamble")
+	fields := bytes.Fields(line[len("event:"):])
+	if len(fields) != 3 {
+		return 0, 0, 0, fmt.Errorf("%w: expected 3 sizes, but got %d", ErrInvalidPreamble, len(fields))
 	}
-	parts := strings.Split(strings.TrimSpace(strings.TrimSpace(line)[6:]), " ")
-	total, err = strconv.ParseInt(parts[0], 10, 64)
-	if err == nil {
-		header, err = strconv.ParseInt(parts[1], 10, 64)
+	sizes := make([]int64, 3)
+	for i, field := range fields {
+		if sizes[i], err = strconv.ParseInt(string(field), 10, 64); err != nil || sizes[i] < 0 {
+			return 0, 0, 0, fmt.Errorf("%w: invalid size %q", ErrInvalidPreamble, field)
+		}
 	}
-	if err == nil {
-		content, err = strconv.ParseInt(parts[2], 10, 64)
+	total, header, content = sizes[0], sizes[1], sizes[2]
+	if header+content != total {
+		return 0, 0, 0, fmt.Errorf("%w: header size %d and content size %d do not add up to %d", ErrSizeMismatch, header, content, total)
 	}
-	return
+	return total, header, content, nil
 }
 
 // NewEventID generates new Event ID. The value is a random UUID (v4).
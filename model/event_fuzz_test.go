@@ -0,0 +1,88 @@
+//go:build go1.18
+// +build go1.18
+
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// FuzzLoad tests that loading arbitrary data never panics, and that every
+// event that loads successfully survives a Dump/Load round trip.
+func FuzzLoad(f *testing.F) {
+	f.Add([]byte(strings.Join([]string{
+		"event: 155 133 22",
+		"id:331c531d-6eb4-4fb5-84d3-ea6937b01fdd",
+		"timestamp: 1509989630.6749051",
+		"source:/dev/sensors/door1-sensor",
+		"tags:sensors,home,doors,door1",
+		"Door has been unlocked",
+	}, "\n")))
+	f.Add([]byte("event:24 24 0\nid:1\ntimestamp:1.000000\n"))
+	f.Add([]byte("event:10 5 4\nid:1\nabcd"))
+	f.Add([]byte("event:13 9 4\nid:1\nxyz\nabcd"))
+	f.Add([]byte("event:"))
+	f.Add([]byte("event:26 21 5\nid:1\nhost:a\\nb\nuser:\ncontent"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ev := &Event{}
+		if err := ev.LoadBytes(data); err != nil {
+			return
+		}
+		dumped, err := ev.DumpBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded := &Event{}
+		if err = loaded.LoadBytes(dumped); err != nil {
+			t.Fatalf("cannot load dumped event %q: %s", dumped, err.Error())
+		}
+		assertSameEvent(t, ev, loaded)
+
+		// the streaming decoder must agree with LoadBytes
+		decoded := &Event{}
+		if err = NewDecoder(bytes.NewReader(dumped)).Decode(decoded); err != nil {
+			t.Fatalf("cannot decode dumped event %q: %s", dumped, err.Error())
+		}
+		assertSameEvent(t, ev, decoded)
+	})
+}
+
+// FuzzDumpLoad tests that dumped events are loaded back unchanged.
+func FuzzDumpLoad(f *testing.F) {
+	f.Add("331c531d-6eb4-4fb5-84d3-ea6937b01fdd", 1509989630.6749051, "/dev/sensors/door1-sensor", "sensors,home", "Door has been unlocked")
+	f.Add("", 0.0, "http://host:8080", "", "")
+	f.Add("id", -1.5, "", "a", "multi\nline\ncontent\n")
+	f.Add(" id\n", 1.0, "C:\\new\\x41", "a\\,b, c ", "")
+
+	f.Fuzz(func(t *testing.T, id string, timestamp float64, source, tags, content string) {
+		ev := &Event{ID: id, Timestamp: timestamp, Source: source, Content: content}
+		if tags != "" {
+			ev.Tags = strings.Split(tags, ",")
+		}
+		data, err := ev.Dump()
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded := &Event{}
+		if err = loaded.Load(data); err != nil {
+			t.Fatalf("cannot load dumped event %q: %s", data, err.Error())
+		}
+		assertSameEvent(t, ev, loaded)
+	})
+}
+
+// assertSameEvent compares the events as they would be serialized.
+func assertSameEvent(t *testing.T, expected, actual *Event) {
+	if expected.ID != actual.ID ||
+		expected.Source != actual.Source ||
+		expected.Content != actual.Content ||
+		strings.Join(expected.Tags, ",") != strings.Join(actual.Tags, ",") ||
+		fmt.Sprint(expected.Fields) != fmt.Sprint(actual.Fields) ||
+		fmt.Sprintf("%f", expected.Timestamp) != fmt.Sprintf("%f", actual.Timestamp) {
+		t.Fatalf("events differ:\nexpected: %+v\nactual:   %+v", expected, actual)
+	}
+}
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -145,3 +147,113 @@ func TestDumpBytes(t *testing.T) {
 		t.Fatalf("Event not dumped properly.\nExpected:\n>\n%s\n>\nBut instead got:\n<\n%s\n<\n", expected, string(data))
 	}
 }
+
+// TestLoad_colonInValue tests that the header values may contain colons.
+func TestLoad_colonInValue(t *testing.T) {
+	ev := &Event{ID: "id:1", Source: "http://localhost:8080/path", Content: "a: b"}
+	data, err := ev.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := &Event{}
+	if err = loaded.Load(data); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ID != ev.ID || loaded.Source != ev.Source || loaded.Content != ev.Content {
+		t.Fatalf("Event not loaded properly: %+v", loaded)
+	}
+}
+
+// TestLoad_emptyContent tests loading of an event without content.
+func TestLoad_emptyContent(t *testing.T) {
+	ev := &Event{}
+	if err := ev.Load("event:24 24 0\nid:1\ntimestamp:1.000000\n"); err != nil {
+		t.Fatal(err)
+	}
+	if ev.ID != "1" || ev.Content != "" {
+		t.Fatalf("Event not loaded properly: %+v", ev)
+	}
+}
+
+// TestLoad_invalid tests that malformed events are rejected with the
+// appropriate error.
+func TestLoad_invalid(t *testing.T) {
+	cases := map[string]struct {
+		data     string
+		expected error
+	}{
+		"no preamble":       {"id:1\ntimestamp:1\n", ErrInvalidPreamble},
+		"no new line":       {"event:0 0 0", ErrInvalidPreamble},
+		"missing sizes":     {"event:10 10\nid:1\nabcd", ErrInvalidPreamble},
+		"bad size":          {"event:10 x 4\nid:1\nabcd", ErrInvalidPreamble},
+		"negative size":     {"event:10 -1 11\nid:1\nabcd", ErrInvalidPreamble},
+		"sizes do not add":  {"event:10 5 4\nid:1\nabcd", ErrSizeMismatch},
+		"truncated":         {"event:20 5 15\nid:1\nabcd", ErrSizeMismatch},
+		"trailing data":     {"event:9 5 4\nid:1\nabcdef", ErrSizeMismatch},
+		"missing colon":     {"event:13 9 4\nid:1\nxyz\nabcd", ErrInvalidHeader},
+		"bad timestamp":     {"event:20 16 4\ntimestamp:never\nabcd", ErrInvalidHeader},
+		"header split line": {"event:9 4 5\nid:1\nabcd", ErrInvalidHeader},
+	}
+	for name, c := range cases {
+		err := (&Event{}).Load(c.data)
+		if err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+		if !errors.Is(err, c.expected) {
+			t.Fatalf("%s: expected %v, but got: %s", name, c.expected, err.Error())
+		}
+	}
+}
+
+// TestDumpLoad_fields tests that the fields are dumped in the header and loaded
+// back.
+func TestDumpLoad_fields(t *testing.T) {
+	ev := &Event{
+		ID:      "1",
+		Fields:  map[string]string{"user": "jdoe", "host": "web\n01", "empty": ""},
+		Content: "content",
+	}
+	data, err := ev.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(data, "source:\nempty:\nhost:\\~web\\n01\nuser:jdoe\ncontent") {
+		t.Fatalf("Fields not dumped properly:\n%s", data)
+	}
+	loaded := &Event{}
+	if err = loaded.Load(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Fields) != 3 {
+		t.Fatalf("Fields not loaded properly: %v", loaded.Fields)
+	}
+	for key, value := range ev.Fields {
+		if loaded.Fields[key] != value {
+			t.Fatalf("Field %s not loaded properly: %q", key, loaded.Fields[key])
+		}
+	}
+}
+
+// TestDump_invalidField tests that fields which cannot be written in the
+// header are rejected.
+func TestDump_invalidField(t *testing.T) {
+	for _, key := range []string{"", "id", "tags", "a:b", "a b", "a\nb"} {
+		ev := &Event{ID: "1", Fields: map[string]string{key: "value"}}
+		if _, err := ev.Dump(); !errors.Is(err, ErrInvalidField) {
+			t.Fatalf("Expected invalid field error for key %q, but got %v", key, err)
+		}
+	}
+}
+
+// TestLoad_invalidFieldKey tests that header lines with keys that cannot be
+// used as field keys are skipped, and the event is still loaded.
+func TestLoad_invalidFieldKey(t *testing.T) {
+	header := "id:1\nodd key:x\n:y\nuser:jdoe\n"
+	ev := &Event{}
+	if err := ev.Load(fmt.Sprintf("event:%d %d 0\n%s", len(header), len(header), header)); err != nil {
+		t.Fatal(err)
+	}
+	if ev.ID != "1" || len(ev.Fields) != 1 || ev.Fields["user"] != "jdoe" {
+		t.Fatalf("Event not loaded properly: %+v", ev)
+	}
+}
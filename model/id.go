@@ -0,0 +1,121 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// IDGenerator generates IDs for new events.
+type IDGenerator interface {
+	// NewID generates an ID for the event. The event should have all other
+	// properties set. The offset is the position of the event content in its
+	// source (for example, in the watched file), or negative if not known.
+	NewID(ev *Event, offset int64) string
+}
+
+// ID generation strategies, as accepted by NewIDGenerator.
+const (
+	// IDRandom generates random UUIDs (v4). This is the default.
+	IDRandom = "random"
+
+	// IDTimeOrdered generates time-ordered UUIDs (v7). The IDs sort in the
+	// order in which they were generated.
+	IDTimeOrdered = "time"
+
+	// IDHash generates deterministic UUIDs (v5) derived from the event
+	// source, the offset and the content. The same event read twice from the
+	// same position in the source gets the same ID, so the duplicates can be
+	// detected.
+	IDHash = "hash"
+)
+
+// NewIDGenerator creates a new IDGenerator for the given strategy: IDRandom,
+// IDTimeOrdered or IDHash. An empty strategy means IDRandom.
+func NewIDGenerator(strategy string) (IDGenerator, error) {
+	switch strategy {
+	case IDRandom, "":
+		return RandomIDGenerator{}, nil
+	case IDTimeOrdered:
+		return &TimeOrderedIDGenerator{}, nil
+	case IDHash:
+		return HashIDGenerator{}, nil
+	}
+	return nil, fmt.Errorf("unknown ID strategy: %s", strategy)
+}
+
+// RandomIDGenerator generates random UUIDs (v4), the same as NewEventID.
+type RandomIDGenerator struct{}
+
+// NewID generates a random UUID.
+func (RandomIDGenerator) NewID(ev *Event, offset int64) string {
+	return NewEventID()
+}
+
+// TimeOrderedIDGenerator generates time-ordered UUIDs (version 7, as defined
+// in RFC 9562). The first 48 bits hold the milliseconds since the Unix epoch,
+// followed by a counter that keeps the IDs generated within the same
+// millisecond in order, and random bits.
+// The generator is safe for concurrent use.
+type TimeOrderedIDGenerator struct {
+	mux      sync.Mutex
+	lastTime int64
+	counter  uint16
+}
+
+// NewID generates a new time-ordered UUID. The ID is based on the current
+// time, not on the event timestamp, so the IDs are always increasing.
+func (g *TimeOrderedIDGenerator) NewID(ev *Event, offset int64) string {
+	var id uuid.UUID
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic(err)
+	}
+
+	g.mux.Lock()
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	if now <= g.lastTime {
+		// same millisecond (or the clock went back) - keep the order
+		now = g.lastTime
+		g.counter++
+		if g.counter > 0x0fff {
+			// counter overflow, borrow the next millisecond
+			now++
+			g.counter = 0
+		}
+	} else {
+		g.counter = binary.BigEndian.Uint16(id[6:8]) & 0x01ff
+	}
+	g.lastTime = now
+	counter := g.counter
+	g.mux.Unlock()
+
+	for i := 0; i < 6; i++ {
+		id[i] = byte(now >> uint(8*(5-i)))
+	}
+	binary.BigEndian.PutUint16(id[6:8], 0x7000|counter)
+	id.SetVariant(uuid.VariantRFC4122)
+	return id.String()
+}
+
+// hashIDNamespace is the namespace of the deterministic event IDs.
+var hashIDNamespace = uuid.NewV5(uuid.NamespaceURL, "https://github.com/theia-log/selene/event")
+
+// HashIDGenerator generates deterministic UUIDs (v5), derived from the event
+// source, the offset of the event in the source and the event content.
+// If the offset is not known, the event timestamp is used instead.
+type HashIDGenerator struct{}
+
+// NewID generates the deterministic ID for the event.
+func (HashIDGenerator) NewID(ev *Event, offset int64) string {
+	position := "@" + strconv.FormatInt(offset, 10)
+	if offset < 0 {
+		position = "t" + strconv.FormatFloat(ev.Timestamp, 'f', -1, 64)
+	}
+	name := ev.Source + "\x00" + position + "\x00" + ev.Content
+	return uuid.NewV5(hashIDNamespace, name).String()
+}
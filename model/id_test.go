@@ -0,0 +1,95 @@
+package model
+
+import (
+	"sort"
+	"sync"
+	"testing"
+)
+
+// TestNewIDGenerator tests creating the ID generators by strategy name.
+func TestNewIDGenerator(t *testing.T) {
+	for _, strategy := range []string{"", IDRandom, IDTimeOrdered, IDHash} {
+		if _, err := NewIDGenerator(strategy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := NewIDGenerator("sequential"); err == nil {
+		t.Fatal("Expected error for unknown strategy.")
+	}
+}
+
+// TestTimeOrderedIDGenerator tests that the time-ordered IDs are unique, valid
+// UUIDs v7 and sort in the order in which they were generated.
+func TestTimeOrderedIDGenerator(t *testing.T) {
+	generator := &TimeOrderedIDGenerator{}
+	ids := make([]string, 10000)
+	for i := range ids {
+		ids[i] = generator.NewID(&Event{}, -1)
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Fatal("Time-ordered IDs are not sorted.")
+	}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			t.Fatalf("Duplicate ID: %s", id)
+		}
+		seen[id] = true
+		if len(id) != 36 || id[14] != '7' || (id[19] != '8' && id[19] != '9' && id[19] != 'a' && id[19] != 'b') {
+			t.Fatalf("Not a valid UUID v7: %s", id)
+		}
+	}
+}
+
+// TestTimeOrderedIDGenerator_concurrent tests that the generator produces
+// unique IDs when used concurrently.
+func TestTimeOrderedIDGenerator_concurrent(t *testing.T) {
+	generator := &TimeOrderedIDGenerator{}
+	var mux sync.Mutex
+	var wg sync.WaitGroup
+	seen := map[string]bool{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				id := generator.NewID(&Event{}, -1)
+				mux.Lock()
+				seen[id] = true
+				mux.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 8000 {
+		t.Fatalf("Expected 8000 unique IDs, but got %d", len(seen))
+	}
+}
+
+// TestHashIDGenerator tests that the hash IDs are deterministic.
+func TestHashIDGenerator(t *testing.T) {
+	generator := HashIDGenerator{}
+	ev := &Event{Source: "/var/log/app.log", Timestamp: 1509989630.5, Content: "line\n"}
+	id := generator.NewID(ev, 100)
+	if id != generator.NewID(&Event{Source: ev.Source, Content: ev.Content}, 100) {
+		t.Fatal("Expected the same ID for the same source, offset and content.")
+	}
+	if id[14] != '5' {
+		t.Fatalf("Not a valid UUID v5: %s", id)
+	}
+
+	different := []string{
+		generator.NewID(ev, 101),
+		generator.NewID(&Event{Source: "/var/log/other.log", Content: ev.Content}, 100),
+		generator.NewID(&Event{Source: ev.Source, Content: "other\n"}, 100),
+		generator.NewID(ev, -1),
+	}
+	for _, other := range different {
+		if other == id {
+			t.Fatal("Expected different IDs for different events.")
+		}
+	}
+	if generator.NewID(ev, -1) != generator.NewID(ev, -1) {
+		t.Fatal("Expected the same ID for the same event without offset.")
+	}
+}
@@ -0,0 +1,23 @@
+// Package server implements a standalone Theia compatible server.
+//
+// The Server speaks the same websocket protocol as Theia: events published on
+// /event are appended to a Store, /find looks up the stored events that match
+// the filter, and /live pushes the matching events as they arrive. It is meant
+// for local development and CI, where running the Theia server is not
+// practical:
+//
+//	store, err := server.OpenFileStore("events.theia")
+//	if err != nil {
+//		return err
+//	}
+//	defer store.Close()
+//
+//	srv := server.New(store)
+//	defer srv.Close()
+//
+//	err = srv.ListenAndServe("localhost:6433")
+//
+// The clients in the comm package work against the Server the same way they
+// work against Theia. The endpoints accept plain HTTP POST requests as well,
+// for comm.HTTPClient.
+package server
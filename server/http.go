@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+)
+
+// maxFilterSize is the maximal size of a filter posted over HTTP.
+const maxFilterSize = 1024 * 1024
+
+// streamKeepalive is the interval of the comments sent on an idle /live
+// event stream, so that the proxies do not close the connection.
+const streamKeepalive = 15 * time.Second
+
+// endpoint serves the websocket requests with the websocket handler, and the
+// plain HTTP POST requests with the HTTP handler.
+func (s *Server) endpoint(ws func(conn *websocket.Conn), post http.HandlerFunc) http.HandlerFunc {
+	upgraded := s.upgraded(ws)
+	return func(resp http.ResponseWriter, req *http.Request) {
+		if websocket.IsWebSocketUpgrade(req) {
+			upgraded(resp, req)
+			return
+		}
+		if req.Method != http.MethodPost {
+			resp.Header().Set("Allow", http.MethodPost)
+			httpError(resp, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		post(resp, req)
+	}
+}
+
+// postEvent stores the events posted on /event. The body holds one or more
+// events, in comm.EventsContentType. The whole body is decoded first, so if
+// any event is invalid, none of the events is stored.
+func (s *Server) postEvent(resp http.ResponseWriter, req *http.Request) {
+	events := []*model.Event{}
+	decoder := model.NewDecoder(req.Body)
+	for {
+		ev := &model.Event{}
+		err := decoder.Decode(ev)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Invalid event: %s\n", err.Error())
+			httpError(resp, http.StatusBadRequest, err.Error())
+			return
+		}
+		events = append(events, ev)
+	}
+	for _, ev := range events {
+		if err := s.Add(ev); err != nil {
+			log.Printf("Failed to store event %s: %s\n", ev.ID, err.Error())
+			httpError(resp, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// postFilter reads and validates the filter posted with the request. If the
+// filter is not valid, an error response is sent.
+func postFilter(resp http.ResponseWriter, req *http.Request) (*comm.EventFilter, bool) {
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, maxFilterSize))
+	if err != nil {
+		return nil, false
+	}
+	filter := &comm.EventFilter{}
+	if err = json.Unmarshal(data, filter); err != nil {
+		httpError(resp, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if err = filter.Validate(); err != nil {
+		httpError(resp, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return filter, true
+}
+
+// postFind streams back the stored events that match the posted filter, in
+// comm.EventsContentType.
+func (s *Server) postFind(resp http.ResponseWriter, req *http.Request) {
+	filter, ok := postFilter(resp, req)
+	if !ok {
+		return
+	}
+	events, err := s.find(filter)
+	if err != nil {
+		log.Printf("Failed to read events: %s\n", err.Error())
+		httpError(resp, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resp.Header().Set("Content-Type", comm.EventsContentType)
+	encoder := model.NewEncoder(resp).MaxSize(0)
+	for _, ev := range events {
+		if err = encoder.Encode(ev); err != nil {
+			return
+		}
+	}
+}
+
+// postLive streams the events that match the posted filter as server-sent
+// events, as they arrive, until the client goes away.
+func (s *Server) postLive(resp http.ResponseWriter, req *http.Request) {
+	filter, ok := postFilter(resp, req)
+	if !ok {
+		return
+	}
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		httpError(resp, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	// subscribed before the response starts, so the client receives all
+	// events published after its request is accepted
+	sub := s.subscribe(filter)
+	defer s.unsubscribe(sub)
+	resp.Header().Set("Content-Type", comm.EventStreamContentType)
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+	for {
+		var err error
+		select {
+		case ev := <-sub.events:
+			err = comm.WriteEventStream(resp, ev)
+		case <-keepalive.C:
+			_, err = io.WriteString(resp, ": keepalive\n\n")
+		case <-sub.done:
+			// too slow, disconnected
+			return
+		case <-req.Context().Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// httpError sends an error response with the error JSON, the same as the
+// error messages sent over websockets.
+func httpError(resp http.ResponseWriter, status int, message string) {
+	data, err := json.Marshal(map[string]string{"error": message})
+	if err != nil {
+		http.Error(resp, message, status)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(status)
+	resp.Write(data)
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+)
+
+// httpURL returns the HTTP URL of the server started with startServer.
+func httpURL(url string) string {
+	return "http" + strings.TrimPrefix(url, "ws")
+}
+
+func TestServer_httpSendAndFind(t *testing.T) {
+	store := NewMemoryStore()
+	srv, url := startServer(t, store)
+	defer srv.Close()
+
+	client := comm.NewHTTPClient(httpURL(url))
+	defer client.Close()
+	events := storeEvents()
+	if err := client.Send(events[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SendBatch(events[1:]); err != nil {
+		t.Fatal(err)
+	}
+	// the events are stored once the request completes
+	if ids := scanIDs(t, store); len(ids) != 3 {
+		t.Fatalf("Expected 3 events stored, but got %v", ids)
+	}
+
+	resp, err := client.Find(comm.Filter(0).OrderDesc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, errs := readIDs(t, resp)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if ids != "312" {
+		t.Fatalf("Expected events 312, but got %s", ids)
+	}
+
+	if _, err = client.Find(comm.Filter(0).MatchTag("(")); err == nil {
+		t.Fatal("Expected error for invalid filter.")
+	} else if _, ok := err.(*comm.ServerError); !ok {
+		t.Fatalf("Expected ServerError, but got %v", err)
+	}
+}
+
+func TestServer_httpInvalidEvent(t *testing.T) {
+	store := NewMemoryStore()
+	srv, url := startServer(t, store)
+	defer srv.Close()
+
+	// a valid event followed by an invalid one
+	valid, err := storeEvents()[0].Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(httpURL(url)+"/event", comm.EventsContentType, strings.NewReader(valid+"\nnot an event"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected bad request, but got %s", resp.Status)
+	}
+	if ids := scanIDs(t, store); len(ids) != 0 {
+		t.Fatalf("Expected no events stored, but got %v", ids)
+	}
+
+	resp, err = http.Get(httpURL(url) + "/find")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected method not allowed, but got %s", resp.Status)
+	}
+}
+
+func TestServer_httpLive(t *testing.T) {
+	srv, url := startServer(t, NewMemoryStore())
+	defer srv.Close()
+
+	client := comm.NewHTTPClient(httpURL(url))
+	resp, err := client.Receive(comm.Filter(0).MatchTag("db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the stream is open once Receive returns
+	for _, ev := range storeEvents() {
+		if err = srv.Add(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = srv.Add(&model.Event{ID: "4", Tags: []string{"db"}, Content: "multi\nline\n"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"2", "4"} {
+		select {
+		case event := <-resp:
+			if event.Error != nil || event.Event.ID != expected {
+				t.Fatalf("Expected event %s, but got %v", expected, event)
+			}
+			if expected == "4" && event.Event.Content != "multi\nline\n" {
+				t.Fatalf("Content not preserved: %q", event.Event.Content)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout while waiting for live events.")
+		}
+	}
+
+	client.Close()
+	_, errs := readIDs(t, resp)
+	if len(errs) != 1 {
+		t.Fatalf("Expected the stream to be closed, but got %v", errs)
+	}
+	if _, ok := errs[0].(*comm.ClosedError); !ok {
+		t.Fatalf("Expected ClosedError, but got %v", errs[0])
+	}
+}
@@ -0,0 +1,384 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+)
+
+// liveBuffer is the number of events buffered for a /live subscriber. When
+// the buffer is full, the subscriber is too slow and is disconnected, so that
+// storing new events never waits for a subscriber.
+const liveBuffer = 256
+
+// writeTimeout limits the time to send a message to a client.
+const writeTimeout = 10 * time.Second
+
+// Server is a Theia compatible websocket server. The received events are kept
+// in a Store.
+// The same endpoints accept plain HTTP POST requests as well, as expected by
+// comm.HTTPClient.
+type Server struct {
+	store       Store
+	upgrader    websocket.Upgrader
+	handler     *http.ServeMux
+	server      *http.Server
+	mux         sync.Mutex
+	subscribers map[*subscriber]bool
+	conns       map[*websocket.Conn]bool
+	interceptor Interceptor
+}
+
+// Interceptor is called for every message received on a websocket endpoint
+// ("event", "find" or "live"), before the message is handled. If it returns
+// false, the message is not handled any further: the event is skipped, or the
+// /find and /live connection is closed. It is used to inject faults in tests.
+type Interceptor func(endpoint string, conn *websocket.Conn) bool
+
+// subscriber is a client connected to /live.
+type subscriber struct {
+	filter *comm.EventFilter
+	events chan *model.Event
+	done   chan struct{}
+}
+
+// New creates a new Server that stores the events in the given store.
+// The store is not closed when the server is closed.
+func New(store Store) *Server {
+	s := &Server{
+		store: store,
+		upgrader: websocket.Upgrader{
+			EnableCompression: true,
+		},
+		handler:     http.NewServeMux(),
+		subscribers: map[*subscriber]bool{},
+		conns:       map[*websocket.Conn]bool{},
+	}
+	s.handler.HandleFunc("/event", s.endpoint(s.handleEvent, s.postEvent))
+	s.handler.HandleFunc("/find", s.endpoint(s.handleFind, s.postFind))
+	s.handler.HandleFunc("/live", s.endpoint(s.handleLive, s.postLive))
+	s.server = &http.Server{Handler: s.handler}
+	return s
+}
+
+// Intercept sets the interceptor of the messages received on the websocket
+// endpoints.
+func (s *Server) Intercept(interceptor Interceptor) *Server {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.interceptor = interceptor
+	return s
+}
+
+// intercept calls the interceptor, if set, for a message received on the
+// endpoint.
+func (s *Server) intercept(endpoint string, conn *websocket.Conn) bool {
+	s.mux.Lock()
+	interceptor := s.interceptor
+	s.mux.Unlock()
+	return interceptor == nil || interceptor(endpoint, conn)
+}
+
+// Subscribers returns the number of clients subscribed to /live.
+func (s *Server) Subscribers() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return len(s.subscribers)
+}
+
+// ServeHTTP handles the websocket and HTTP requests on /event, /find and /live.
+func (s *Server) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	s.handler.ServeHTTP(resp, req)
+}
+
+// ListenAndServe listens on the TCP address (for example localhost:6433) and
+// serves the websocket requests. It blocks until the server is closed.
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts the connections on the listener and serves the websocket
+// requests. It blocks until the server is closed. Returns nil if the server
+// was closed with Close.
+func (s *Server) Serve(listener net.Listener) error {
+	if err := s.server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Close stops the server and breaks all open connections.
+func (s *Server) Close() error {
+	err := s.server.Close()
+	s.mux.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mux.Unlock()
+	return err
+}
+
+// Add stores the event and publishes it to the matching /live subscribers.
+// The subscribers that cannot keep up are disconnected.
+func (s *Server) Add(ev *model.Event) error {
+	if err := s.store.Append(ev); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	subscribers := make([]*subscriber, 0, len(s.subscribers))
+	for sub := range s.subscribers {
+		subscribers = append(subscribers, sub)
+	}
+	s.mux.Unlock()
+
+	for _, sub := range subscribers {
+		if !sub.filter.Matches(ev) {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			log.Printf("Live subscriber too slow, disconnecting.\n")
+			s.unsubscribe(sub)
+		}
+	}
+	return nil
+}
+
+// Find looks up the stored events that match the filter, sorted by the event
+// timestamp in the order requested by the filter (ascending by default).
+func (s *Server) Find(filter *comm.EventFilter) ([]*model.Event, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return s.find(filter)
+}
+
+func (s *Server) find(filter *comm.EventFilter) ([]*model.Event, error) {
+	result := []*model.Event{}
+	collect := func(ev *model.Event) error {
+		if filter.Matches(ev) {
+			result = append(result, ev)
+		}
+		return nil
+	}
+	desc := filter.Order != nil && *filter.Order == comm.OrderDesc
+
+	if rangeStore, ok := s.store.(RangeStore); ok {
+		// the events come already sorted
+		rangeOrder := comm.OrderAsc
+		if desc {
+			rangeOrder = comm.OrderDesc
+		}
+		if err := rangeStore.Range(filter.Start, filter.End, rangeOrder, collect); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	if err := s.store.Scan(collect); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if desc {
+			return result[i].Timestamp > result[j].Timestamp
+		}
+		return result[i].Timestamp < result[j].Timestamp
+	})
+	return result, nil
+}
+
+// upgraded upgrades the HTTP request to a websocket connection and calls the
+// handler. The connection is closed once the handler returns.
+func (s *Server) upgraded(handler func(conn *websocket.Conn)) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		conn, err := s.upgrader.Upgrade(resp, req, nil)
+		if err != nil {
+			return
+		}
+		s.mux.Lock()
+		s.conns[conn] = true
+		s.mux.Unlock()
+		defer func() {
+			s.mux.Lock()
+			delete(s.conns, conn)
+			s.mux.Unlock()
+			conn.Close()
+		}()
+		handler(conn)
+	}
+}
+
+// handleEvent stores the events published on /event. Every stored event is
+// acknowledged with "ok", the same as Theia does. Invalid events are reported
+// with an error message.
+func (s *Server) handleEvent(conn *websocket.Conn) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if !s.intercept("event", conn) {
+			continue
+		}
+		ev := &model.Event{}
+		if err = ev.LoadBytes(data); err != nil {
+			log.Printf("Invalid event: %s\n", err.Error())
+			writeError(conn, err.Error())
+			continue
+		}
+		if err = s.Add(ev); err != nil {
+			log.Printf("Failed to store event %s: %s\n", ev.ID, err.Error())
+			writeError(conn, err.Error())
+			continue
+		}
+		if err = conn.WriteMessage(websocket.TextMessage, []byte("ok")); err != nil {
+			return
+		}
+	}
+}
+
+// readFilter reads the filter request and validates it. If the filter is not
+// valid, an error is sent to the client and the connection is closed.
+func (s *Server) readFilter(endpoint string, conn *websocket.Conn) (*comm.EventFilter, bool) {
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, false
+	}
+	if !s.intercept(endpoint, conn) {
+		closeNormal(conn)
+		return nil, false
+	}
+	filter := &comm.EventFilter{}
+	if err = json.Unmarshal(data, filter); err != nil {
+		writeError(conn, err.Error())
+		closeNormal(conn)
+		return nil, false
+	}
+	if err = filter.Validate(); err != nil {
+		writeError(conn, err.Error())
+		closeNormal(conn)
+		return nil, false
+	}
+	if err = conn.WriteMessage(websocket.TextMessage, []byte("ok")); err != nil {
+		return nil, false
+	}
+	return filter, true
+}
+
+// handleFind looks up the stored events that match the filter, sends them
+// and closes the connection.
+func (s *Server) handleFind(conn *websocket.Conn) {
+	filter, ok := s.readFilter("find", conn)
+	if !ok {
+		return
+	}
+	events, err := s.find(filter)
+	if err != nil {
+		log.Printf("Failed to read events: %s\n", err.Error())
+		writeError(conn, err.Error())
+		closeNormal(conn)
+		return
+	}
+	for _, ev := range events {
+		if err = writeEvent(conn, ev); err != nil {
+			return
+		}
+	}
+	closeNormal(conn)
+}
+
+// handleLive pushes the events that match the filter as they arrive, until
+// the client closes the connection.
+func (s *Server) handleLive(conn *websocket.Conn) {
+	filter, ok := s.readFilter("live", conn)
+	if !ok {
+		return
+	}
+	sub := s.subscribe(filter)
+
+	go func() {
+		// the client does not send anything else, so this returns once the
+		// connection is closed
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				break
+			}
+		}
+		s.unsubscribe(sub)
+	}()
+
+	for {
+		select {
+		case ev := <-sub.events:
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := writeEvent(conn, ev); err != nil {
+				return
+			}
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+// subscribe registers a subscriber for the events that match the filter.
+func (s *Server) subscribe(filter *comm.EventFilter) *subscriber {
+	sub := &subscriber{
+		filter: filter,
+		events: make(chan *model.Event, liveBuffer),
+		done:   make(chan struct{}),
+	}
+	s.mux.Lock()
+	s.subscribers[sub] = true
+	s.mux.Unlock()
+	return sub
+}
+
+// unsubscribe removes the subscriber, so no more events are published to it,
+// and closes its done channel. It can be called more than once.
+func (s *Server) unsubscribe(sub *subscriber) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.subscribers[sub] {
+		delete(s.subscribers, sub)
+		close(sub.done)
+	}
+}
+
+// writeEvent sends the serialized event to the client.
+func writeEvent(conn *websocket.Conn, ev *model.Event) error {
+	data, err := ev.DumpBytes()
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+// writeError sends an error JSON message to the client, the same way Theia
+// reports errors.
+func writeError(conn *websocket.Conn, message string) error {
+	data, err := json.Marshal(map[string]string{"error": message})
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// closeNormal sends the close message to the client.
+func closeNormal(conn *websocket.Conn) error {
+	return conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+	"github.com/theia-log/selene/storage"
+)
+
+// startServer starts the server on a random local port and returns its URL.
+func startServer(t *testing.T, store Store) (*Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(store)
+	go srv.Serve(listener)
+	return srv, "ws://" + listener.Addr().String()
+}
+
+// waitForEvents waits until the store holds n events.
+func waitForEvents(t *testing.T, store Store, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(scanIDs(t, store)) >= n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d events to be stored.", n)
+}
+
+// readIDs reads the events from the channel until it is closed.
+func readIDs(t *testing.T, resp chan *comm.EventResponse) (string, []error) {
+	ids := ""
+	errs := []error{}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-resp:
+			if !ok {
+				return ids, errs
+			}
+			if event.Error != nil {
+				errs = append(errs, event.Error)
+				continue
+			}
+			ids += event.Event.ID
+		case <-timeout:
+			t.Fatal("Timeout while reading events.")
+		}
+	}
+}
+
+func TestServer_sendAndFind(t *testing.T) {
+	store := NewMemoryStore()
+	srv, url := startServer(t, store)
+	defer srv.Close()
+
+	client := comm.NewWebsocketClient(url)
+	for _, ev := range storeEvents() {
+		if err := client.Send(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForEvents(t, store, 3)
+
+	cases := []struct {
+		filter   *comm.EventFilter
+		expected string
+	}{
+		{comm.Filter(0), "213"},
+		{comm.Filter(0).OrderDesc(), "312"},
+		{comm.Filter(6).MatchEnd(20), "13"},
+		{comm.Filter(0).MatchTag("^d"), "2"},
+		{comm.Filter(0).MatchContent("line$"), "2"},
+	}
+	for _, c := range cases {
+		resp, err := comm.NewWebsocketClient(url).Find(c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, errs := readIDs(t, resp)
+		if ids != c.expected {
+			t.Fatalf("Expected events %q, but got %q", c.expected, ids)
+		}
+		for _, err := range errs {
+			if _, ok := err.(*comm.ClosedError); !ok {
+				t.Fatalf("Unexpected error: %s", err.Error())
+			}
+		}
+	}
+
+	resp, err := comm.NewWebsocketClient(url).Find(comm.Filter(0).MatchContent("("))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errs := readIDs(t, resp)
+	if _, ok := errs[0].(*comm.ServerError); !ok {
+		t.Fatalf("Expected server error for invalid filter, but got %v", errs)
+	}
+}
+
+func TestServer_live(t *testing.T) {
+	srv, url := startServer(t, NewMemoryStore())
+	defer srv.Close()
+
+	client := comm.NewWebsocketClient(url)
+	defer client.Close()
+	resp, err := client.Receive(comm.Filter(0).MatchTag("db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// wait for the subscription
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		srv.mux.Lock()
+		subscribed := len(srv.subscribers) > 0
+		srv.mux.Unlock()
+		if subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Client did not subscribe.")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for _, ev := range storeEvents() {
+		if err = srv.Add(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case event := <-resp:
+		if event.Error != nil || event.Event.ID != "2" {
+			t.Fatalf("Expected event 2, but got %v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout while waiting for live events.")
+	}
+}
+
+func TestServer_slowSubscriber(t *testing.T) {
+	srv := New(NewMemoryStore())
+	sub := srv.subscribe(comm.Filter(0))
+
+	// nobody reads the subscriber's events
+	added := make(chan error)
+	go func() {
+		for i := 0; i < liveBuffer+1; i++ {
+			if err := srv.Add(&model.Event{ID: fmt.Sprintf("%d", i), Timestamp: 1}); err != nil {
+				added <- err
+				return
+			}
+		}
+		added <- nil
+	}()
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Storing the events waits for the slow subscriber.")
+	}
+	select {
+	case <-sub.done:
+	default:
+		t.Fatal("Expected the slow subscriber to be disconnected.")
+	}
+	srv.unsubscribe(sub)
+}
+
+func TestServer_fileStore(t *testing.T) {
+	path, cleanup := tempStoreFile(t)
+	defer cleanup()
+
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, url := startServer(t, store)
+	client := comm.NewWebsocketClient(url)
+	for _, ev := range storeEvents() {
+		client.Send(ev)
+	}
+	waitForEvents(t, store, 3)
+	client.Close()
+	srv.Close()
+	store.Close()
+
+	// the events are found after restarting the server
+	if store, err = OpenFileStore(path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	srv, url = startServer(t, store)
+	defer srv.Close()
+
+	events, err := srv.Find(comm.Filter(0).OrderDesc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, ev := range events {
+		ids = append(ids, ev.ID)
+	}
+	if strings.Join(ids, "") != "312" {
+		t.Fatalf("Expected events 312, but got %v", ids)
+	}
+
+	resp, err := comm.NewWebsocketClient(url).Find(comm.Filter(0).MatchTag("api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := readIDs(t, resp); found != "1" {
+		t.Fatalf("Expected event 1, but got %q", found)
+	}
+}
+
+func TestServer_rangeStore(t *testing.T) {
+	path, cleanup := tempStoreFile(t)
+	defer cleanup()
+
+	store, err := storage.Open(filepath.Dir(path), &storage.Options{SegmentSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	srv, url := startServer(t, store)
+	defer srv.Close()
+
+	for _, ev := range storeEvents() {
+		if err = srv.Add(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		filter   *comm.EventFilter
+		expected string
+	}{
+		{comm.Filter(0), "213"},
+		{comm.Filter(0).OrderDesc(), "312"},
+		{comm.Filter(6).MatchEnd(20).MatchTag("api"), "1"},
+	}
+	for _, c := range cases {
+		resp, err := comm.NewWebsocketClient(url).Find(c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids, _ := readIDs(t, resp); ids != c.expected {
+			t.Fatalf("Expected events %q, but got %q", c.expected, ids)
+		}
+	}
+}
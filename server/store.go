@@ -0,0 +1,195 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+)
+
+// Store keeps the events received by the Server.
+// The implementations must be safe for concurrent use.
+type Store interface {
+	// Append stores the event.
+	Append(ev *model.Event) error
+
+	// Scan calls fn for every stored event, in the order in which the events
+	// were appended. If fn returns an error, the scan stops and the error is
+	// returned.
+	Scan(fn func(ev *model.Event) error) error
+
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// RangeStore is a Store that can look up the events in a time range without
+// reading all stored events, like the storage.Store. The Server uses the range
+// lookup for /find when the store supports it.
+type RangeStore interface {
+	Store
+
+	// Range calls fn for every event with timestamp between start and end
+	// (both inclusive, end is nil for an open range), sorted by the timestamp
+	// in the given order.
+	Range(start float64, end *float64, order comm.EventOrder, fn func(ev *model.Event) error) error
+}
+
+// MemoryStore keeps the events in memory. The events are lost once the
+// process exits.
+type MemoryStore struct {
+	mux    sync.RWMutex
+	events []*model.Event
+}
+
+// NewMemoryStore creates a new empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Append stores the event in memory.
+func (m *MemoryStore) Append(ev *model.Event) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.events = append(m.events, ev)
+	return nil
+}
+
+// Scan calls fn for every stored event. The events appended during the scan
+// are not visited.
+func (m *MemoryStore) Scan(fn func(ev *model.Event) error) error {
+	m.mux.RLock()
+	events := m.events
+	m.mux.RUnlock()
+	for _, ev := range events {
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close does nothing, the events are kept in memory.
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// FileStore appends the events to a single file, in the same preamble-framed
+// format in which the events are sent to the server (see model.Encoder).
+// The file is only ever appended to, and every event is written with a single
+// write, so at most the last event is lost if the process crashes.
+type FileStore struct {
+	mux     sync.Mutex
+	path    string
+	file    *os.File
+	encoder *model.Encoder
+	size    int64
+}
+
+// OpenFileStore opens the store file, creating it if it does not exist.
+// If the file ends with an incomplete or corrupted event, for example after
+// a crash, the file is truncated after the last valid event.
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	size, err := validEnd(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err = file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err = file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileStore{
+		path:    path,
+		file:    file,
+		encoder: model.NewEncoder(file).MaxSize(0),
+		size:    size,
+	}, nil
+}
+
+// validEnd reads all events from the file and returns the offset just after
+// the last valid event.
+func validEnd(file *os.File) (int64, error) {
+	decoder := model.NewDecoder(file).MaxSize(0)
+	end := int64(0)
+	for {
+		ev := &model.Event{}
+		err := decoder.Decode(ev)
+		if err == io.EOF {
+			return end, nil
+		}
+		var frameErr *model.FrameError
+		if errors.As(err, &frameErr) && frameErr.Corrupted() {
+			// the rest of the file cannot be read
+			return end, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		end = decoder.Offset()
+	}
+}
+
+// Append writes the event at the end of the store file.
+func (f *FileStore) Append(ev *model.Event) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if err := f.encoder.Encode(ev); err != nil {
+		// drop the partially written event, if any
+		f.file.Truncate(f.size)
+		f.file.Seek(f.size, io.SeekStart)
+		return err
+	}
+	size, err := f.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	f.size = size
+	return nil
+}
+
+// Scan reads the store file and calls fn for every event in it. The events
+// appended during the scan are not visited.
+func (f *FileStore) Scan(fn func(ev *model.Event) error) error {
+	f.mux.Lock()
+	size := f.size
+	f.mux.Unlock()
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := model.NewDecoder(io.LimitReader(file, size)).MaxSize(0)
+	for {
+		ev := &model.Event{}
+		if err = decoder.Decode(ev); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err = fn(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the store file.
+func (f *FileStore) Close() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/theia-log/selene/model"
+)
+
+func storeEvents() []*model.Event {
+	return []*model.Event{
+		{ID: "1", Timestamp: 10, Source: "/api", Tags: []string{"api"}, Content: "first"},
+		{ID: "2", Timestamp: 5, Source: "/db", Tags: []string{"db"}, Content: "second\nline"},
+		{ID: "3", Timestamp: 20, Source: "/db", Content: ""},
+	}
+}
+
+func scanIDs(t *testing.T, store Store) string {
+	ids := ""
+	err := store.Scan(func(ev *model.Event) error {
+		ids += ev.ID
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func tempStoreFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "selene-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "events.dat"), func() { os.RemoveAll(dir) }
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	for _, ev := range storeEvents() {
+		if err := store.Append(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids := scanIDs(t, store); ids != "123" {
+		t.Fatalf("Expected events 123, but got %s", ids)
+	}
+
+	stop := fmt.Errorf("stop")
+	count := 0
+	err := store.Scan(func(ev *model.Event) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Fatalf("Expected the scan to stop after the first event, but got %v after %d events", err, count)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path, cleanup := tempStoreFile(t)
+	defer cleanup()
+
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range storeEvents()[:2] {
+		if err = store.Append(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids := scanIDs(t, store); ids != "12" {
+		t.Fatalf("Expected events 12, but got %s", ids)
+	}
+	if err = store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the events are kept after reopening, and new events are appended
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err = store.Append(storeEvents()[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	found := []*model.Event{}
+	store.Scan(func(ev *model.Event) error {
+		found = append(found, ev)
+		return nil
+	})
+	expected := storeEvents()
+	if len(found) != len(expected) {
+		t.Fatalf("Expected %d events, but got %d", len(expected), len(found))
+	}
+	for i, ev := range found {
+		if ev.ID != expected[i].ID || ev.Timestamp != expected[i].Timestamp || ev.Source != expected[i].Source || ev.Content != expected[i].Content {
+			t.Fatalf("Expected event %v, but got %v", expected[i], ev)
+		}
+	}
+}
+
+func TestFileStore_recovery(t *testing.T) {
+	path, cleanup := tempStoreFile(t)
+	defer cleanup()
+
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range storeEvents()[:2] {
+		store.Append(ev)
+	}
+	store.Close()
+
+	// simulate a crash in the middle of writing an event
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("event:100 50 50\nid:4\ntimest")
+	file.Close()
+
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if ids := scanIDs(t, store); ids != "12" {
+		t.Fatalf("Expected events 12 after recovery, but got %s", ids)
+	}
+	if err = store.Append(storeEvents()[2]); err != nil {
+		t.Fatal(err)
+	}
+	if ids := scanIDs(t, store); ids != "123" {
+		t.Fatalf("Expected events 123, but got %s", ids)
+	}
+}
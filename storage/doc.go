@@ -0,0 +1,32 @@
+// Package storage implements an embedded, append-only event store.
+//
+// The events are appended to segment files in a directory, in the same
+// preamble-framed format in which they are sent to Theia (see model.Encoder).
+// When a segment grows over the configured size, a new segment is started.
+// Every segment has a sparse index: the segment is divided into blocks of
+// roughly equal size, and the index holds the offset and the lowest and the
+// highest event timestamp of every block. The events do not have to be
+// appended in timestamp order; range lookups simply skip the blocks and the
+// segments whose timestamps are outside of the range.
+//
+//	store, err := storage.Open("/var/lib/selene", &storage.Options{
+//		MaxSize: 1 << 30,
+//		MaxAge:  7 * 24 * time.Hour,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer store.Close()
+//
+//	store.Append(ev)
+//
+//	err = store.Range(start, nil, comm.OrderDesc, func(ev *model.Event) error {
+//		fmt.Println(ev.Content)
+//		return nil
+//	})
+//
+// The oldest segments are removed once the store is larger than MaxSize, or
+// once they have not been written to for longer than MaxAge.
+// If the process crashes while writing an event, the incomplete event at the
+// end of the segment is discarded when the store is opened again.
+package storage
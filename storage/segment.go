@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theia-log/selene/model"
+)
+
+// File name extensions of the segment and the index files.
+const (
+	segmentExt = ".seg"
+	indexExt   = ".idx"
+)
+
+// indexMagic starts every index file.
+var indexMagic = []byte("SIDX1\n")
+
+// block is an entry in the sparse segment index. It describes a part of the
+// segment, from its offset up to the offset of the next block.
+type block struct {
+	Offset int64
+	MinTS  float64
+	MaxTS  float64
+}
+
+// overlaps checks if any of the events in the block may be within the time
+// range.
+func (b *block) overlaps(start float64, end *float64) bool {
+	return b.MaxTS >= start && (end == nil || b.MinTS <= *end)
+}
+
+// segment is a single file of the store, holding the events appended one
+// after another.
+type segment struct {
+	id       uint64
+	path     string
+	size     int64
+	blocks   []block
+	modified time.Time
+}
+
+// segmentPath returns the path of the segment file with the given ID.
+// The IDs are zero padded, so the files sort in the order of the IDs.
+func segmentPath(dir string, id uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// parseSegmentID returns the segment ID from the segment file name.
+func parseSegmentID(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, segmentExt) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+	return id, err == nil
+}
+
+func (s *segment) indexPath() string {
+	return strings.TrimSuffix(s.path, segmentExt) + indexExt
+}
+
+// minTS returns the lowest event timestamp in the segment.
+func (s *segment) minTS() float64 {
+	min := math.Inf(1)
+	for _, b := range s.blocks {
+		min = math.Min(min, b.MinTS)
+	}
+	return min
+}
+
+// maxTS returns the highest event timestamp in the segment.
+func (s *segment) maxTS() float64 {
+	max := math.Inf(-1)
+	for _, b := range s.blocks {
+		max = math.Max(max, b.MaxTS)
+	}
+	return max
+}
+
+// blockEnd returns the offset at which the i-th block ends.
+func (s *segment) blockEnd(i int) int64 {
+	if i+1 < len(s.blocks) {
+		return s.blocks[i+1].Offset
+	}
+	return s.size
+}
+
+// add records an event of the given size, written at the offset. A new block
+// is started if the last block is larger than the index interval.
+func (s *segment) add(offset, size int64, timestamp float64, interval int64) {
+	last := len(s.blocks) - 1
+	if last < 0 || offset-s.blocks[last].Offset >= interval {
+		s.blocks = append(s.blocks, block{Offset: offset, MinTS: timestamp, MaxTS: timestamp})
+	} else {
+		s.blocks[last].MinTS = math.Min(s.blocks[last].MinTS, timestamp)
+		s.blocks[last].MaxTS = math.Max(s.blocks[last].MaxTS, timestamp)
+	}
+	s.size = offset + size
+}
+
+// snapshot returns a copy of the segment that is not changed by the
+// following appends.
+func (s *segment) snapshot() *segment {
+	copied := *s
+	copied.blocks = append([]block{}, s.blocks...)
+	return &copied
+}
+
+// loadSegment loads the segment and its index. If the index is missing or
+// out of date, it is rebuilt from the segment file. An incomplete or corrupted
+// event at the end of the segment is removed from the file.
+func loadSegment(dir string, id uint64, interval int64) (*segment, error) {
+	seg := &segment{id: id, path: segmentPath(dir, id)}
+	info, err := os.Stat(seg.path)
+	if err != nil {
+		return nil, err
+	}
+	seg.modified = info.ModTime()
+
+	if blocks, size, err := readIndex(seg.indexPath()); err == nil && size == info.Size() {
+		seg.blocks = blocks
+		seg.size = size
+		return seg, nil
+	}
+
+	if err = seg.rebuild(interval); err != nil {
+		return nil, fmt.Errorf("%s: %w", seg.path, err)
+	}
+	if seg.size < info.Size() {
+		if err = os.Truncate(seg.path, seg.size); err != nil {
+			return nil, err
+		}
+	}
+	return seg, nil
+}
+
+// rebuild reads all events from the segment file and builds the index. The
+// segment size is set just after the last valid event.
+func (s *segment) rebuild(interval int64) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	s.blocks = nil
+	s.size = 0
+	decoder := model.NewDecoder(file).MaxSize(0)
+	for {
+		offset := decoder.Offset()
+		ev := &model.Event{}
+		err = decoder.Decode(ev)
+		if err == io.EOF {
+			s.size = decoder.Offset()
+			return nil
+		}
+		var frameErr *model.FrameError
+		if errors.As(err, &frameErr) && frameErr.Corrupted() {
+			// the rest of the segment cannot be read
+			s.size = frameErr.Offset
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.add(offset, decoder.Offset()-offset, ev.Timestamp, interval)
+	}
+}
+
+// writeIndex writes the segment index file. The index is written to a
+// temporary file first, so a crash never leaves a half written index behind.
+func (s *segment) writeIndex() error {
+	buf := &bytes.Buffer{}
+	buf.Write(indexMagic)
+	binary.Write(buf, binary.BigEndian, s.size)
+	binary.Write(buf, binary.BigEndian, uint32(len(s.blocks)))
+	binary.Write(buf, binary.BigEndian, s.blocks)
+
+	tmpFile := s.indexPath() + ".tmp"
+	if err := writeFile(tmpFile, buf.Bytes()); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, s.indexPath())
+}
+
+func writeFile(path string, data []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readIndex reads the index file. Returns the index blocks and the size of
+// the segment at the time the index was written.
+func readIndex(path string) ([]block, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	magic := make([]byte, len(indexMagic))
+	if _, err = io.ReadFull(reader, magic); err != nil {
+		return nil, 0, err
+	}
+	if !bytes.Equal(magic, indexMagic) {
+		return nil, 0, fmt.Errorf("%s: not an index file", path)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	var size int64
+	var count uint32
+	if err = binary.Read(reader, binary.BigEndian, &size); err != nil {
+		return nil, 0, err
+	}
+	if err = binary.Read(reader, binary.BigEndian, &count); err != nil {
+		return nil, 0, err
+	}
+	if int64(count)*int64(binary.Size(block{})) > info.Size() {
+		return nil, 0, fmt.Errorf("%s: invalid index size", path)
+	}
+	blocks := make([]block, count)
+	if err = binary.Read(reader, binary.BigEndian, blocks); err != nil {
+		return nil, 0, err
+	}
+	if _, err = reader.ReadByte(); err != io.EOF {
+		return nil, 0, fmt.Errorf("%s: unexpected data after the index", path)
+	}
+	return blocks, size, nil
+}
+
+// readRange reads the events from the blocks that overlap the time range and
+// calls fn for the events within the range, in the order in which they were
+// appended.
+func (s *segment) readRange(start float64, end *float64, fn func(ev *model.Event) error) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for i := 0; i < len(s.blocks); i++ {
+		if !s.blocks[i].overlaps(start, end) {
+			continue
+		}
+		// read the consecutive matching blocks at once
+		from := s.blocks[i].Offset
+		for i+1 < len(s.blocks) && s.blocks[i+1].overlaps(start, end) {
+			i++
+		}
+		if _, err = file.Seek(from, io.SeekStart); err != nil {
+			return err
+		}
+		decoder := model.NewDecoder(io.LimitReader(file, s.blockEnd(i)-from)).MaxSize(0)
+		for {
+			ev := &model.Event{}
+			if err = decoder.Decode(ev); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return fmt.Errorf("%s: %w", s.path, err)
+			}
+			if ev.Timestamp >= start && (end == nil || ev.Timestamp <= *end) {
+				if err = fn(ev); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/theia-log/selene/model"
+)
+
+func TestParseSegmentID(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	id, ok := parseSegmentID(filepath.Base(segmentPath(dir, 42)))
+	if !ok || id != 42 {
+		t.Fatalf("Expected segment ID 42, but got %d", id)
+	}
+	for _, name := range []string{"00000000000000000042.idx", "abc.seg", "42"} {
+		if _, ok := parseSegmentID(name); ok {
+			t.Fatalf("Expected %s not to be a segment file.", name)
+		}
+	}
+}
+
+func TestSegment_index(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	store, err := Open(dir, &Options{IndexInterval: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendAll(t, store, testEvents(20))
+	if err = store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expected := store.active()
+
+	blocks, size, err := readIndex(expected.indexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != expected.size || len(blocks) != len(expected.blocks) {
+		t.Fatalf("Expected index of %d blocks for size %d, but got %d blocks for size %d", len(expected.blocks), expected.size, len(blocks), size)
+	}
+	for i, b := range blocks {
+		if b != expected.blocks[i] {
+			t.Fatalf("Expected block %v, but got %v", expected.blocks[i], b)
+		}
+	}
+
+	// the rebuilt index is the same as the written one
+	rebuilt := &segment{path: expected.path}
+	if err = rebuilt.rebuild(100); err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.size != expected.size || len(rebuilt.blocks) != len(expected.blocks) {
+		t.Fatalf("Expected rebuilt index of %d blocks for size %d, but got %d blocks for size %d", len(expected.blocks), expected.size, len(rebuilt.blocks), rebuilt.size)
+	}
+	for i, b := range rebuilt.blocks {
+		// the rebuilt blocks may start at the new line before the event
+		diff := expected.blocks[i].Offset - b.Offset
+		if diff < 0 || diff > 1 || b.MinTS != expected.blocks[i].MinTS || b.MaxTS != expected.blocks[i].MaxTS {
+			t.Fatalf("Expected block %v, but got %v", expected.blocks[i], b)
+		}
+	}
+}
+
+func TestLoadSegment_invalidIndex(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	store, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendAll(t, store, []*model.Event{{ID: "1", Timestamp: 10, Content: "a"}, {ID: "2", Timestamp: 5, Content: "b"}})
+	store.Close()
+	seg := store.active()
+
+	for _, data := range []string{"not an index", string(indexMagic) + "\x00\x00"} {
+		if err = ioutil.WriteFile(seg.indexPath(), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := loadSegment(dir, seg.id, DefaultIndexInterval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.size != seg.size || loaded.minTS() != 5 || loaded.maxTS() != 10 {
+			t.Fatalf("Expected the index to be rebuilt, but got size %d and range %v-%v", loaded.size, loaded.minTS(), loaded.maxTS())
+		}
+	}
+
+	os.Remove(seg.indexPath())
+	if _, err = loadSegment(dir, seg.id, DefaultIndexInterval); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,423 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+)
+
+// Default store options.
+const (
+	// DefaultSegmentSize is the default size of a segment file, in bytes.
+	DefaultSegmentSize = 64 * 1024 * 1024
+
+	// DefaultIndexInterval is the default size of an index block, in bytes.
+	DefaultIndexInterval = 16 * 1024
+)
+
+// Options configures the Store.
+type Options struct {
+	// SegmentSize is the size of a segment file, in bytes. Once the segment
+	// grows over this size, a new segment is started. Defaults to
+	// DefaultSegmentSize.
+	SegmentSize int64
+
+	// IndexInterval is the size of an index block, in bytes. Smaller blocks
+	// make the range lookups more precise, at the cost of a larger index.
+	// Defaults to DefaultIndexInterval.
+	IndexInterval int64
+
+	// MaxSize is the maximal size of the store, in bytes. Once the store is
+	// larger, the oldest segments are removed. Zero means no limit.
+	MaxSize int64
+
+	// MaxAge is the maximal age of a segment. The segments that have not been
+	// written to for longer than this are removed. Zero means no limit.
+	MaxAge time.Duration
+}
+
+// Store is an append-only event store, kept in segment files in a directory.
+// The Store is safe for concurrent use.
+type Store struct {
+	dir      string
+	options  Options
+	mux      sync.RWMutex
+	segments []*segment
+	file     *os.File
+	writer   *countingWriter
+	encoder  *model.Encoder
+	closed   bool
+	now      func() time.Time
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Open opens the store in the directory, creating the directory if it does
+// not exist. If options is nil, the default options are used.
+// The segments are checked, and an incomplete event at the end of a segment,
+// left behind by a crash, is removed.
+func Open(dir string, options *Options) (*Store, error) {
+	s := &Store{
+		dir: dir,
+		now: time.Now,
+	}
+	if options != nil {
+		s.options = *options
+	}
+	if s.options.SegmentSize <= 0 {
+		s.options.SegmentSize = DefaultSegmentSize
+	}
+	if s.options.IndexInterval <= 0 {
+		s.options.IndexInterval = DefaultIndexInterval
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := []uint64{}
+	for _, file := range files {
+		if id, ok := parseSegmentID(file.Name()); ok && !file.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		seg, err := loadSegment(dir, id, s.options.IndexInterval)
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, seg)
+	}
+
+	if len(s.segments) == 0 {
+		err = s.startSegment(1)
+	} else {
+		err = s.openActive()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = s.retain(); err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// active returns the segment the events are appended to.
+func (s *Store) active() *segment {
+	return s.segments[len(s.segments)-1]
+}
+
+// openActive opens the last segment file for appending.
+func (s *Store) openActive() error {
+	file, err := os.OpenFile(s.active().path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.writer = &countingWriter{w: file}
+	s.encoder = model.NewEncoder(s.writer).MaxSize(0)
+	return nil
+}
+
+// startSegment creates a new empty segment and makes it active.
+func (s *Store) startSegment(id uint64) error {
+	s.segments = append(s.segments, &segment{
+		id:       id,
+		path:     segmentPath(s.dir, id),
+		modified: s.now(),
+	})
+	if err := s.openActive(); err != nil {
+		s.segments = s.segments[:len(s.segments)-1]
+		return err
+	}
+	return nil
+}
+
+// roll closes the active segment and starts a new one.
+func (s *Store) roll() error {
+	active := s.active()
+	if err := active.writeIndex(); err != nil {
+		return err
+	}
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	if err := s.startSegment(active.id + 1); err != nil {
+		return err
+	}
+	return s.retain()
+}
+
+// Append appends the event to the store.
+func (s *Store) Append(ev *model.Event) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closed {
+		return fmt.Errorf("store closed")
+	}
+
+	if s.active().size >= s.options.SegmentSize {
+		if err := s.roll(); err != nil {
+			return err
+		}
+	}
+
+	active := s.active()
+	s.writer.n = 0
+	if err := s.encoder.Encode(ev); err != nil {
+		if s.writer.n > 0 {
+			// drop the partially written event
+			os.Truncate(active.path, active.size)
+		}
+		return err
+	}
+	active.add(active.size, s.writer.n, ev.Timestamp, s.options.IndexInterval)
+	active.modified = s.now()
+	return nil
+}
+
+// Size returns the total size of all segments, in bytes.
+func (s *Store) Size() int64 {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	size := int64(0)
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+	return size
+}
+
+// Retain removes the segments that exceed the size or the age limit. This is
+// done automatically when the store is opened and whenever a new segment is
+// started, but long running processes that write rarely may call it
+// periodically.
+func (s *Store) Retain() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closed {
+		return fmt.Errorf("store closed")
+	}
+	return s.retain()
+}
+
+// retain removes the oldest segments while the store is over the limits. The
+// active segment is never removed.
+func (s *Store) retain() error {
+	total := int64(0)
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	now := s.now()
+	for len(s.segments) > 1 {
+		oldest := s.segments[0]
+		tooLarge := s.options.MaxSize > 0 && total > s.options.MaxSize
+		tooOld := s.options.MaxAge > 0 && now.Sub(oldest.modified) > s.options.MaxAge
+		if !tooLarge && !tooOld {
+			break
+		}
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Remove(oldest.indexPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= oldest.size
+		s.segments = s.segments[1:]
+	}
+	return nil
+}
+
+// snapshot returns a copy of the current segments.
+func (s *Store) snapshot() ([]*segment, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	if s.closed {
+		return nil, fmt.Errorf("store closed")
+	}
+	segments := make([]*segment, 0, len(s.segments))
+	for _, seg := range s.segments {
+		segments = append(segments, seg.snapshot())
+	}
+	return segments, nil
+}
+
+// Scan calls fn for every event in the store, in the order in which the
+// events were appended. The events appended during the scan are not visited.
+// If fn returns an error, the scan stops and the error is returned.
+func (s *Store) Scan(fn func(ev *model.Event) error) error {
+	segments, err := s.snapshot()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if err = seg.readRange(math.Inf(-1), nil, fn); err != nil {
+			if os.IsNotExist(err) {
+				// removed by the retention in the meantime
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Range calls fn for every event with timestamp between start and end (both
+// inclusive), sorted by the timestamp in the given order. If end is nil, the
+// range is open. The events with the same timestamp are visited in the order
+// in which they were appended.
+// Only the segments whose time range overlaps with the requested range are
+// read. The events of a segment are held in memory until all segments that
+// may hold earlier (or later, for descending order) events have been read.
+// If fn returns an error, the lookup stops and the error is returned.
+func (s *Store) Range(start float64, end *float64, order comm.EventOrder, fn func(ev *model.Event) error) error {
+	segments, err := s.snapshot()
+	if err != nil {
+		return err
+	}
+	desc := order == comm.OrderDesc
+
+	// the segments that may hold events within the range, sorted so that
+	// the events are found in the requested order
+	candidates := []*segment{}
+	for _, seg := range segments {
+		if len(seg.blocks) == 0 {
+			continue
+		}
+		b := block{MinTS: seg.minTS(), MaxTS: seg.maxTS()}
+		if b.overlaps(start, end) {
+			candidates = append(candidates, seg)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if desc {
+			return candidates[i].maxTS() > candidates[j].maxTS()
+		}
+		return candidates[i].minTS() < candidates[j].minTS()
+	})
+	before := func(a, b float64) bool {
+		if desc {
+			return a > b
+		}
+		return a < b
+	}
+	less := func(a, b *rangeEvent) bool {
+		if a.ev.Timestamp != b.ev.Timestamp {
+			return before(a.ev.Timestamp, b.ev.Timestamp)
+		}
+		// keep the events with the same timestamp in the append order
+		if a.segment != b.segment {
+			return a.segment < b.segment
+		}
+		return a.position < b.position
+	}
+
+	pending := []*rangeEvent{}
+	for i, seg := range candidates {
+		events := []*rangeEvent{}
+		err = seg.readRange(start, end, func(ev *model.Event) error {
+			events = append(events, &rangeEvent{ev: ev, segment: seg.id, position: len(events)})
+			return nil
+		})
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		sort.Slice(events, func(i, j int) bool {
+			return less(events[i], events[j])
+		})
+		pending = merge(pending, events, less)
+
+		// no other segment has events that come before this boundary, so
+		// the pending events up to it are in their final order
+		boundary := math.Inf(1)
+		if desc {
+			boundary = math.Inf(-1)
+		}
+		if i+1 < len(candidates) {
+			if desc {
+				boundary = candidates[i+1].maxTS()
+			} else {
+				boundary = candidates[i+1].minTS()
+			}
+		}
+		count := 0
+		for count < len(pending) && before(pending[count].ev.Timestamp, boundary) {
+			if err = fn(pending[count].ev); err != nil {
+				return err
+			}
+			count++
+		}
+		pending = pending[count:]
+	}
+	for _, event := range pending {
+		if err = fn(event.ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeEvent is an event found by Range, with its position in the store.
+type rangeEvent struct {
+	ev       *model.Event
+	segment  uint64
+	position int
+}
+
+// merge merges two sorted lists of events.
+func merge(a, b []*rangeEvent, less func(a, b *rangeEvent) bool) []*rangeEvent {
+	result := make([]*rangeEvent, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if less(b[0], a[0]) {
+			result = append(result, b[0])
+			b = b[1:]
+		} else {
+			result = append(result, a[0])
+			a = a[1:]
+		}
+	}
+	result = append(result, a...)
+	return append(result, b...)
+}
+
+// Close writes the index of the active segment and closes the store.
+func (s *Store) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if err := s.active().writeIndex(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,347 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "selene-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// testEvents generates events with the timestamps mostly, but not strictly,
+// increasing - the same as the events arrive from multiple sources.
+func testEvents(n int) []*model.Event {
+	rnd := rand.New(rand.NewSource(1))
+	events := []*model.Event{}
+	for i := 0; i < n; i++ {
+		events = append(events, &model.Event{
+			ID:        fmt.Sprintf("%d", i),
+			Timestamp: float64(i) + float64(rnd.Intn(20)),
+			Source:    "/test",
+			Tags:      []string{"test"},
+			Content:   fmt.Sprintf("event number %d", i),
+		})
+	}
+	return events
+}
+
+func appendAll(t *testing.T, store *Store, events []*model.Event) {
+	for _, ev := range events {
+		if err := store.Append(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func scanIDs(t *testing.T, store *Store) []string {
+	ids := []string{}
+	if err := store.Scan(func(ev *model.Event) error {
+		ids = append(ids, ev.ID)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func rangeIDs(t *testing.T, store *Store, start float64, end *float64, order comm.EventOrder) []string {
+	ids := []string{}
+	if err := store.Range(start, end, order, func(ev *model.Event) error {
+		ids = append(ids, ev.ID)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+// expectedRange sorts the events the same way as Range is expected to.
+func expectedRange(events []*model.Event, start float64, end *float64, order comm.EventOrder) []string {
+	matching := []*model.Event{}
+	for _, ev := range events {
+		if ev.Timestamp >= start && (end == nil || ev.Timestamp <= *end) {
+			matching = append(matching, ev)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		if order == comm.OrderDesc {
+			return matching[i].Timestamp > matching[j].Timestamp
+		}
+		return matching[i].Timestamp < matching[j].Timestamp
+	})
+	ids := []string{}
+	for _, ev := range matching {
+		ids = append(ids, ev.ID)
+	}
+	return ids
+}
+
+func assertIDs(t *testing.T, name string, expected, actual []string) {
+	if fmt.Sprint(expected) != fmt.Sprint(actual) {
+		t.Fatalf("%s: expected %v, but got %v", name, expected, actual)
+	}
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestStore_appendAndScan(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	options := &Options{SegmentSize: 1024, IndexInterval: 256}
+	store, err := Open(dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := testEvents(100)
+	appendAll(t, store, events[:60])
+	if len(segmentFiles(t, dir)) < 3 {
+		t.Fatalf("Expected the events to be split in multiple segments, but got %v", segmentFiles(t, dir))
+	}
+	if err = store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Append(events[60]); err == nil {
+		t.Fatal("Expected an error when appending to a closed store.")
+	}
+
+	store, err = Open(dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	appendAll(t, store, events[60:])
+
+	expected := []string{}
+	for _, ev := range events {
+		expected = append(expected, ev.ID)
+	}
+	assertIDs(t, "scan", expected, scanIDs(t, store))
+}
+
+func TestStore_range(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	store, err := Open(dir, &Options{SegmentSize: 2048, IndexInterval: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	events := testEvents(300)
+	appendAll(t, store, events)
+
+	end := func(v float64) *float64 { return &v }
+	cases := []struct {
+		start float64
+		end   *float64
+	}{
+		{0, nil},
+		{50, nil},
+		{100, end(150)},
+		{42, end(42)},
+		{1000, nil},
+		{0, end(-1)},
+	}
+	for _, c := range cases {
+		for _, order := range []comm.EventOrder{comm.OrderAsc, comm.OrderDesc} {
+			name := fmt.Sprintf("%v-%v %s", c.start, c.end, order)
+			assertIDs(t, name, expectedRange(events, c.start, c.end, order), rangeIDs(t, store, c.start, c.end, order))
+		}
+	}
+
+	// stop on error
+	stop := fmt.Errorf("stop")
+	count := 0
+	err = store.Range(0, nil, comm.OrderAsc, func(ev *model.Event) error {
+		count++
+		if count == 5 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || count != 5 {
+		t.Fatalf("Expected the lookup to stop after 5 events, but got %v after %d events", err, count)
+	}
+}
+
+// TestStore_rangeSkipsBlocks checks that only the blocks within the range
+// are read.
+func TestStore_rangeSkipsBlocks(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	store, err := Open(dir, &Options{IndexInterval: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	events := []*model.Event{}
+	for i := 0; i < 50; i++ {
+		events = append(events, &model.Event{ID: fmt.Sprintf("%d", i), Timestamp: float64(i), Content: "sorted"})
+	}
+	appendAll(t, store, events)
+
+	// corrupt the first block - it must not be read for a later range
+	active := store.active()
+	if len(active.blocks) < 10 {
+		t.Fatalf("Expected multiple blocks, but got %d", len(active.blocks))
+	}
+	file, err := os.OpenFile(active.path, os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteAt([]byte("garbage"), 0)
+	file.Close()
+
+	assertIDs(t, "later range", []string{"48", "49"}, rangeIDs(t, store, 48, nil, comm.OrderAsc))
+	if err = store.Range(0, nil, comm.OrderAsc, func(ev *model.Event) error { return nil }); err == nil {
+		t.Fatal("Expected an error reading the corrupted block.")
+	}
+}
+
+func TestStore_retentionBySize(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	store, err := Open(dir, &Options{SegmentSize: 1024, MaxSize: 3000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	events := testEvents(200)
+	appendAll(t, store, events)
+
+	if size := store.Size(); size > 3000+1024 {
+		t.Fatalf("Expected the store to be limited in size, but it is %d bytes", size)
+	}
+	ids := scanIDs(t, store)
+	if len(ids) == 0 || len(ids) >= len(events) {
+		t.Fatalf("Expected only the latest events to be kept, but got %d events", len(ids))
+	}
+	assertIDs(t, "latest events", []string{events[len(events)-1].ID}, ids[len(ids)-1:])
+	if files := segmentFiles(t, dir); len(files) != len(store.segments) {
+		t.Fatalf("Expected the removed segment files to be deleted, but got %v", files)
+	}
+}
+
+func TestStore_retentionByAge(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	store, err := Open(dir, &Options{SegmentSize: 1024, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	events := testEvents(100)
+	appendAll(t, store, events[:50])
+	now = now.Add(2 * time.Hour)
+	appendAll(t, store, events[50:])
+
+	if err = store.Retain(); err != nil {
+		t.Fatal(err)
+	}
+	ids := scanIDs(t, store)
+	for _, id := range ids {
+		if id == "0" {
+			t.Fatal("Expected the old events to be removed.")
+		}
+	}
+	if len(ids) == 0 {
+		t.Fatal("Expected the recent events to be kept.")
+	}
+}
+
+func TestStore_recovery(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	store, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := testEvents(10)
+	appendAll(t, store, events[:5])
+	path := store.active().path
+	// simulate a crash: the index is not written, and the last event is
+	// written only partially
+	store.file.Close()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("event:100 50 50\nid:5\ntimest")
+	file.Close()
+
+	store, err = Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	appendAll(t, store, events[5:])
+	assertIDs(t, "recovered", []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}, scanIDs(t, store))
+	assertIDs(t, "range", expectedRange(events, 5, nil, comm.OrderDesc), rangeIDs(t, store, 5, nil, comm.OrderDesc))
+}
+
+func TestStore_concurrent(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	store, err := Open(dir, &Options{SegmentSize: 2048, IndexInterval: 256, MaxSize: 8192})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	done := make(chan error)
+	go func() {
+		for _, ev := range testEvents(500) {
+			if err := store.Append(ev); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	for i := 0; i < 20; i++ {
+		last := -1.0
+		err = store.Range(0, nil, comm.OrderAsc, func(ev *model.Event) error {
+			if ev.Timestamp < last {
+				return fmt.Errorf("events out of order: %v after %v", ev.Timestamp, last)
+			}
+			last = ev.Timestamp
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+}
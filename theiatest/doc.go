@@ -0,0 +1,22 @@
+// Package theiatest provides an in-memory Theia server for testing.
+//
+// The Server runs a server.Server with an in-memory store over the standard
+// httptest server: events published on /event are stored in memory, /find
+// looks up the stored events that match the filter, and /live pushes the
+// matching events as they arrive. Any Theia client, including comm.WebsocketClient, can be used
+// against it:
+//
+//	server := theiatest.NewServer()
+//	defer server.Close()
+//
+//	client := comm.NewWebsocketClient(server.URL)
+//	client.Send(&model.Event{ID: "1", Timestamp: 10, Content: "hello"})
+//	server.WaitForEvents(1, time.Second)
+//
+//	resp, err := client.Find(comm.Filter(0).MatchContent("hel+o"))
+//
+// Faults can be injected to test how the clients handle dropped messages,
+// slow responses, server errors and broken connections:
+//
+//	server.InjectFault(theiatest.EndpointFind, theiatest.Fault{Error: "overloaded"})
+package theiatest
@@ -0,0 +1,175 @@
+package theiatest
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/theia-log/selene/model"
+	"github.com/theia-log/selene/server"
+)
+
+// The Theia endpoints, used to inject faults.
+const (
+	EndpointEvent = "event"
+	EndpointFind  = "find"
+	EndpointLive  = "live"
+)
+
+// Fault describes a failure injected in the handling of a single request: an
+// event published on /event, or a filter sent to /find or /live.
+// Delay is applied first, then the first of the other faults that is set.
+type Fault struct {
+	// Delay delays the handling of the request.
+	Delay time.Duration
+
+	// Drop silently ignores the request. A dropped event is not stored and not
+	// acknowledged; a dropped filter gets no response.
+	Drop bool
+
+	// Error responds to the request with an error JSON message with this
+	// error text, the same way Theia reports errors.
+	Error string
+
+	// Disconnect breaks the connection without closing it properly.
+	Disconnect bool
+}
+
+// Server is an in-memory Theia server for testing. It runs a server.Server
+// with a server.MemoryStore, and injects the faults in the handling of the
+// requests.
+// The events are kept in memory, in the order in which they were received.
+// All methods are safe for concurrent use.
+type Server struct {
+	// URL is the websocket URL of the server, for example
+	// ws://127.0.0.1:43127. Use it as the Theia server URL in the clients.
+	URL string
+
+	server *httptest.Server
+	srv    *server.Server
+	store  *server.MemoryStore
+	mux    sync.Mutex
+	faults map[string][]Fault
+}
+
+// NewServer starts a new in-memory Theia server on a random local port.
+// The server must be closed with Close once the test is done.
+func NewServer() *Server {
+	s := &Server{
+		store:  server.NewMemoryStore(),
+		faults: map[string][]Fault{},
+	}
+	s.srv = server.New(s.store).Intercept(s.applyFault)
+	s.server = httptest.NewServer(s.srv)
+	s.URL = "ws" + strings.TrimPrefix(s.server.URL, "http")
+	return s
+}
+
+// Close breaks all open connections and shuts down the server.
+func (s *Server) Close() {
+	s.srv.Close()
+	s.server.Close()
+}
+
+// Add stores the events, as if they were published on /event. The events are
+// pushed to the matching /live subscribers as well.
+func (s *Server) Add(events ...*model.Event) *Server {
+	for _, ev := range events {
+		s.srv.Add(ev)
+	}
+	return s
+}
+
+// Events returns all stored events, in the order in which they were received.
+func (s *Server) Events() []*model.Event {
+	events := []*model.Event{}
+	s.store.Scan(func(ev *model.Event) error {
+		events = append(events, ev)
+		return nil
+	})
+	return events
+}
+
+// WaitForEvents waits until at least n events are stored, or the timeout
+// expires. Returns true if the events were stored in time.
+func (s *Server) WaitForEvents(n int, timeout time.Duration) bool {
+	return waitFor(func() bool { return len(s.Events()) >= n }, timeout)
+}
+
+// WaitForSubscribers waits until at least n clients are subscribed to /live,
+// or the timeout expires. Returns true if the clients subscribed in time.
+// Use this to make sure that a client receives the events added after it
+// called Receive.
+func (s *Server) WaitForSubscribers(n int, timeout time.Duration) bool {
+	return waitFor(func() bool { return s.srv.Subscribers() >= n }, timeout)
+}
+
+// waitFor waits until the condition is met, or the timeout expires.
+func waitFor(condition func() bool, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if condition() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// InjectFault adds a fault to be applied on the next request to the endpoint
+// (EndpointEvent, EndpointFind or EndpointLive). Multiple faults are applied
+// on the following requests, one fault per request, in the order in which
+// they were added.
+func (s *Server) InjectFault(endpoint string, fault Fault) *Server {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.faults[endpoint] = append(s.faults[endpoint], fault)
+	return s
+}
+
+// nextFault takes the next fault for the endpoint.
+func (s *Server) nextFault(endpoint string) (Fault, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	faults := s.faults[endpoint]
+	if len(faults) == 0 {
+		return Fault{}, false
+	}
+	s.faults[endpoint] = faults[1:]
+	return faults[0], true
+}
+
+// applyFault applies the next fault for the endpoint, if any. Returns false if
+// the request must not be handled any further.
+func (s *Server) applyFault(endpoint string, conn *websocket.Conn) bool {
+	fault, ok := s.nextFault(endpoint)
+	if !ok {
+		return true
+	}
+	if fault.Delay > 0 {
+		time.Sleep(fault.Delay)
+	}
+	switch {
+	case fault.Drop:
+		if endpoint != EndpointEvent {
+			// no response, wait for the client to give up
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					break
+				}
+			}
+		}
+		return false
+	case fault.Error != "":
+		conn.WriteJSON(map[string]string{"error": fault.Error})
+		return false
+	case fault.Disconnect:
+		conn.UnderlyingConn().Close()
+		return false
+	}
+	return true
+}
@@ -0,0 +1,175 @@
+package theiatest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/theia-log/selene/comm"
+	"github.com/theia-log/selene/model"
+)
+
+func testEvents() []*model.Event {
+	return []*model.Event{
+		{ID: "1", Timestamp: 10, Source: "/api", Tags: []string{"api", "info"}, Content: "request served"},
+		{ID: "2", Timestamp: 30, Source: "/db", Tags: []string{"db", "error"}, Content: "connection timeout"},
+		{ID: "3", Timestamp: 20, Source: "/db", Tags: []string{"db", "info"}, Content: "query executed"},
+	}
+}
+
+// collect reads all events from the channel, until it is closed.
+func collect(t *testing.T, resp chan *comm.EventResponse) ([]string, []error) {
+	ids := []string{}
+	errs := []error{}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-resp:
+			if !ok {
+				return ids, errs
+			}
+			if event.Error != nil {
+				errs = append(errs, event.Error)
+				continue
+			}
+			ids = append(ids, event.Event.ID)
+		case <-timeout:
+			t.Fatal("Timeout while reading events.")
+		}
+	}
+}
+
+func TestServer_sendAndFind(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	client := comm.NewWebsocketClient(server.URL)
+	for _, ev := range testEvents() {
+		if err := client.Send(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !server.WaitForEvents(3, 5*time.Second) {
+		t.Fatal("Events were not stored.")
+	}
+
+	cases := []struct {
+		filter   *comm.EventFilter
+		expected string
+	}{
+		{comm.Filter(0), "132"},
+		{comm.Filter(0).OrderDesc(), "231"},
+		{comm.Filter(15).MatchEnd(30), "32"},
+		{comm.Filter(0).MatchTag("db", "^info$"), "3"},
+		{comm.Filter(0).MatchContent("time(out)?"), "2"},
+		{comm.Filter(100), ""},
+	}
+	for _, c := range cases {
+		resp, err := comm.NewWebsocketClient(server.URL).Find(c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, errs := collect(t, resp)
+		found := ""
+		for _, id := range ids {
+			found += id
+		}
+		if found != c.expected {
+			t.Fatalf("Expected events %q, but found %q", c.expected, found)
+		}
+		for _, err := range errs {
+			if _, ok := err.(*comm.ClosedError); !ok {
+				t.Fatalf("Unexpected error: %s", err.Error())
+			}
+		}
+	}
+}
+
+func TestServer_live(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.Add(testEvents()[0])
+
+	client := comm.NewWebsocketClient(server.URL)
+	resp, err := client.Receive(comm.Filter(0).MatchTag("db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !server.WaitForSubscribers(1, 5*time.Second) {
+		t.Fatal("Client did not subscribe.")
+	}
+	server.Add(testEvents()[1:]...)
+
+	for _, expected := range []string{"2", "3"} {
+		select {
+		case event := <-resp:
+			if event.Error != nil {
+				t.Fatal(event.Error)
+			}
+			if event.Event.ID != expected {
+				t.Fatalf("Expected event %s, but got %s", expected, event.Event.ID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout while waiting for live events.")
+		}
+	}
+	client.Close()
+}
+
+func TestServer_faults(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.InjectFault(EndpointEvent, Fault{Drop: true}).
+		InjectFault(EndpointEvent, Fault{Delay: 50 * time.Millisecond})
+
+	client := comm.NewWebsocketClient(server.URL)
+	for _, ev := range testEvents()[:2] {
+		if err := client.Send(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !server.WaitForEvents(1, 5*time.Second) {
+		t.Fatal("Event was not stored.")
+	}
+	if events := server.Events(); len(events) != 1 || events[0].ID != "2" {
+		t.Fatalf("Expected only the second event to be stored, but got %v", events)
+	}
+
+	server.InjectFault(EndpointFind, Fault{Error: "overloaded"})
+	resp, err := comm.NewWebsocketClient(server.URL).Find(comm.Filter(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, errs := collect(t, resp)
+	var serverErr *comm.ServerError
+	if len(ids) != 0 || len(errs) == 0 || !errors.As(errs[0], &serverErr) || serverErr.Message != "overloaded" {
+		t.Fatalf("Expected server error, but got events %v and errors %v", ids, errs)
+	}
+
+	server.InjectFault(EndpointFind, Fault{Disconnect: true})
+	resp, err = comm.NewWebsocketClient(server.URL).Find(comm.Filter(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, errs = collect(t, resp)
+	var transportErr *comm.TransportError
+	if len(ids) != 0 || len(errs) != 1 || !errors.As(errs[0], &transportErr) {
+		t.Fatalf("Expected transport error, but got events %v and errors %v", ids, errs)
+	}
+}
+
+func TestServer_invalidFilter(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	resp, err := comm.NewWebsocketClient(server.URL).Find(comm.Filter(0).MatchContent("("))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errs := collect(t, resp)
+	var serverErr *comm.ServerError
+	if len(errs) == 0 || !errors.As(errs[0], &serverErr) {
+		t.Fatalf("Expected server error, but got %v", errs)
+	}
+}
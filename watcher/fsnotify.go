@@ -54,53 +54,54 @@ func (s *FSNotifyEventSource) fileAvailable() error {
 
 // calculateDiff calculates the diff from the previous position.
 // The diff contains the bytes from the last position of the file to the end of
-// the file.
-func (s *FSNotifyEventSource) calculateDiff() ([]byte, error) {
+// the file. Returns the diff and the position in the file where the diff
+// starts.
+func (s *FSNotifyEventSource) calculateDiff() ([]byte, int64, error) {
 	f, err := os.Open(s.AbsFilePath)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer f.Close()
-	curr := s.currentPos
+	start := s.currentPos
 
-	_, err = f.Seek(curr, os.SEEK_SET)
+	_, err = f.Seek(start, os.SEEK_SET)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	diff, err := ioutil.ReadAll(f)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	curr, err = f.Seek(0, os.SEEK_CUR)
+	curr, err := f.Seek(0, os.SEEK_CUR)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	s.currentPos = curr
 
-	return diff, err
+	return diff, start, err
 }
 
 // handleFSNotifyEvent called on inotify change event.
 // Checks for file changes and calculates the diff.
 func (s *FSNotifyEventSource) handleFSNotifyEvent(ev fsnotify.Event) error {
 	if ev.Op&fsnotify.Write == fsnotify.Write {
-		diff, err := s.calculateDiff()
+		diff, offset, err := s.calculateDiff()
 		if err != nil {
 			return err
 		}
-		s.Trigger(diff)
+		s.TriggerAt(offset, diff)
 	} else if ev.Op&fsnotify.Create == fsnotify.Create {
 		if err := s.fileAvailable(); err != nil {
 			return err
 		}
-		diff, err := s.calculateDiff()
+		diff, offset, err := s.calculateDiff()
 		if err != nil {
 			return err
 		}
-		s.Trigger(diff)
+		s.TriggerAt(offset, diff)
 	}
 	return nil
 }
@@ -9,6 +9,12 @@ package watcher
 //	 State(event_now) - State(event_before)
 type EventHandler func(source string, diff []byte)
 
+// OffsetEventHandler defines a type for handling a change in a particular
+// source, together with the position of the change in the source.
+// The offset is the position of the first byte of the diff in the source, or
+// negative if the position is not known.
+type OffsetEventHandler func(source string, offset int64, diff []byte)
+
 // EventSource defines the general interface for an event source.
 type EventSource interface {
 	// OnSourceEvent adds an EventHandler for the generated events by this
@@ -22,6 +28,16 @@ type EventSource interface {
 	Trigger(diff []byte)
 }
 
+// OffsetEventSource is an EventSource that knows the position of the changes
+// in the source.
+type OffsetEventSource interface {
+	EventSource
+
+	// OnSourceEventAt adds an OffsetEventHandler for the generated events by
+	// this source.
+	OnSourceEventAt(handler OffsetEventHandler)
+}
+
 // WatchDaemon is a general interface for a manager of EventSource sources.
 type WatchDaemon interface {
 	// Start the daemon. Events from the event sources shall be handled after
@@ -50,6 +66,9 @@ type GenericEventSource struct {
 
 	// List of event handlers to be triggered on source event.
 	handlers []EventHandler
+
+	// List of event handlers that need the offset of the change.
+	offsetHandlers []OffsetEventHandler
 }
 
 // OnSourceEvent registers an EventHandler to be triggered when this source is
@@ -58,11 +77,26 @@ func (g *GenericEventSource) OnSourceEvent(handler EventHandler) {
 	g.handlers = append(g.handlers, handler)
 }
 
+// OnSourceEventAt registers an OffsetEventHandler to be triggered when this
+// source is changed. The handler receives the offset of the change as well.
+func (g *GenericEventSource) OnSourceEventAt(handler OffsetEventHandler) {
+	g.offsetHandlers = append(g.offsetHandlers, handler)
+}
+
 // Trigger an event over this source. Used mostly internally.
 func (g *GenericEventSource) Trigger(diff []byte) {
+	g.TriggerAt(-1, diff)
+}
+
+// TriggerAt triggers an event over this source, for a change at the given
+// offset. Used mostly internally.
+func (g *GenericEventSource) TriggerAt(offset int64, diff []byte) {
 	for _, handler := range g.handlers {
 		handler(g.FilePath, diff)
 	}
+	for _, handler := range g.offsetHandlers {
+		handler(g.FilePath, offset, diff)
+	}
 }
 
 // NewEventSource builds new GenericEventSource for the given file path.
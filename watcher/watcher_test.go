@@ -33,3 +33,29 @@ func TestTriggerEventHandler(t *testing.T) {
 		t.Fatal("Handler was not called.")
 	}
 }
+
+func TestTriggerAtEventHandler(t *testing.T) {
+	eventSource := NewEventSource("test")
+
+	var offsets []int64
+	eventSource.OnSourceEventAt(func(source string, offset int64, diff []byte) {
+		offsets = append(offsets, offset)
+	})
+	handlerCalled := false
+	eventSource.OnSourceEvent(func(source string, diff []byte) {
+		handlerCalled = true
+	})
+
+	eventSource.TriggerAt(42, []byte("trigger content"))
+	eventSource.Trigger([]byte("trigger content"))
+
+	if !handlerCalled {
+		t.Fatal("Handler was not called.")
+	}
+	if len(offsets) != 2 || offsets[0] != 42 || offsets[1] != -1 {
+		t.Fatalf("Invalid offsets passed to the handler function: %v", offsets)
+	}
+	if _, ok := NewFileSource("test").(OffsetEventSource); !ok {
+		t.Fatal("File source does not report the offsets.")
+	}
+}